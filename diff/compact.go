@@ -0,0 +1,306 @@
+package diff
+
+// Scoring of the places a group of changes can slide to, taken from
+// git's indent heuristic: prefer splits next to blank lines and at
+// lower indentation, so hunks start and end where a reader expects.
+const (
+	maxIndent                       = 200
+	maxBlanks                       = 20
+	maxIndentSliding                = 100
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+)
+
+// group is a run of changed lines [start, end) in one file, possibly
+// empty.
+type group struct {
+	start, end int
+}
+
+// compactor slides the change groups of one file, keeping the groups
+// of the other file in step, the way xdiff's xdl_change_compact does.
+type compactor struct {
+	text         []string
+	lines        []int
+	changed      []bool
+	otherChanged []bool
+	noHeuristic  bool // leave groups at the bottom, as xdiff does without XDF_INDENT_HEURISTIC
+}
+
+func changedAt(changed []bool, i int) bool {
+	return i >= 0 && i < len(changed) && changed[i]
+}
+
+func groupInit(changed []bool) group {
+	g := group{}
+	for changedAt(changed, g.end) {
+		g.end++
+	}
+	return g
+}
+
+func groupNext(changed []bool, g *group) bool {
+	if g.end == len(changed) {
+		return false
+	}
+	g.start = g.end + 1
+	g.end = g.start
+	for changedAt(changed, g.end) {
+		g.end++
+	}
+	return true
+}
+
+func groupPrevious(changed []bool, g *group) bool {
+	if g.start == 0 {
+		return false
+	}
+	g.end = g.start - 1
+	g.start = g.end
+	for changedAt(changed, g.start-1) {
+		g.start--
+	}
+	return true
+}
+
+func (c *compactor) slideDown(g *group) bool {
+	if g.end < len(c.lines) && c.lines[g.start] == c.lines[g.end] {
+		c.changed[g.start] = false
+		c.changed[g.end] = true
+		g.start++
+		g.end++
+		for changedAt(c.changed, g.end) {
+			g.end++
+		}
+		return true
+	}
+	return false
+}
+
+func (c *compactor) slideUp(g *group) bool {
+	if g.start > 0 && c.lines[g.start-1] == c.lines[g.end-1] {
+		g.start--
+		g.end--
+		c.changed[g.start] = true
+		c.changed[g.end] = false
+		for changedAt(c.changed, g.start-1) {
+			g.start--
+		}
+		return true
+	}
+	return false
+}
+
+// compact slides every group of changes as far down as it goes. A
+// group that can line up with a change in the other file is moved
+// there; otherwise it goes to the best place by the indent heuristic.
+func (c *compactor) compact() {
+	g := groupInit(c.changed)
+	other := groupInit(c.otherChanged)
+	for {
+		if g.end != g.start {
+			var size, earliestEnd, endMatchingOther int
+			for {
+				// sliding can merge groups, so repeat until the size holds
+				size = g.end - g.start
+				endMatchingOther = -1
+				for c.slideUp(&g) {
+					groupPrevious(c.otherChanged, &other)
+				}
+				earliestEnd = g.end
+				if other.end > other.start {
+					endMatchingOther = g.end
+				}
+				for c.slideDown(&g) {
+					groupNext(c.otherChanged, &other)
+					if other.end > other.start {
+						endMatchingOther = g.end
+					}
+				}
+				if size == g.end-g.start {
+					break
+				}
+			}
+
+			switch {
+			case g.end == earliestEnd:
+				// the group cannot move
+			case endMatchingOther != -1:
+				for other.end == other.start {
+					c.slideUp(&g)
+					groupPrevious(c.otherChanged, &other)
+				}
+			case c.noHeuristic:
+				// the group stays as far down as it goes
+			default:
+				best := c.bestShift(g, size, earliestEnd)
+				for g.end > best {
+					c.slideUp(&g)
+					groupPrevious(c.otherChanged, &other)
+				}
+			}
+		}
+		if !groupNext(c.changed, &g) {
+			break
+		}
+		groupNext(c.otherChanged, &other)
+	}
+}
+
+// bestShift picks the end position, between earliestEnd and the
+// current end of g, where the group reads best.
+func (c *compactor) bestShift(g group, size, earliestEnd int) int {
+	shift := max(earliestEnd, g.end-size-1, g.end-maxIndentSliding)
+	best := -1
+	var bestScore splitScore
+	for ; shift <= g.end; shift++ {
+		var score splitScore
+		score.add(c.measure(shift))
+		score.add(c.measure(shift - size))
+		if best == -1 || score.cmp(bestScore) <= 0 {
+			bestScore = score
+			best = shift
+		}
+	}
+	return best
+}
+
+// indent returns the width of the leading whitespace of line, with
+// tabs to multiples of eight, or -1 for a blank line.
+func indent(line string) int {
+	n := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			n++
+		case '\t':
+			n += 8 - n%8
+		case '\n', '\r', '\v', '\f':
+		default:
+			return n
+		}
+		if n >= maxIndent {
+			return maxIndent
+		}
+	}
+	return -1
+}
+
+// splitMeasurement describes the lines around a split before line split.
+type splitMeasurement struct {
+	endOfFile  bool
+	indent     int
+	preBlank   int
+	preIndent  int
+	postBlank  int
+	postIndent int
+}
+
+func (c *compactor) measure(split int) splitMeasurement {
+	var m splitMeasurement
+	if split >= len(c.text) {
+		m.endOfFile = true
+		m.indent = -1
+	} else {
+		m.indent = indent(c.text[split])
+	}
+
+	m.preIndent = -1
+	for i := split - 1; i >= 0; i-- {
+		if m.preIndent = indent(c.text[i]); m.preIndent != -1 {
+			break
+		}
+		m.preBlank++
+		if m.preBlank == maxBlanks {
+			m.preIndent = 0
+			break
+		}
+	}
+
+	m.postIndent = -1
+	for i := split + 1; i < len(c.text); i++ {
+		if m.postIndent = indent(c.text[i]); m.postIndent != -1 {
+			break
+		}
+		m.postBlank++
+		if m.postBlank == maxBlanks {
+			m.postIndent = 0
+			break
+		}
+	}
+	return m
+}
+
+type splitScore struct {
+	effectiveIndent int
+	penalty         int
+}
+
+func (s *splitScore) add(m splitMeasurement) {
+	if m.preIndent == -1 && m.preBlank == 0 {
+		s.penalty += startOfFilePenalty
+	}
+	if m.endOfFile {
+		s.penalty += endOfFilePenalty
+	}
+
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+	totalBlank := m.preBlank + postBlank
+	s.penalty += totalBlankWeight * totalBlank
+	s.penalty += postBlankWeight * postBlank
+
+	lineIndent := m.indent
+	if lineIndent == -1 {
+		lineIndent = m.postIndent
+	}
+	anyBlanks := totalBlank != 0
+	s.effectiveIndent += lineIndent
+
+	switch {
+	case lineIndent == -1, m.preIndent == -1, lineIndent == m.preIndent:
+	case lineIndent > m.preIndent:
+		s.penalty += pick(anyBlanks, relativeIndentWithBlankPenalty, relativeIndentPenalty)
+	case m.postIndent != -1 && m.postIndent > lineIndent:
+		s.penalty += pick(anyBlanks, relativeOutdentWithBlankPenalty, relativeOutdentPenalty)
+	default:
+		s.penalty += pick(anyBlanks, relativeDedentWithBlankPenalty, relativeDedentPenalty)
+	}
+}
+
+// cmp is negative when s is the better split.
+func (s splitScore) cmp(o splitScore) int {
+	indents := 0
+	if s.effectiveIndent > o.effectiveIndent {
+		indents = 1
+	} else if s.effectiveIndent < o.effectiveIndent {
+		indents = -1
+	}
+	return indentWeight*indents + (s.penalty - o.penalty)
+}
+
+func pick(cond bool, yes, no int) int {
+	if cond {
+		return yes
+	}
+	return no
+}
+
+// finish normalises the change marks of both files and turns them
+// into an edit script.
+func finish(a, b []string, ia, ib []int, changedA, changedB []bool, noHeuristic bool) []Edit {
+	(&compactor{text: a, lines: ia, changed: changedA, otherChanged: changedB, noHeuristic: noHeuristic}).compact()
+	(&compactor{text: b, lines: ib, changed: changedB, otherChanged: changedA, noHeuristic: noHeuristic}).compact()
+	return script(changedA, changedB)
+}
@@ -0,0 +1,181 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Algorithm names, as given to --diff-algorithm or diff.algorithm.
+const (
+	MYERS     = "myers"
+	MINIMAL   = "minimal"
+	PATIENCE  = "patience"
+	HISTOGRAM = "histogram"
+)
+
+// Options selects the algorithm and how lines are compared.
+type Options struct {
+	Algorithm         string // MYERS when empty
+	IgnoreAllSpace    bool   // -w: whitespace never matters
+	IgnoreSpaceChange bool   // -b: runs of whitespace compare equal
+	IgnoreBlankLines  bool   // drop hunks that only add or remove blank lines
+	NoIndentHeuristic bool   // slide changes down instead of to where they read best
+}
+
+// ParseAlgorithm checks an algorithm name the way git spells them.
+func ParseAlgorithm(name string) (string, error) {
+	switch name = strings.ToLower(name); name {
+	case "default":
+		return MYERS, nil
+	case MYERS, MINIMAL, PATIENCE, HISTOGRAM:
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown diff algorithm '%s'", name)
+}
+
+// isSpace is C's isspace, which git uses for whitespace options.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+// key returns what two lines must share to compare equal.
+func (o Options) key(line string) string {
+	if !o.IgnoreAllSpace && !o.IgnoreSpaceChange {
+		return line
+	}
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		if !isSpace(line[i]) {
+			b.WriteByte(line[i])
+			continue
+		}
+		j := i
+		for j < len(line) && isSpace(line[j]) {
+			j++
+		}
+		// -b keeps one space between words, but none at the end
+		if !o.IgnoreAllSpace && j < len(line) {
+			b.WriteByte(' ')
+		}
+		i = j - 1
+	}
+	return b.String()
+}
+
+// isBlank reports whether line counts as blank for IgnoreBlankLines.
+func (o Options) isBlank(line string) bool {
+	if !o.IgnoreAllSpace && !o.IgnoreSpaceChange {
+		return len(line) <= 1
+	}
+	for i := 0; i < len(line); i++ {
+		if !isSpace(line[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Lines computes an edit script from a to b with the algorithm and
+// line comparison chosen in opts.
+func Lines(a, b []string, opts Options) []Edit {
+	ia, ib := intern(a, b, opts.key)
+	changedA, changedB := make([]bool, len(a)), make([]bool, len(b))
+	switch opts.Algorithm {
+	case PATIENCE:
+		patienceMarks(ia, ib, changedA, changedB)
+	case HISTOGRAM:
+		histogramMarks(ia, ib, changedA, changedB)
+	default:
+		myersMarks(ia, ib, changedA, changedB, opts.Algorithm == MINIMAL)
+	}
+	return finish(a, b, ia, ib, changedA, changedB, opts.NoIndentHeuristic)
+}
+
+// Op is the kind of one line in an edit script, written as the
+// prefix the line gets in unified output.
+type Op byte
+
+const (
+	Equal  Op = ' '
+	Delete Op = '-'
+	Insert Op = '+'
+)
+
+// Edit is one line of an edit script. A indexes the old lines (Equal
+// and Delete), B the new lines (Equal and Insert).
+type Edit struct {
+	Op Op
+	A  int
+	B  int
+}
+
+// binarySniffLen is how much of a file git looks at for NUL bytes.
+const binarySniffLen = 8000
+
+// IsBinary reports whether data looks like a binary file.
+func IsBinary(data []byte) bool {
+	if len(data) > binarySniffLen {
+		data = data[:binarySniffLen]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// SplitLines cuts data into lines that keep their "\n". Only the last
+// line can lack it.
+func SplitLines(data []byte) []string {
+	text := string(data)
+	var lines []string
+	for len(text) > 0 {
+		i := strings.IndexByte(text, '\n')
+		if i == -1 {
+			lines = append(lines, text)
+			break
+		}
+		lines = append(lines, text[:i+1])
+		text = text[i+1:]
+	}
+	return lines
+}
+
+// intern maps every distinct line, as seen through key, to a small
+// integer so the algorithms compare ints instead of strings.
+func intern(a, b []string, key func(string) string) ([]int, []int) {
+	ids := make(map[string]int, len(a)+len(b))
+	convert := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			k := key(line)
+			id, ok := ids[k]
+			if !ok {
+				id = len(ids)
+				ids[k] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	return convert(a), convert(b)
+}
+
+// script turns per-line change marks into an edit script, putting
+// the deletions of a change before its insertions.
+func script(changedA, changedB []bool) []Edit {
+	var edits []Edit
+	i, j := 0, 0
+	for i < len(changedA) || j < len(changedB) {
+		switch {
+		case i < len(changedA) && changedA[i]:
+			edits = append(edits, Edit{Op: Delete, A: i, B: j})
+			i++
+		case j < len(changedB) && changedB[j]:
+			edits = append(edits, Edit{Op: Insert, A: i, B: j})
+			j++
+		default:
+			edits = append(edits, Edit{Op: Equal, A: i, B: j})
+			i++
+			j++
+		}
+	}
+	return edits
+}
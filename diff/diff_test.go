@@ -0,0 +1,149 @@
+package diff
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// apply rebuilds both files from an edit script.
+func apply(t *testing.T, a, b []string, edits []Edit) ([]string, []string) {
+	var gotA, gotB []string
+	for _, e := range edits {
+		switch e.Op {
+		case Equal:
+			assert.Equal(t, a[e.A], b[e.B])
+			gotA = append(gotA, a[e.A])
+			gotB = append(gotB, b[e.B])
+		case Delete:
+			gotA = append(gotA, a[e.A])
+		case Insert:
+			gotB = append(gotB, b[e.B])
+		}
+	}
+	return gotA, gotB
+}
+
+func TestMyersScriptRebuildsBothFiles(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, r.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a'+r.Intn(4))) + "\n"
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := random(), random()
+		gotA, gotB := apply(t, a, b, Myers(a, b))
+		assert.Equal(t, len(a), len(gotA))
+		assert.Equal(t, len(b), len(gotB))
+		if t.Failed() {
+			t.Fatalf("bad script for %q -> %q", a, b)
+		}
+	}
+}
+
+func TestMyersIndentHeuristic(t *testing.T) {
+	a := []string{"f\n", "  y\n"}
+	b := []string{"f\n", "}\n", "  x\n", "f\n", "f\n", "  y\n"}
+
+	var ops []Op
+	for _, e := range Myers(a, b) {
+		ops = append(ops, e.Op)
+	}
+	// git puts the insertion before the first f, not after it
+	assert.Equal(t, []Op{Insert, Insert, Insert, Insert, Equal, Equal}, ops)
+}
+
+// opsOf renders an edit script as its prefixes, e.g. "-+ ".
+func opsOf(edits []Edit) string {
+	var ops []byte
+	for _, e := range edits {
+		ops = append(ops, byte(e.Op))
+	}
+	return string(ops)
+}
+
+func TestAlgorithmsOnSwappedFunctions(t *testing.T) {
+	a := SplitLines([]byte("void a()\n{\n  x;\n}\n\nvoid b()\n{\n  y;\n}\n"))
+	b := SplitLines([]byte("void b()\n{\n  y;\n}\n\nvoid a()\n{\n  x;\n}\n"))
+
+	// Myers pairs up the braces, the others move a() as a block
+	assert.Equal(t, "-+ -+  -+ -+ ", opsOf(Myers(a, b)))
+	assert.Equal(t, "-----    +++++", opsOf(Patience(a, b)))
+	assert.Equal(t, "-----    +++++", opsOf(Histogram(a, b)))
+}
+
+func TestRandomScriptsForEveryAlgorithm(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for _, algorithm := range []string{MINIMAL, PATIENCE, HISTOGRAM} {
+		for i := 0; i < 500; i++ {
+			a, b := make([]string, r.Intn(20)), make([]string, r.Intn(20))
+			for j := range a {
+				a[j] = string(rune('a'+r.Intn(5))) + "\n"
+			}
+			for j := range b {
+				b[j] = string(rune('a'+r.Intn(5))) + "\n"
+			}
+			gotA, gotB := apply(t, a, b, Lines(a, b, Options{Algorithm: algorithm}))
+			assert.Equal(t, len(a), len(gotA), algorithm)
+			assert.Equal(t, len(b), len(gotB), algorithm)
+		}
+	}
+}
+
+func TestWhitespaceOptions(t *testing.T) {
+	a := []string{"a b\n", "c\n"}
+	b := []string{"a  b \n", "c\n"}
+	assert.Equal(t, "-+ ", opsOf(Lines(a, b, Options{})))
+	assert.Equal(t, "  ", opsOf(Lines(a, b, Options{IgnoreSpaceChange: true})))
+	assert.Equal(t, "  ", opsOf(Lines(a, b, Options{IgnoreAllSpace: true})))
+
+	// -b still sees whitespace appearing inside a word
+	b = []string{"ab\n", "c\n"}
+	assert.Equal(t, "-+ ", opsOf(Lines(a, b, Options{IgnoreSpaceChange: true})))
+	assert.Equal(t, "  ", opsOf(Lines(a, b, Options{IgnoreAllSpace: true})))
+}
+
+func TestIgnoreBlankLinesDropsBlankHunks(t *testing.T) {
+	a := SplitLines([]byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n"))
+	b := SplitLines([]byte("1\n\n2\n3\n4\n5\n6\n7\n8\nnine\n"))
+	opts := Options{IgnoreBlankLines: true}
+	edits := Lines(a, b, opts)
+
+	assert.Len(t, Hunks(a, b, edits, 3, Options{}), 2)
+	hunks := Hunks(a, b, edits, 3, opts)
+	assert.Len(t, hunks, 1)
+	assert.Equal(t, 5, hunks[0].S1)
+}
+
+func TestWriteUnified(t *testing.T) {
+	a := SplitLines([]byte("func main() {\n1\n2\n3\n4\n5\n6\n7\n8\n9\nend"))
+	b := SplitLines([]byte("func main() {\n1\n2\nthree\n4\n5\n6\n7\n8\n9\nend\n"))
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteUnified(&out, a, b, Myers(a, b), 1, Options{}))
+	assert.Equal(t, "@@ -3,3 +3,3 @@ func main() {\n 2\n-3\n+three\n 4\n"+
+		"@@ -10,2 +10,2 @@ func main() {\n 9\n-end\n\\ No newline at end of file\n+end\n", out.String())
+
+	// with more context the two changes share a hunk
+	out.Reset()
+	assert.NoError(t, WriteUnified(&out, a, b, Myers(a, b), 3, Options{}))
+	assert.Contains(t, out.String(), "@@ -1,11 +1,11 @@\n")
+}
+
+func TestWriteUnifiedEmptySide(t *testing.T) {
+	b := SplitLines([]byte("x\n"))
+	var out bytes.Buffer
+	assert.NoError(t, WriteUnified(&out, nil, b, Myers(nil, b), 3, Options{}))
+	assert.Equal(t, "@@ -0,0 +1 @@\n+x\n", out.String())
+}
+
+func TestIsBinary(t *testing.T) {
+	assert.False(t, IsBinary([]byte("plain text\n")))
+	assert.True(t, IsBinary([]byte("a\x00b")))
+	assert.False(t, IsBinary(append(bytes.Repeat([]byte("a"), binarySniffLen), 0)))
+}
@@ -0,0 +1,121 @@
+package diff
+
+import "math"
+
+// histogramMaxChain is how often a line may occur in a before it is
+// too common to anchor a histogram match.
+const histogramMaxChain = 64
+
+// histogramRecord collects the occurrences of one line in a: first is
+// its first position, later ones follow through next.
+type histogramRecord struct {
+	first, cnt int
+}
+
+// region is a run of common lines, a[begin1:end1+1] == b[begin2:end2+1].
+type region struct {
+	begin1, end1, begin2, end2 int
+}
+
+// histogramMarks marks changed lines with histogram diff, a variant of
+// patience diff that anchors on the longest common run containing the
+// least frequent lines instead of only on unique ones.
+func histogramMarks(a, b []int, changedA, changedB []bool) {
+	for {
+		if len(a) == 0 || len(b) == 0 {
+			markAll(changedA)
+			markAll(changedB)
+			return
+		}
+		lcs, found, fallback := histogramLCS(a, b)
+		if fallback {
+			myersMarks(a, b, changedA, changedB, false)
+			return
+		}
+		if !found {
+			markAll(changedA)
+			markAll(changedB)
+			return
+		}
+		histogramMarks(a[:lcs.begin1], b[:lcs.begin2], changedA[:lcs.begin1], changedB[:lcs.begin2])
+		a, changedA = a[lcs.end1+1:], changedA[lcs.end1+1:]
+		b, changedB = b[lcs.end2+1:], changedB[lcs.end2+1:]
+	}
+}
+
+// histogramLCS finds the common run of a and b whose rarest line is
+// rarest in a, preferring longer runs. fallback is set when every
+// common line is too frequent to be used.
+func histogramLCS(a, b []int) (region, bool, bool) {
+	records := make(map[int]*histogramRecord)
+	lineRecord := make([]*histogramRecord, len(a))
+	next := make([]int, len(a))
+	for ptr := len(a) - 1; ptr >= 0; ptr-- {
+		rec, ok := records[a[ptr]]
+		if !ok {
+			rec = &histogramRecord{first: ptr}
+			records[a[ptr]] = rec
+			next[ptr] = -1
+		} else {
+			next[ptr] = rec.first
+			rec.first = ptr
+		}
+		rec.cnt = min(rec.cnt+1, math.MaxInt32)
+		lineRecord[ptr] = rec
+	}
+
+	var lcs region
+	found, hasCommon := false, false
+	cnt := histogramMaxChain + 1
+	for bPtr := 0; bPtr < len(b); {
+		bNext := bPtr + 1
+		rec := records[b[bPtr]]
+		if rec != nil {
+			hasCommon = true
+		}
+		if rec != nil && rec.cnt <= cnt {
+			for as := rec.first; ; {
+				np := next[as]
+				bs, ae, be, rc := bPtr, as, bPtr, rec.cnt
+				for 0 < as && 0 < bs && a[as-1] == b[bs-1] {
+					as--
+					bs--
+					if rc > 1 {
+						rc = min(rc, lineRecord[as].cnt)
+					}
+				}
+				for ae < len(a)-1 && be < len(b)-1 && a[ae+1] == b[be+1] {
+					ae++
+					be++
+					if rc > 1 {
+						rc = min(rc, lineRecord[ae].cnt)
+					}
+				}
+				if bNext <= be {
+					bNext = be + 1
+				}
+				if lcs.end1-lcs.begin1 < ae-as || rc < cnt {
+					lcs = region{begin1: as, end1: ae, begin2: bs, end2: be}
+					found = true
+					cnt = rc
+				}
+
+				// continue with the next occurrence past this run
+				for np != -1 && np <= ae {
+					np = next[np]
+				}
+				if np == -1 {
+					break
+				}
+				as = np
+			}
+		}
+		bPtr = bNext
+	}
+	return lcs, found, hasCommon && cnt > histogramMaxChain
+}
+
+// Histogram diffs a and b with the histogram algorithm.
+func Histogram(a, b []string) []Edit {
+	return Lines(a, b, Options{Algorithm: HISTOGRAM})
+}
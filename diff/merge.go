@@ -0,0 +1,248 @@
+package diff
+
+import "strings"
+
+// Conflict styles, as named by merge.conflictStyle.
+const (
+	STYLE_MERGE = "merge" // ours and theirs
+	STYLE_DIFF3 = "diff3" // ours, the base and theirs
+)
+
+// MARKER_SIZE is the length of the <<<<<<<, ||||||| , ======= and
+// >>>>>>> conflict markers.
+const MARKER_SIZE = 7
+
+// MergeOptions picks how lines are compared and how conflicts are
+// written. The labels follow the markers of their side.
+type MergeOptions struct {
+	Options
+	Style      string // STYLE_MERGE when empty
+	MarkerSize int    // MARKER_SIZE when 0
+	Base       string
+	Ours       string
+	Theirs     string
+}
+
+// what a region of the merge takes, as in xdiff's xdmerge_t
+const (
+	takeConflict = 0
+	takeOurs     = 1
+	takeTheirs   = 2
+	takeSame     = 4 // both sides made the same change
+)
+
+// mergeRegion is a stretch of the merge: base[i0:i0+chg0] became
+// ours[i1:i1+chg1] on one side and theirs[i2:i2+chg2] on the other.
+type mergeRegion struct {
+	mode     int
+	i0, chg0 int
+	i1, chg1 int
+	i2, chg2 int
+}
+
+// appendRegion adds r to the regions, joining it to the last one when
+// the two touch on either side. Joined regions of different sides
+// conflict.
+func appendRegion(regions []mergeRegion, r mergeRegion) []mergeRegion {
+	if n := len(regions); n > 0 {
+		m := &regions[n-1]
+		if r.i1 <= m.i1+m.chg1 || r.i2 <= m.i2+m.chg2 {
+			if r.mode != m.mode {
+				m.mode = takeConflict
+			}
+			m.chg0 = r.i0 + r.chg0 - m.i0
+			m.chg1 = r.i1 + r.chg1 - m.i1
+			m.chg2 = r.i2 + r.chg2 - m.i2
+			return regions
+		}
+	}
+	return append(regions, r)
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge combines the changes from base to ours and from base to
+// theirs, the way git's xdiff merges files. Changes that overlap or
+// touch conflict, unless they are the same; conflicts are narrowed to
+// the lines where ours and theirs differ, and conflicts at most three
+// lines apart are joined. With STYLE_DIFF3 conflicts are not narrowed
+// and also show the base. Merge returns the merged lines and the
+// number of conflicts among them.
+func Merge(base, ours, theirs []string, opts MergeOptions) ([]string, int) {
+	// like git, merges slide changes down rather than guess indents
+	opts.NoIndentHeuristic = true
+	ch1 := changes(Lines(base, ours, opts.Options))
+	ch2 := changes(Lines(base, theirs, opts.Options))
+	if len(ch1) == 0 {
+		return theirs, 0
+	}
+	if len(ch2) == 0 {
+		return ours, 0
+	}
+
+	var regions []mergeRegion
+	i, j := 0, 0
+	for i < len(ch1) && j < len(ch2) {
+		x, y := ch1[i], ch2[j]
+		if x.i1+x.del < y.i1 {
+			regions = appendRegion(regions, mergeRegion{takeOurs, x.i1, x.del, x.i2, x.ins, y.i2 - y.i1 + x.i1, x.del})
+			i++
+			continue
+		}
+		if y.i1+y.del < x.i1 {
+			regions = appendRegion(regions, mergeRegion{takeTheirs, y.i1, y.del, x.i2 - x.i1 + y.i1, y.del, y.i2, y.ins})
+			j++
+			continue
+		}
+		if x.i1 != y.i1 || x.del != y.del || !equalLines(ours[x.i2:x.i2+x.ins], theirs[y.i2:y.i2+y.ins]) {
+			// cover both changes, on every side
+			off := x.i1 - y.i1
+			ffo := off + x.del - y.del
+			i0, i1, i2 := x.i1, x.i2, y.i2
+			if off > 0 {
+				i0 -= off
+				i1 -= off
+			} else {
+				i2 += off
+			}
+			chg0 := x.i1 + x.del - i0
+			chg1 := x.i2 + x.ins - i1
+			chg2 := y.i2 + y.ins - i2
+			if ffo < 0 {
+				chg0 -= ffo
+				chg1 -= ffo
+			} else {
+				chg2 += ffo
+			}
+			regions = appendRegion(regions, mergeRegion{takeConflict, i0, chg0, i1, chg1, i2, chg2})
+		}
+		end1, end2 := x.i1+x.del, y.i1+y.del
+		if end1 >= end2 {
+			j++
+		}
+		if end2 >= end1 {
+			i++
+		}
+	}
+	for ; i < len(ch1); i++ {
+		x := ch1[i]
+		regions = appendRegion(regions, mergeRegion{takeOurs, x.i1, x.del, x.i2, x.ins, x.i1 + len(theirs) - len(base), x.del})
+	}
+	for ; j < len(ch2); j++ {
+		y := ch2[j]
+		regions = appendRegion(regions, mergeRegion{takeTheirs, y.i1, y.del, y.i1 + len(ours) - len(base), y.del, y.i2, y.ins})
+	}
+
+	if opts.Style != STYLE_DIFF3 {
+		regions = refineConflicts(regions, ours, theirs, opts.Options)
+		regions = joinConflicts(regions)
+	}
+	return writeMerge(regions, base, ours, theirs, opts)
+}
+
+// refineConflicts narrows every conflict to the lines where ours and
+// theirs differ, splitting it where they agree.
+func refineConflicts(regions []mergeRegion, ours, theirs []string, opts Options) []mergeRegion {
+	var out []mergeRegion
+	for _, m := range regions {
+		if m.mode != takeConflict || m.chg1 == 0 || m.chg2 == 0 {
+			out = append(out, m)
+			continue
+		}
+		sub := changes(Lines(ours[m.i1:m.i1+m.chg1], theirs[m.i2:m.i2+m.chg2], opts))
+		if len(sub) == 0 {
+			m.mode = takeSame
+			out = append(out, m)
+			continue
+		}
+		for _, c := range sub {
+			out = append(out, mergeRegion{takeConflict, m.i0, m.chg0, m.i1 + c.i1, c.del, m.i2 + c.i2, c.ins})
+		}
+	}
+	return out
+}
+
+// joinConflicts makes one conflict of two separated by at most three
+// lines, which then show on both sides of the conflict.
+func joinConflicts(regions []mergeRegion) []mergeRegion {
+	var out []mergeRegion
+	for _, m := range regions {
+		if n := len(out); n > 0 {
+			last := &out[n-1]
+			if last.mode == takeConflict && m.mode == takeConflict && m.i1-(last.i1+last.chg1) <= 3 {
+				last.chg1 = m.i1 + m.chg1 - last.i1
+				last.chg2 = m.i2 + m.chg2 - last.i2
+				continue
+			}
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// writeMerge lays out the merge: ours, except where the regions take
+// theirs or mark a conflict.
+func writeMerge(regions []mergeRegion, base, ours, theirs []string, opts MergeOptions) ([]string, int) {
+	var out []string
+	// copy adds lines, ending the last one if it lacks a newline so a
+	// marker can follow
+	copyLines := func(lines []string, endLine bool) {
+		out = append(out, lines...)
+		if n := len(out); endLine && len(lines) > 0 && !strings.HasSuffix(out[n-1], "\n") {
+			out[n-1] += "\n"
+		}
+	}
+	marker := func(c byte, label string) string {
+		size := opts.MarkerSize
+		if size == 0 {
+			size = MARKER_SIZE
+		}
+		line := strings.Repeat(string(c), size)
+		if label != "" {
+			line += " " + label
+		}
+		return line + "\n"
+	}
+
+	conflicts := 0
+	i := 0
+	for _, m := range regions {
+		switch {
+		case m.mode == takeConflict:
+			conflicts++
+			copyLines(ours[i:m.i1], false)
+			out = append(out, marker('<', opts.Ours))
+			copyLines(ours[m.i1:m.i1+m.chg1], true)
+			if opts.Style == STYLE_DIFF3 {
+				out = append(out, marker('|', opts.Base))
+				copyLines(base[m.i0:m.i0+m.chg0], true)
+			}
+			out = append(out, marker('=', ""))
+			copyLines(theirs[m.i2:m.i2+m.chg2], true)
+			out = append(out, marker('>', opts.Theirs))
+		case m.mode&(takeOurs|takeTheirs) != 0:
+			copyLines(ours[i:m.i1], false)
+			if m.mode&takeOurs != 0 {
+				copyLines(ours[m.i1:m.i1+m.chg1], false)
+			}
+			if m.mode&takeTheirs != 0 {
+				copyLines(theirs[m.i2:m.i2+m.chg2], false)
+			}
+		default:
+			continue
+		}
+		i = m.i1 + m.chg1
+	}
+	copyLines(ours[i:], false)
+	return out, conflicts
+}
@@ -0,0 +1,43 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	lines := func(s string) []string { return SplitLines([]byte(s)) }
+	base := lines("a\nb\nc\nd\ne\nf\ng\n")
+	opts := MergeOptions{Base: "1234567", Ours: "HEAD", Theirs: "topic"}
+	for _, tc := range []struct {
+		name          string
+		ours, theirs  string
+		style         string
+		want          string
+		wantConflicts int
+	}{
+		{"apart", "a\nB\nc\nd\ne\nf\ng\n", "a\nb\nc\nd\ne\nF\ng\n", "",
+			"a\nB\nc\nd\ne\nF\ng\n", 0},
+		{"same change", "a\nB\nc\nd\ne\nf\ng\n", "a\nB\nc\nd\ne\nF\ng\n", "",
+			"a\nB\nc\nd\ne\nF\ng\n", 0},
+		{"conflict", "a\nb1\nc\nd\ne\nf\ng\n", "a\nb2\nc\nd\ne\nF\ng\n", "",
+			"a\n<<<<<<< HEAD\nb1\n=======\nb2\n>>>>>>> topic\nc\nd\ne\nF\ng\n", 1},
+		{"diff3", "a\nb1\nc\nd\ne\nf\ng\n", "a\nb2\nc\nd\ne\nF\ng\n", STYLE_DIFF3,
+			"a\n<<<<<<< HEAD\nb1\n||||||| 1234567\nb\n=======\nb2\n>>>>>>> topic\nc\nd\ne\nF\ng\n", 1},
+		{"joined", "a\nX\nc\nd\nY\nf\ng\n", "a\nX2\nc\nd\nY2\nf\ng\n", "",
+			"a\n<<<<<<< HEAD\nX\nc\nd\nY\n=======\nX2\nc\nd\nY2\n>>>>>>> topic\nf\ng\n", 1},
+		{"no newline", "a\nb\nc\nd\ne\nf\ng1", "a\nb\nc\nd\ne\nf\ng2", "",
+			"a\nb\nc\nd\ne\nf\n<<<<<<< HEAD\ng1\n=======\ng2\n>>>>>>> topic\n", 1},
+	} {
+		opts.Style = tc.style
+		got, conflicts := Merge(base, lines(tc.ours), lines(tc.theirs), opts)
+		assert.Equal(t, tc.want, strings.Join(got, ""), tc.name)
+		assert.Equal(t, tc.wantConflicts, conflicts, tc.name)
+	}
+
+	opts.Style, opts.MarkerSize = "", 9
+	got, _ := Merge(lines("a\n"), lines("b\n"), lines("c\n"), opts)
+	assert.Equal(t, "<<<<<<<<< HEAD\nb\n=========\nc\n>>>>>>>>> topic\n", strings.Join(got, ""))
+}
@@ -0,0 +1,346 @@
+package diff
+
+import "math"
+
+// Tuning of the Myers search, the same values git's xdiff uses. Past
+// maxCostMin edits on large inputs the search settles for a good split
+// instead of the best one, so huge diffs finish in reasonable time.
+const (
+	maxCostMin   = 256
+	heurMinCost  = 256
+	snakeCount   = 20
+	heurK        = 4
+	maxEqLimit   = 1024
+	simscanLimit = 100
+	kpdisRun     = 4
+)
+
+// Myers computes an edit script from a to b with the linear space
+// refinement of Myers' O(ND) algorithm: split both files where an
+// optimal path crosses the middle diagonal, then recurse on the halves.
+func Myers(a, b []string) []Edit {
+	return Lines(a, b, Options{Algorithm: MYERS})
+}
+
+// myersMarks marks the lines Myers finds changed. Lines without a
+// match on the other side are marked up front and left out of the
+// search, as are runs of lines that match too often to be useful,
+// unless needMin asks for the shortest script whatever it costs.
+func myersMarks(a, b []int, changedA, changedB []bool, needMin bool) {
+	start, endA, endB := trimEnds(a, b)
+	countA, countB := occurrences(a), occurrences(b)
+	m := &myers{}
+	m.a, m.indexA = discard(a, start, endA, countB, changedA, needMin)
+	m.b, m.indexB = discard(b, start, endB, countA, changedB, needMin)
+	m.changedA, m.changedB = changedA, changedB
+
+	diags := len(m.a) + len(m.b) + 3
+	m.vf = make([]int, 2*diags+2)
+	m.vb = make([]int, 2*diags+2)
+	m.offset = len(m.b) + 1
+	m.maxCost = max(bogoSqrt(diags), maxCostMin)
+	m.compare(0, len(m.a), 0, len(m.b), needMin)
+}
+
+// trimEnds finds the common prefix and suffix, returning where the
+// differing middle starts and where it ends in each file.
+func trimEnds(a, b []int) (int, int, int) {
+	limit := min(len(a), len(b))
+	start := 0
+	for start < limit && a[start] == b[start] {
+		start++
+	}
+	end := 0
+	for end < limit-start && a[len(a)-1-end] == b[len(b)-1-end] {
+		end++
+	}
+	return start, len(a) - end, len(b) - end
+}
+
+func occurrences(lines []int) map[int]int {
+	count := make(map[int]int)
+	for _, line := range lines {
+		count[line]++
+	}
+	return count
+}
+
+// bogoSqrt is xdiff's cheap power of two approximation of a square root.
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+	return i
+}
+
+// discard picks the lines of lines[start:end] worth searching, given
+// how often each occurs in the other file, and marks the rest changed.
+// It returns the kept lines and their positions.
+func discard(lines []int, start, end int, other map[int]int, changed []bool, needMin bool) ([]int, []int) {
+	limit := min(bogoSqrt(len(lines)), maxEqLimit)
+	dis := make([]byte, len(lines))
+	for i := start; i < end; i++ {
+		switch n := other[lines[i]]; {
+		case n == 0:
+			dis[i] = 0
+		case n >= limit && !needMin:
+			dis[i] = 2
+		default:
+			dis[i] = 1
+		}
+	}
+
+	var kept, index []int
+	for i := start; i < end; i++ {
+		if dis[i] == 1 || (dis[i] == 2 && !cleanMultiMatch(dis, i, start, end-1)) {
+			kept = append(kept, lines[i])
+			index = append(index, i)
+			continue
+		}
+		changed[i] = true
+	}
+	return kept, index
+}
+
+// cleanMultiMatch reports whether the frequent line at i sits among
+// mostly unmatched lines, in which case matching it would only
+// scatter the diff.
+func cleanMultiMatch(dis []byte, i, s, e int) bool {
+	s = max(s, i-simscanLimit)
+	e = min(e, i+simscanLimit)
+
+	unmatched, multi := 0, 1
+	for r := 1; i-r >= s; r++ {
+		if dis[i-r] == 0 {
+			unmatched++
+		} else if dis[i-r] == 2 {
+			multi++
+		} else {
+			break
+		}
+	}
+	if unmatched == 0 {
+		return false
+	}
+	unmatchedAfter, multiAfter := 0, 1
+	for r := 1; i+r <= e; r++ {
+		if dis[i+r] == 0 {
+			unmatchedAfter++
+		} else if dis[i+r] == 2 {
+			multiAfter++
+		} else {
+			break
+		}
+	}
+	if unmatchedAfter == 0 {
+		return false
+	}
+	unmatched += unmatchedAfter
+	multi += multiAfter
+	return multi*kpdisRun < multi+unmatched
+}
+
+type myers struct {
+	a, b               []int
+	indexA, indexB     []int // positions of a and b in the full files
+	changedA, changedB []bool
+	vf, vb             []int
+	offset             int
+	maxCost            int
+}
+
+func (m *myers) compare(aLo, aHi, bLo, bHi int, needMin bool) {
+	for aLo < aHi && bLo < bHi && m.a[aLo] == m.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && m.a[aHi-1] == m.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	switch {
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			m.changedB[m.indexB[j]] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			m.changedA[m.indexA[i]] = true
+		}
+	default:
+		x, y, minLo, minHi := m.split(aLo, aHi, bLo, bHi, needMin)
+		m.compare(aLo, x, bLo, y, minLo)
+		m.compare(x, aHi, y, bHi, minHi)
+	}
+}
+
+// split finds a point (x, y) on a good edit path through the box and
+// whether each half still needs a minimal search. Diagonals are
+// numbered x-y and stored at offset in vf and vb.
+func (m *myers) split(aLo, aHi, bLo, bHi int, needMin bool) (int, int, bool, bool) {
+	vf, vb, off := m.vf, m.vb, m.offset
+	dmin, dmax := aLo-bHi, aHi-bLo
+	fmid, bmid := aLo-bLo, aHi-bHi
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+
+	vf[off+fmid] = aLo
+	vb[off+bmid] = aHi
+
+	for cost := 1; ; cost++ {
+		gotSnake := false
+
+		if fmin > dmin {
+			fmin--
+			vf[off+fmin-1] = -1
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			vf[off+fmax+1] = -1
+		} else {
+			fmax--
+		}
+		for d := fmax; d >= fmin; d -= 2 {
+			var x int
+			if vf[off+d-1] >= vf[off+d+1] {
+				x = vf[off+d-1] + 1
+			} else {
+				x = vf[off+d+1]
+			}
+			prev := x
+			y := x - d
+			for x < aHi && y < bHi && m.a[x] == m.b[y] {
+				x++
+				y++
+			}
+			if x-prev > snakeCount {
+				gotSnake = true
+			}
+			vf[off+d] = x
+			if odd && bmin <= d && d <= bmax && vb[off+d] <= x {
+				return x, y, true, true
+			}
+		}
+
+		if bmin > dmin {
+			bmin--
+			vb[off+bmin-1] = math.MaxInt
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			vb[off+bmax+1] = math.MaxInt
+		} else {
+			bmax--
+		}
+		for d := bmax; d >= bmin; d -= 2 {
+			var x int
+			if vb[off+d-1] < vb[off+d+1] {
+				x = vb[off+d-1]
+			} else {
+				x = vb[off+d+1] - 1
+			}
+			prev := x
+			y := x - d
+			for x > aLo && y > bLo && m.a[x-1] == m.b[y-1] {
+				x--
+				y--
+			}
+			if prev-x > snakeCount {
+				gotSnake = true
+			}
+			vb[off+d] = x
+			if !odd && fmin <= d && d <= fmax && x <= vf[off+d] {
+				return x, y, true, true
+			}
+		}
+
+		if needMin {
+			continue
+		}
+
+		// a long snake far along a path is a good enough split
+		if gotSnake && cost > heurMinCost {
+			best, bx, by := 0, 0, 0
+			for d := fmax; d >= fmin; d -= 2 {
+				dd := abs(d - fmid)
+				x := vf[off+d]
+				y := x - d
+				v := (x - aLo) + (y - bLo) - dd
+				if v > heurK*cost && v > best &&
+					aLo+snakeCount <= x && x < aHi && bLo+snakeCount <= y && y < bHi {
+					for k := 1; m.a[x-k] == m.b[y-k]; k++ {
+						if k == snakeCount {
+							best, bx, by = v, x, y
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return bx, by, true, false
+			}
+
+			for d := bmax; d >= bmin; d -= 2 {
+				dd := abs(d - bmid)
+				x := vb[off+d]
+				y := x - d
+				v := (aHi - x) + (bHi - y) - dd
+				if v > heurK*cost && v > best &&
+					aLo < x && x <= aHi-snakeCount && bLo < y && y <= bHi-snakeCount {
+					for k := 0; m.a[x+k] == m.b[y+k]; k++ {
+						if k == snakeCount-1 {
+							best, bx, by = v, x, y
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return bx, by, false, true
+			}
+		}
+
+		// too expensive: take the furthest reaching path of either side
+		if cost >= m.maxCost {
+			fbest, fx := -1, -1
+			for d := fmax; d >= fmin; d -= 2 {
+				x := min(vf[off+d], aHi)
+				y := x - d
+				if bHi < y {
+					x, y = bHi+d, bHi
+				}
+				if fbest < x+y {
+					fbest, fx = x+y, x
+				}
+			}
+			bbest, bx := math.MaxInt, math.MaxInt
+			for d := bmax; d >= bmin; d -= 2 {
+				x := max(aLo, vb[off+d])
+				y := x - d
+				if y < bLo {
+					x, y = bLo+d, bLo
+				}
+				if x+y < bbest {
+					bbest, bx = x+y, x
+				}
+			}
+			if (aHi+bHi)-bbest < fbest-(aLo+bLo) {
+				return fx, fbest - fx, true, false
+			}
+			return bx, bbest - bx, false, true
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
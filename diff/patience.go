@@ -0,0 +1,123 @@
+package diff
+
+import "sort"
+
+// patienceEntry is a line of a with the position of its match in b.
+// line2 is -1 until a match is seen and nonUnique once a line turns
+// up twice on either side.
+type patienceEntry struct {
+	line1, line2 int
+	prev, next   *patienceEntry
+}
+
+const nonUnique = -2
+
+// patienceMarks marks changed lines with patience diff: lines that
+// occur exactly once in both files anchor the longest common
+// subsequence, and the gaps between anchors are diffed recursively.
+// Gaps without unique lines fall back to Myers.
+func patienceMarks(a, b []int, changedA, changedB []bool) {
+	if len(a) == 0 || len(b) == 0 {
+		markAll(changedA)
+		markAll(changedB)
+		return
+	}
+
+	entries := make(map[int]*patienceEntry)
+	var order []*patienceEntry
+	for i, line := range a {
+		if e, ok := entries[line]; ok {
+			e.line2 = nonUnique
+			continue
+		}
+		e := &patienceEntry{line1: i, line2: -1}
+		entries[line] = e
+		order = append(order, e)
+	}
+	hasMatches := false
+	for j, line := range b {
+		e, ok := entries[line]
+		if !ok {
+			continue
+		}
+		hasMatches = true
+		if e.line2 != -1 {
+			e.line2 = nonUnique
+		} else {
+			e.line2 = j
+		}
+	}
+	if !hasMatches {
+		markAll(changedA)
+		markAll(changedB)
+		return
+	}
+
+	// longest increasing run of line2, keeping for every length the
+	// sequence that ends lowest
+	var seq []*patienceEntry
+	for _, e := range order {
+		if e.line2 < 0 {
+			continue
+		}
+		i := sort.Search(len(seq), func(k int) bool { return seq[k].line2 > e.line2 })
+		e.prev = nil
+		if i > 0 {
+			e.prev = seq[i-1]
+		}
+		if i == len(seq) {
+			seq = append(seq, e)
+		} else {
+			seq[i] = e
+		}
+	}
+	if len(seq) == 0 {
+		myersMarks(a, b, changedA, changedB, false)
+		return
+	}
+	first := seq[len(seq)-1]
+	first.next = nil
+	for first.prev != nil {
+		first.prev.next = first
+		first = first.prev
+	}
+
+	line1, line2 := 0, 0
+	for {
+		// grow the common lines around the anchor before recursing
+		next1, next2 := len(a), len(b)
+		if first != nil {
+			next1, next2 = first.line1, first.line2
+			for next1 > line1 && next2 > line2 && a[next1-1] == b[next2-1] {
+				next1--
+				next2--
+			}
+		}
+		for line1 < next1 && line2 < next2 && a[line1] == b[line2] {
+			line1++
+			line2++
+		}
+		if next1 > line1 || next2 > line2 {
+			patienceMarks(a[line1:next1], b[line2:next2], changedA[line1:next1], changedB[line2:next2])
+		}
+		if first == nil {
+			return
+		}
+		for first.next != nil && first.next.line1 == first.line1+1 && first.next.line2 == first.line2+1 {
+			first = first.next
+		}
+		line1, line2 = first.line1+1, first.line2+1
+		first = first.next
+	}
+}
+
+func markAll(changed []bool) {
+	for i := range changed {
+		changed[i] = true
+	}
+}
+
+// Patience diffs a and b with the patience algorithm.
+func Patience(a, b []string) []Edit {
+	return Lines(a, b, Options{Algorithm: PATIENCE})
+}
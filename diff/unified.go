@@ -0,0 +1,199 @@
+package diff
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// change is a run of replaced lines: a[i1:i1+del] became b[i2:i2+ins].
+type change struct {
+	i1, del int
+	i2, ins int
+	ignore  bool // only blank lines, with IgnoreBlankLines
+}
+
+// changes collects the runs of non-equal edits.
+func changes(edits []Edit) []change {
+	var out []change
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			i++
+			continue
+		}
+		c := change{i1: edits[i].A, i2: edits[i].B}
+		for ; i < len(edits) && edits[i].Op != Equal; i++ {
+			if edits[i].Op == Delete {
+				c.del++
+			} else {
+				c.ins++
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// Hunk is one hunk of unified output: a[S1:E1] against b[S2:E2],
+// covering a run of changes.
+type Hunk struct {
+	S1, E1  int
+	S2, E2  int
+	changes []change
+}
+
+// Hunks groups the changes of edits into hunks with context lines
+// of context on each side, merging changes at most 2*context lines
+// apart. With IgnoreBlankLines, changes of blank lines only are
+// dropped unless they sit next to a real change.
+func Hunks(a, b []string, edits []Edit, context int, opts Options) []Hunk {
+	all := changes(edits)
+	if opts.IgnoreBlankLines {
+		for i := range all {
+			all[i].ignore = opts.allBlank(a[all[i].i1:all[i].i1+all[i].del]) &&
+				opts.allBlank(b[all[i].i2:all[i].i2+all[i].ins])
+		}
+	}
+
+	var hunks []Hunk
+	for len(all) > 0 {
+		first, last := hunkExtent(all, context)
+		if first < 0 {
+			break
+		}
+		h := Hunk{changes: all[first : last+1]}
+		start, end := all[first], all[last]
+		h.S1 = max(start.i1-context, 0)
+		h.S2 = max(start.i2-context, 0)
+		tail := min(context, len(a)-(end.i1+end.del), len(b)-(end.i2+end.ins))
+		h.E1 = end.i1 + end.del + tail
+		h.E2 = end.i2 + end.ins + tail
+		hunks = append(hunks, h)
+		all = all[last+1:]
+	}
+	return hunks
+}
+
+func (o Options) allBlank(lines []string) bool {
+	for _, line := range lines {
+		if !o.isBlank(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// hunkExtent finds the first and last change of the next hunk, as
+// git's xdl_get_hunk does, or -1 when only ignorable changes remain.
+func hunkExtent(all []change, context int) (int, int) {
+	maxCommon := 2 * context
+	maxIgnorable := context
+
+	// skip ignorable changes too far before the next change
+	first := 0
+	for i := 0; i < len(all) && all[i].ignore; i++ {
+		if i+1 == len(all) || all[i+1].i1-(all[i].i1+all[i].del) >= maxIgnorable {
+			first = i + 1
+		}
+	}
+	if first == len(all) {
+		return -1, -1
+	}
+
+	last, ignored := first, 0
+	for i := first + 1; i < len(all); i++ {
+		prev, cur := all[i-1], all[i]
+		distance := cur.i1 - (prev.i1 + prev.del)
+		if distance > maxCommon {
+			break
+		}
+		switch {
+		case distance < maxIgnorable && (!cur.ignore || last == i-1):
+			last, ignored = i, 0
+		case distance < maxIgnorable:
+			ignored += cur.ins
+		case last != i-1 && cur.i1+ignored-(all[last].i1+all[last].del) > maxCommon:
+			return first, last
+		case !cur.ignore:
+			last, ignored = i, 0
+		default:
+			ignored += cur.ins
+		}
+	}
+	return first, last
+}
+
+// hunkRange formats one side of a hunk header: "start,count", where
+// a count of one is left out and an empty range starts before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// funcLineLen is how much of a function line git shows in a hunk header.
+const funcLineLen = 80
+
+// funcContext finds the line git's default funcname rule would show
+// for a hunk starting at old line start: the closest earlier line
+// beginning with a letter, "_" or "$".
+func funcContext(a []string, start int) string {
+	for i := start - 1; i >= 0; i-- {
+		line := a[i]
+		if line == "" {
+			continue
+		}
+		c := line[0]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == '$' {
+			if len(line) > funcLineLen {
+				line = line[:funcLineLen]
+			}
+			return strings.TrimRight(line, " \t\r\n")
+		}
+	}
+	return ""
+}
+
+// WriteUnified writes the hunks of edits between a and b. Context
+// lines are taken from b, like git does. Lines missing a final
+// newline get the "\ No newline at end of file" marker.
+func WriteUnified(w io.Writer, a, b []string, edits []Edit, context int, opts Options) error {
+	bw := bufio.NewWriter(w)
+	line := func(op Op, text string) {
+		bw.WriteByte(byte(op))
+		bw.WriteString(text)
+		if !strings.HasSuffix(text, "\n") {
+			bw.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+
+	for _, h := range Hunks(a, b, edits, context, opts) {
+		header := fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.S1, h.E1-h.S1), hunkRange(h.S2, h.E2-h.S2))
+		if fn := funcContext(a, h.S1); fn != "" {
+			header += " " + fn
+		}
+		bw.WriteString(header + "\n")
+
+		s2 := h.S2
+		for _, c := range h.changes {
+			for ; s2 < c.i2; s2++ {
+				line(Equal, b[s2])
+			}
+			for i := c.i1; i < c.i1+c.del; i++ {
+				line(Delete, a[i])
+			}
+			for ; s2 < c.i2+c.ins; s2++ {
+				line(Insert, b[s2])
+			}
+		}
+		for ; s2 < h.E2; s2++ {
+			line(Equal, b[s2])
+		}
+	}
+	return bw.Flush()
+}
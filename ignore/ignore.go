@@ -0,0 +1,237 @@
+package ignore
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitignore(5) semantics: blank lines and "#" comments are skipped, "!"
+// re-includes, a trailing "/" only matches directories, a pattern with a
+// "/" anywhere but the end is anchored to its directory, and "**" spans
+// any number of directories. The last matching pattern decides, and
+// deeper ignore files take precedence over shallower ones.
+
+// PER_DIRECTORY_FILES are read from every directory, later files
+// taking precedence over earlier ones.
+var PER_DIRECTORY_FILES = []string{".gitignore", ".owngitignore"}
+
+// Pattern is one rule from an ignore file.
+type Pattern struct {
+	Source string // file the pattern was read from, as shown to users
+	Line   int
+	Text   string // the line as written
+	Negate bool
+
+	base     string // directory the pattern is relative to, "" for root
+	glob     string
+	dirOnly  bool
+	anchored bool
+}
+
+// ParsePattern parses one line of an ignore file found in directory
+// base (relative to the repository root). It returns nil for blank
+// lines and comments.
+func ParsePattern(line, base, source string, lineNo int) *Pattern {
+	text := strings.TrimSuffix(line, "\r")
+	glob := trimTrailingSpaces(text)
+	if glob == "" || strings.HasPrefix(glob, "#") {
+		return nil
+	}
+
+	p := &Pattern{Source: source, Line: lineNo, Text: text, base: base}
+	if strings.HasPrefix(glob, "!") {
+		p.Negate = true
+		glob = glob[1:]
+	} else if strings.HasPrefix(glob, `\!`) || strings.HasPrefix(glob, `\#`) {
+		glob = glob[1:]
+	}
+	if strings.HasSuffix(glob, "/") {
+		p.dirOnly = true
+		glob = strings.TrimSuffix(glob, "/")
+	}
+	if strings.Contains(glob, "/") {
+		p.anchored = true
+		glob = strings.TrimPrefix(glob, "/")
+	}
+	if glob == "" {
+		return nil
+	}
+	p.glob = strings.ReplaceAll(glob, "[!", "[^")
+	return p
+}
+
+// trimTrailingSpaces drops unescaped trailing spaces.
+func trimTrailingSpaces(s string) string {
+	end := len(s)
+	for end > 0 && s[end-1] == ' ' {
+		if end >= 2 && s[end-2] == '\\' {
+			return s[:end-2] + s[end-1:]
+		}
+		end--
+	}
+	return s[:end]
+}
+
+// Matches reports whether rel (slash separated, relative to the
+// repository root) is matched by p, ignoring negation.
+func (p *Pattern) Matches(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = rel[len(p.base)+1:]
+	}
+	if !p.anchored {
+		ok, _ := path.Match(p.glob, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(p.glob, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, segs []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				// a trailing "/**" matches everything inside, not the directory itself
+				return len(segs) > 0
+			}
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(rest, segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segs[0]); !ok {
+			return false
+		}
+		pattern, segs = pattern[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+// ReadPatterns parses an ignore file living in directory base.
+func ReadPatterns(r io.Reader, base, source string) ([]*Pattern, error) {
+	var patterns []*Pattern
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if p := ParsePattern(scanner.Text(), base, source, lineNo); p != nil {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+// ReadPatternFile is ReadPatterns on a file. A missing file has no patterns.
+func ReadPatternFile(filename, base, source string) ([]*Pattern, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return ReadPatterns(f, base, source)
+}
+
+// Matcher decides which worktree paths are ignored. Per-directory
+// files are read lazily the first time a path below them is matched.
+type Matcher struct {
+	root   string
+	global []*Pattern // core.excludesFile and info/exclude, lowest priority first
+	perDir map[string][]*Pattern
+}
+
+// NewMatcher creates a matcher for the worktree at root using the
+// given global pattern lists, lowest priority first.
+func NewMatcher(root string, global ...[]*Pattern) *Matcher {
+	m := &Matcher{root: root, perDir: make(map[string][]*Pattern)}
+	for _, patterns := range global {
+		m.global = append(m.global, patterns...)
+	}
+	return m
+}
+
+func (m *Matcher) dirPatterns(dir string) ([]*Pattern, error) {
+	if patterns, ok := m.perDir[dir]; ok {
+		return patterns, nil
+	}
+	var patterns []*Pattern
+	for _, name := range PER_DIRECTORY_FILES {
+		base, source := dir, path.Join(dir, name)
+		if dir == "." {
+			base = ""
+		}
+		found, err := ReadPatternFile(filepath.Join(m.root, filepath.FromSlash(source)), base, source)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, found...)
+	}
+	m.perDir[dir] = patterns
+	return patterns, nil
+}
+
+// Match returns the pattern deciding rel, or nil when none matches.
+// A negated result means rel was explicitly re-included. Parent
+// directories are not considered; see Ignored.
+func (m *Matcher) Match(rel string, isDir bool) (*Pattern, error) {
+	for dir := path.Dir(rel); ; dir = path.Dir(dir) {
+		patterns, err := m.dirPatterns(dir)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(patterns) - 1; i >= 0; i-- {
+			if patterns[i].Matches(rel, isDir) {
+				return patterns[i], nil
+			}
+		}
+		if dir == "." {
+			break
+		}
+	}
+	for i := len(m.global) - 1; i >= 0; i-- {
+		if m.global[i].Matches(rel, isDir) {
+			return m.global[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Ignored returns the pattern that makes rel ignored, either directly
+// or through one of its parent directories (which files inside can
+// not re-include). The returned pattern is nil or negated when rel is
+// not ignored.
+func (m *Matcher) Ignored(rel string, isDir bool) (*Pattern, error) {
+	segs := strings.Split(rel, "/")
+	for i := 1; i < len(segs); i++ {
+		p, err := m.Match(strings.Join(segs[:i], "/"), true)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil && !p.Negate {
+			return p, nil
+		}
+	}
+	return m.Match(rel, isDir)
+}
+
+// IsIgnored is Ignored reduced to a yes or no.
+func (m *Matcher) IsIgnored(rel string, isDir bool) (bool, error) {
+	p, err := m.Ignored(rel, isDir)
+	return p != nil && !p.Negate, err
+}
@@ -0,0 +1,76 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatternMatches(t *testing.T) {
+	cases := []struct {
+		pattern, base, path string
+		isDir, want         bool
+	}{
+		{"*.log", "", "a.log", false, true},
+		{"*.log", "", "deep/dir/a.log", false, true},
+		{"*.log", "sub", "a.log", false, false},
+		{"build/", "", "build", true, true},
+		{"build/", "", "build", false, false},
+		{"/root.txt", "", "root.txt", false, true},
+		{"/root.txt", "", "sub/root.txt", false, false},
+		{"doc/*.txt", "", "doc/a.txt", false, true},
+		{"doc/*.txt", "", "doc/x/a.txt", false, false},
+		{"**/deep", "", "deep", true, true},
+		{"**/deep", "", "a/b/deep", false, true},
+		{"a/**/b", "", "a/b", false, true},
+		{"a/**/b", "", "a/x/y/b", false, true},
+		{"abc/**", "", "abc", true, false},
+		{"abc/**", "", "abc/x/y", false, true},
+		{"x", "sub", "sub/x", false, true},
+		{"x", "sub", "subx/x", false, false},
+		{"[!a]*.c", "", "b.c", false, true},
+		{"[!a]*.c", "", "a.c", false, false},
+		{`\#hash`, "", "#hash", false, true},
+		{`trailing\ `, "", "trailing ", false, true},
+	}
+	for _, c := range cases {
+		p := ParsePattern(c.pattern, c.base, ".gitignore", 1)
+		if assert.NotNil(t, p, c.pattern) {
+			assert.Equal(t, c.want, p.Matches(c.path, c.isDir), "%s against %s", c.pattern, c.path)
+		}
+	}
+
+	assert.Nil(t, ParsePattern("# comment", "", "", 1))
+	assert.Nil(t, ParsePattern("   ", "", "", 1))
+}
+
+func TestMatcherPrecedence(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "sub"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, ".gitignore"), []byte("*.log\n!keep.log\nout/\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "sub", ".gitignore"), []byte("!*.log\n"), 0644))
+
+	global, err := ReadPatterns(strings.NewReader("*.tmp\nkeep.log\n"), "", "exclude")
+	assert.NoError(t, err)
+	m := NewMatcher(root, global)
+
+	check := func(rel string, isDir, want bool) {
+		got, err := m.IsIgnored(rel, isDir)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got, rel)
+	}
+	check("a.log", false, true)
+	check("keep.log", false, false) // .gitignore beats the global list
+	check("sub/a.log", false, false)
+	check("x.tmp", false, true)
+	check("out/sub/a.txt", false, true) // excluded parent can't be re-included
+	check("a.txt", false, false)
+
+	p, err := m.Ignored("sub/a.log", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "sub/.gitignore", p.Source)
+	assert.True(t, p.Negate)
+}
@@ -0,0 +1,421 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// Git's index file ("dircache"). Layout, all integers big endian:
+//
+//	header:   "DIRC" version(4) entry count(4)
+//	entries:  sorted by path, then stage
+//	extensions, each: signature(4) size(4) data
+//	trailer:  SHA-1 of everything above
+
+var (
+	ERROR_MALFORMED_INDEX   = fmt.Errorf("malformed index file")
+	ERROR_INDEX_CHECKSUM    = fmt.Errorf("index checksum mismatch")
+	ERROR_UNSUPPORTED_INDEX = fmt.Errorf("unsupported index version")
+)
+
+const (
+	signature      = "DIRC"
+	DefaultVersion = 2
+
+	flagAssumeValid  = 0x8000
+	flagExtended     = 0x4000
+	flagStageMask    = 0x3000
+	flagStageShift   = 12
+	flagNameMask     = 0x0fff
+	flagSkipWorktree = 0x4000 // extended flags, version 3 and up
+	flagIntentToAdd  = 0x2000
+)
+
+// Stat is the file metadata cached in the index so unchanged files
+// can be recognised without reading them.
+type Stat struct {
+	CTime time.Time
+	MTime time.Time
+	Dev   uint32
+	Ino   uint32
+	UID   uint32
+	GID   uint32
+	Size  uint32 // truncated to 32 bits like git
+}
+
+// Entry is one path (at one merge stage) in the index.
+type Entry struct {
+	Stat
+	Mode         uint32
+	Hash         string
+	Stage        int // 0 normally, 1-3 while a merge conflict is unresolved
+	AssumeValid  bool
+	SkipWorktree bool
+	IntentToAdd  bool
+	Path         string
+}
+
+func (e *Entry) extended() bool {
+	return e.SkipWorktree || e.IntentToAdd
+}
+
+type Index struct {
+	Version uint32
+	Entries []Entry
+	// Timestamp is the mtime of the file the index was read from.
+	// Entries modified at or after it may have changed unnoticed.
+	Timestamp time.Time
+}
+
+func New() *Index {
+	return &Index{Version: DefaultVersion}
+}
+
+// Sort orders entries the way git stores them.
+func (idx *Index) Sort() {
+	sort.SliceStable(idx.Entries, func(i, j int) bool {
+		a, b := idx.Entries[i], idx.Entries[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Stage < b.Stage
+	})
+}
+
+// Read parses an index in version 2, 3 or 4 and verifies its checksum.
+func Read(r io.Reader) (*Index, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12+sha1.Size || string(data[:4]) != signature {
+		return nil, ERROR_MALFORMED_INDEX
+	}
+	body, trailer := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	sum := sha1.Sum(body)
+	if !bytes.Equal(sum[:], trailer) {
+		return nil, ERROR_INDEX_CHECKSUM
+	}
+
+	idx := &Index{Version: binary.BigEndian.Uint32(body[4:8])}
+	if idx.Version < 2 || idx.Version > 4 {
+		return nil, fmt.Errorf("%w %d", ERROR_UNSUPPORTED_INDEX, idx.Version)
+	}
+	count := binary.BigEndian.Uint32(body[8:12])
+	idx.Entries = make([]Entry, 0, count)
+
+	pos := 12
+	prevPath := ""
+	for i := uint32(0); i < count; i++ {
+		entry, n, err := decodeEntry(body[pos:], idx.Version, prevPath)
+		if err != nil {
+			return nil, err
+		}
+		idx.Entries = append(idx.Entries, entry)
+		prevPath = entry.Path
+		pos += n
+	}
+
+	// extensions: optional ones (signature starting with A-Z) are
+	// dropped since they describe the index as it was when read
+	for pos < len(body) {
+		if len(body)-pos < 8 {
+			return nil, ERROR_MALFORMED_INDEX
+		}
+		sig := body[pos : pos+4]
+		size := int(binary.BigEndian.Uint32(body[pos+4 : pos+8]))
+		if size < 0 || len(body)-pos-8 < size {
+			return nil, ERROR_MALFORMED_INDEX
+		}
+		if sig[0] < 'A' || sig[0] > 'Z' {
+			return nil, fmt.Errorf("unsupported index extension %q", sig)
+		}
+		pos += 8 + size
+	}
+	return idx, nil
+}
+
+func decodeEntry(data []byte, version uint32, prevPath string) (Entry, int, error) {
+	if len(data) < 62 {
+		return Entry{}, 0, ERROR_MALFORMED_INDEX
+	}
+	u32 := func(off int) uint32 { return binary.BigEndian.Uint32(data[off:]) }
+
+	e := Entry{
+		Stat: Stat{
+			CTime: fromUnix(u32(0), u32(4)),
+			MTime: fromUnix(u32(8), u32(12)),
+			Dev:   u32(16),
+			Ino:   u32(20),
+			UID:   u32(28),
+			GID:   u32(32),
+			Size:  u32(36),
+		},
+		Mode: u32(24),
+		Hash: hex.EncodeToString(data[40:60]),
+	}
+	flags := binary.BigEndian.Uint16(data[60:62])
+	e.AssumeValid = flags&flagAssumeValid != 0
+	e.Stage = int(flags&flagStageMask) >> flagStageShift
+	pos := 62
+
+	if flags&flagExtended != 0 {
+		if version < 3 || len(data) < 64 {
+			return Entry{}, 0, ERROR_MALFORMED_INDEX
+		}
+		extended := binary.BigEndian.Uint16(data[62:64])
+		e.SkipWorktree = extended&flagSkipWorktree != 0
+		e.IntentToAdd = extended&flagIntentToAdd != 0
+		pos += 2
+	}
+
+	if version == 4 {
+		strip, n := readOffset(data[pos:])
+		if n == 0 || strip > len(prevPath) {
+			return Entry{}, 0, ERROR_MALFORMED_INDEX
+		}
+		pos += n
+		end := bytes.IndexByte(data[pos:], 0)
+		if end == -1 {
+			return Entry{}, 0, ERROR_MALFORMED_INDEX
+		}
+		e.Path = prevPath[:len(prevPath)-strip] + string(data[pos:pos+end])
+		return e, pos + end + 1, nil
+	}
+
+	end := bytes.IndexByte(data[pos:], 0)
+	if end == -1 {
+		return Entry{}, 0, ERROR_MALFORMED_INDEX
+	}
+	e.Path = string(data[pos : pos+end])
+	// entries are NUL padded to a multiple of eight bytes
+	size := (pos + end + 8) &^ 7
+	if size > len(data) {
+		return Entry{}, 0, ERROR_MALFORMED_INDEX
+	}
+	return e, size, nil
+}
+
+// fromUnix maps the all zero timestamp of entries without stat data
+// (e.g. written for merge stages) back to the zero time.
+func fromUnix(sec, nsec uint32) time.Time {
+	if sec == 0 && nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(sec), int64(nsec))
+}
+
+func toUnix(t time.Time) uint32 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint32(t.Unix())
+}
+
+// readOffset decodes the variable length integer git uses for
+// v4 path compression (the same encoding as OFS_DELTA offsets).
+func readOffset(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	c := data[0]
+	value := int(c & 0x7f)
+	n := 1
+	for c&0x80 != 0 {
+		if n >= len(data) {
+			return 0, 0
+		}
+		c = data[n]
+		n++
+		value = ((value + 1) << 7) | int(c&0x7f)
+	}
+	return value, n
+}
+
+func appendOffset(buf []byte, value int) []byte {
+	var tmp [16]byte
+	pos := len(tmp) - 1
+	tmp[pos] = byte(value & 0x7f)
+	for value >>= 7; value != 0; value >>= 7 {
+		value--
+		pos--
+		tmp[pos] = 0x80 | byte(value&0x7f)
+	}
+	return append(buf, tmp[pos:]...)
+}
+
+// Write encodes idx sorted, in idx.Version (raised to 3 when an
+// entry needs extended flags), followed by its checksum.
+func (idx *Index) Write(w io.Writer) error {
+	idx.Sort()
+	version := idx.Version
+	if version == 0 {
+		version = DefaultVersion
+	}
+	if version < 2 || version > 4 {
+		return fmt.Errorf("%w %d", ERROR_UNSUPPORTED_INDEX, version)
+	}
+	if version == 2 {
+		for i := range idx.Entries {
+			if idx.Entries[i].extended() {
+				version = 3
+				break
+			}
+		}
+	}
+
+	h := sha1.New()
+	bw := bufio.NewWriter(w)
+	out := io.MultiWriter(bw, h)
+
+	header := make([]byte, 12)
+	copy(header, signature)
+	binary.BigEndian.PutUint32(header[4:], version)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(idx.Entries)))
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	prevPath := ""
+	for i := range idx.Entries {
+		buf, err := encodeEntry(&idx.Entries[i], version, prevPath)
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write(buf); err != nil {
+			return err
+		}
+		prevPath = idx.Entries[i].Path
+	}
+
+	if _, err := bw.Write(h.Sum(nil)); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func encodeEntry(e *Entry, version uint32, prevPath string) ([]byte, error) {
+	raw, err := hex.DecodeString(e.Hash)
+	if err != nil || len(raw) != sha1.Size {
+		return nil, fmt.Errorf("invalid object name %q for %s", e.Hash, e.Path)
+	}
+	if e.Stage < 0 || e.Stage > 3 {
+		return nil, fmt.Errorf("invalid stage %d for %s", e.Stage, e.Path)
+	}
+
+	buf := make([]byte, 62, 62+len(e.Path)+8)
+	put := func(off int, v uint32) { binary.BigEndian.PutUint32(buf[off:], v) }
+	put(0, toUnix(e.CTime))
+	put(4, uint32(e.CTime.Nanosecond()))
+	put(8, toUnix(e.MTime))
+	put(12, uint32(e.MTime.Nanosecond()))
+	put(16, e.Dev)
+	put(20, e.Ino)
+	put(24, e.Mode)
+	put(28, e.UID)
+	put(32, e.GID)
+	put(36, e.Size)
+	copy(buf[40:60], raw)
+
+	flags := uint16(e.Stage<<flagStageShift) & flagStageMask
+	if len(e.Path) < flagNameMask {
+		flags |= uint16(len(e.Path))
+	} else {
+		flags |= flagNameMask
+	}
+	if e.AssumeValid {
+		flags |= flagAssumeValid
+	}
+	if e.extended() {
+		flags |= flagExtended
+	}
+	binary.BigEndian.PutUint16(buf[60:], flags)
+
+	if e.extended() {
+		var extended uint16
+		if e.SkipWorktree {
+			extended |= flagSkipWorktree
+		}
+		if e.IntentToAdd {
+			extended |= flagIntentToAdd
+		}
+		buf = binary.BigEndian.AppendUint16(buf, extended)
+	}
+
+	if version == 4 {
+		common := 0
+		for common < len(prevPath) && common < len(e.Path) && prevPath[common] == e.Path[common] {
+			common++
+		}
+		buf = appendOffset(buf, len(prevPath)-common)
+		buf = append(buf, e.Path[common:]...)
+		return append(buf, 0), nil
+	}
+
+	buf = append(buf, e.Path...)
+	size := (len(buf) + 8) &^ 7
+	return append(buf, make([]byte, size-len(buf))...), nil
+}
+
+// ReadFile reads the index at path. A missing or zero length file
+// (as left by init) is an empty index.
+func ReadFile(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return New(), nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return New(), nil
+	}
+	idx, err := Read(f)
+	if err != nil {
+		return nil, err
+	}
+	idx.Timestamp = info.ModTime()
+	return idx, nil
+}
+
+// WriteFile replaces the index at path through path.lock so readers
+// never see a half written file.
+func WriteFile(path string, idx *Index) error {
+	lock := path + ".lock"
+	f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("unable to create '%s': file exists", lock)
+		}
+		return err
+	}
+	if err := idx.Write(f); err != nil {
+		f.Close()
+		os.Remove(lock)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(lock)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(lock)
+		return err
+	}
+	return os.Rename(lock, path)
+}
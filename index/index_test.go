@@ -0,0 +1,86 @@
+package index
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleIndex(version uint32) *Index {
+	idx := &Index{Version: version}
+	for i, p := range []string{"dir/sub/b.txt", "a.txt", "dir/sub/a.txt", strings.Repeat("x", 5000)} {
+		idx.Entries = append(idx.Entries, Entry{
+			Stat: Stat{
+				CTime: time.Unix(1700000000, 123),
+				MTime: time.Unix(1700000001, 456),
+				Dev:   1, Ino: uint32(10 + i), UID: 1000, GID: 1000, Size: uint32(i),
+			},
+			Mode: 0100644,
+			Hash: "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391",
+			Path: p,
+		})
+	}
+	return idx
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	for _, version := range []uint32{2, 3, 4} {
+		idx := sampleIndex(version)
+		idx.Entries = append(idx.Entries, Entry{
+			Mode: 0100644, Hash: "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", Path: "a.txt", Stage: 2,
+		})
+		if version >= 3 {
+			idx.Entries[0].IntentToAdd = true
+		}
+
+		var buf bytes.Buffer
+		assert.NoError(t, idx.Write(&buf))
+
+		got, err := Read(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, version, got.Version)
+		assert.Equal(t, len(idx.Entries), len(got.Entries))
+		for i := range idx.Entries {
+			want, have := idx.Entries[i], got.Entries[i]
+			assert.Equal(t, want.Path, have.Path)
+			assert.Equal(t, want.Stage, have.Stage)
+			assert.Equal(t, want.IntentToAdd, have.IntentToAdd)
+			assert.True(t, want.MTime.Equal(have.MTime))
+			assert.Equal(t, want.Ino, have.Ino)
+		}
+		assert.Equal(t, "a.txt", got.Entries[0].Path)
+		assert.Equal(t, 2, got.Entries[1].Stage)
+	}
+}
+
+func TestIndexExtendedFlagsRaiseVersion(t *testing.T) {
+	idx := sampleIndex(2)
+	idx.Entries[0].SkipWorktree = true
+
+	var buf bytes.Buffer
+	assert.NoError(t, idx.Write(&buf))
+	got, err := Read(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), got.Version)
+}
+
+func TestIndexChecksum(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, sampleIndex(2).Write(&buf))
+	data := buf.Bytes()
+	data[20] ^= 0xff
+
+	_, err := Read(bytes.NewReader(data))
+	assert.ErrorIs(t, err, ERROR_INDEX_CHECKSUM)
+}
+
+func TestOffsetEncoding(t *testing.T) {
+	for _, v := range []int{0, 1, 127, 128, 16511, 16512, 1 << 20} {
+		n, size := readOffset(appendOffset(nil, v))
+		assert.Equal(t, v, n)
+		assert.Greater(t, size, 0)
+	}
+}
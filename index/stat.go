@@ -0,0 +1,38 @@
+package index
+
+import (
+	"os"
+	"time"
+)
+
+// StatFromFileInfo collects the cached stat data of a worktree file.
+// Fields the platform does not provide stay zero.
+func StatFromFileInfo(info os.FileInfo) Stat {
+	st := Stat{
+		CTime: info.ModTime(),
+		MTime: info.ModTime(),
+		Size:  uint32(info.Size()),
+	}
+	fillSysStat(&st, info)
+	return st
+}
+
+// Matches reports whether the cached stat data s still describes a
+// file whose current stat data is cur.
+func (s Stat) Matches(cur Stat) bool {
+	return s.MTime.Equal(cur.MTime) &&
+		s.CTime.Equal(cur.CTime) &&
+		s.Ino == cur.Ino &&
+		s.Dev == cur.Dev &&
+		s.UID == cur.UID &&
+		s.GID == cur.GID &&
+		s.Size == cur.Size
+}
+
+// IsRacy reports whether the file was modified no earlier than the
+// index at timestamp was written. Such an entry can match its stat
+// data and still have changed within the filesystem's time granularity,
+// so only its content can tell.
+func (s Stat) IsRacy(timestamp time.Time) bool {
+	return !timestamp.IsZero() && !s.MTime.Before(timestamp)
+}
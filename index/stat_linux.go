@@ -0,0 +1,21 @@
+//go:build linux
+
+package index
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func fillSysStat(st *Stat, info os.FileInfo) {
+	sys, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	st.CTime = time.Unix(int64(sys.Ctim.Sec), int64(sys.Ctim.Nsec))
+	st.Dev = uint32(sys.Dev)
+	st.Ino = uint32(sys.Ino)
+	st.UID = sys.Uid
+	st.GID = sys.Gid
+}
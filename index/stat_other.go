@@ -0,0 +1,9 @@
+//go:build !linux
+
+package index
+
+import (
+	"os"
+)
+
+func fillSysStat(st *Stat, info os.FileInfo) {}
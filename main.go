@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -9,12 +10,21 @@ import (
 )
 
 const (
-	INIT     string = "init"
-	STATUS   string = "status"
-	COMMIT   string = "commit"
-	ADD      string = "add"
-	LOG      string = "log"
-	CAT_FILE string = "cat-file"
+	INIT         string = "init"
+	STATUS       string = "status"
+	COMMIT       string = "commit"
+	ADD          string = "add"
+	LOG          string = "log"
+	CAT_FILE     string = "cat-file"
+	GC           string = "gc"
+	REPACK       string = "repack"
+	BRANCH       string = "branch"
+	CHECKOUT     string = "checkout"
+	SWITCH       string = "switch"
+	REV_PARSE    string = "rev-parse"
+	CHECK_IGNORE string = "check-ignore"
+	DIFF         string = "diff"
+	MERGE        string = "merge"
 )
 
 func main() {
@@ -50,10 +60,51 @@ func main() {
 		}
 	case CAT_FILE:
 		if err := snapshots.HandleCatFile(); err != nil {
-			log.Fatal("CAT FILE ERROR: ", err)
+			fatal("CAT FILE ERROR: ", err)
+		}
+	case GC, REPACK:
+		if err := snapshots.HandleGCCommand(); err != nil {
+			log.Fatal("GC COMMAND ERROR: ", err)
+		}
+	case BRANCH:
+		if err := snapshots.HandleBranchCommand(); err != nil {
+			log.Fatal("BRANCH COMMAND ERROR: ", err)
+		}
+	case CHECKOUT:
+		if err := snapshots.HandleCheckoutCommand(); err != nil {
+			log.Fatal("CHECKOUT COMMAND ERROR: ", err)
+		}
+	case SWITCH:
+		if err := snapshots.HandleSwitchCommand(); err != nil {
+			log.Fatal("SWITCH COMMAND ERROR: ", err)
+		}
+	case REV_PARSE:
+		if err := snapshots.HandleRevParseCommand(); err != nil {
+			log.Fatal("REV-PARSE COMMAND ERROR: ", err)
+		}
+	case CHECK_IGNORE:
+		if err := snapshots.HandleCheckIgnoreCommand(); err != nil {
+			fatal("CHECK-IGNORE COMMAND ERROR: ", err)
+		}
+	case DIFF:
+		if err := snapshots.HandleDiffCommand(); err != nil {
+			log.Fatal("DIFF COMMAND ERROR: ", err)
+		}
+	case MERGE:
+		if err := snapshots.HandleMergeCommand(); err != nil {
+			fatal("MERGE COMMAND ERROR: ", err)
 		}
 	default:
 		log.Fatal("invalid command arguments")
 	}
 
 }
+
+// fatal logs err and exits with status 1. Commands that have already
+// reported their outcome exit without a message.
+func fatal(prefix string, err error) {
+	if errors.Is(err, snapshots.ERROR_SILENT_EXIT) {
+		os.Exit(1)
+	}
+	log.Fatal(prefix, err)
+}
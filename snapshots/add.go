@@ -1,26 +1,34 @@
 package snapshots
 
 import (
-	"bufio"
 	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"sort"
-	"strconv"
 	"strings"
+	"time"
+
+	"github.com/bibektamang7/own-git/ignore"
+	"github.com/bibektamang7/own-git/index"
 )
 
-// IndexLine represents each line from Index file
+// IndexLine represents each entry of the index file
 type IndexLine struct {
-	Fullpath   string
-	BlobHash   string
-	FileMode   uint32
-	FileSize   int64
-	TimeStamps int64
+	Fullpath string
+	BlobHash string
+	FileMode uint32
+	Stat     index.Stat
+	Stage    int
+	// flags git keeps on an entry; they are carried through unchanged
+	AssumeValid  bool
+	SkipWorktree bool
+	IntentToAdd  bool
 }
 
 func NewIndexLine() *IndexLine {
@@ -28,10 +36,14 @@ func NewIndexLine() *IndexLine {
 }
 
 type Staged struct {
+	store      ObjectStore
 	IndexLines []IndexLine
 	indexMap   map[string]int
-	seen       map[string]bool
-	currentDir string
+	version    uint32                 // index format version to write back
+	timestamp  time.Time              // mtime of the index file when read
+	pending    map[string]os.FileInfo // files whose blobs are not written yet
+	excludes   *ignore.Matcher        // nil disables ignore rules
+	force      bool                   // add ignored files too
 	baseRoot   string
 }
 
@@ -39,19 +51,18 @@ func NewStaged() *Staged {
 	return &Staged{
 		IndexLines: []IndexLine{},
 		indexMap:   make(map[string]int),
-		seen:       make(map[string]bool),
-		currentDir: "",
+		pending:    make(map[string]os.FileInfo),
 		baseRoot:   "",
 	}
 }
 func getGitMode(mode os.FileMode) uint32 {
 	if mode&os.ModeSymlink != 0 {
-		return 120000
+		return 0120000
 	}
 	if mode&0111 != 0 {
-		return 100755
+		return 0100755
 	}
-	return 100644
+	return 0100644
 }
 
 func hashFile(path string, info os.FileInfo) (string, error) {
@@ -73,191 +84,219 @@ func hashFile(path string, info os.FileInfo) (string, error) {
 }
 
 func (s *Staged) parseIndexFile() error {
-	path := s.baseRoot + ROOTDIR + "index"
-	f, err := os.Open(path)
+	lines, idx, err := readIndex(s.baseRoot)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
 		return err
 	}
-	defer f.Close()
+	s.version = idx.Version
+	s.timestamp = idx.Timestamp
+	for _, line := range lines {
+		s.indexMap[line.Fullpath] = len(s.IndexLines)
+		s.IndexLines = append(s.IndexLines, line)
+	}
+	return nil
+}
 
-	reader := bufio.NewReader(f)
+func (s *Staged) writeIndex(path string) error {
+	return writeIndexFile(path+"index", s.version, s.IndexLines)
+}
 
-	for {
-		line, err := reader.ReadString('\n')
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
+// stageFile queues a worktree file for staging. Files whose cached
+// stat data matches the index, and whose blob is already stored,
+// are left alone so unchanged trees are not read again.
+func (s *Staged) stageFile(rel string, info os.FileInfo) {
+	if idx, ok := s.indexMap[rel]; ok {
+		old := s.IndexLines[idx]
+		if old.statClean(info, s.timestamp) && s.store.Has(old.BlobHash) {
+			return
 		}
+	}
+	s.pending[rel] = info
+}
 
-		line = strings.TrimSpace(line)
-		parts := strings.SplitN(line, "\t", 5)
-		if len(parts) != 5 {
-			return fmt.Errorf("corrupt index line: %q", line)
-		}
+// writePending streams every queued file into the object store
+// in parallel and records the resulting blobs in the index.
+func (s *Staged) writePending() error {
+	jobs := make([]stageJob, 0, len(s.pending))
+	for rel, info := range s.pending {
+		jobs = append(jobs, stageJob{rel: rel, info: info})
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].rel < jobs[j].rel
+	})
 
-		mode, err := strconv.ParseUint(parts[2], 8, 32)
-		if err != nil {
-			return err
-		}
-		size, err := strconv.ParseInt(parts[3], 10, 64)
-		if err != nil {
-			return err
-		}
-		ts, err := strconv.ParseInt(parts[4], 10, 64)
-		if err != nil {
-			return err
+	lines, err := writeBlobs(s.store, s.baseRoot, jobs)
+	if err != nil {
+		return err
+	}
+	dirs := trackedDirs(nil, s.indexMap)
+	for _, line := range lines {
+		s.dropDirectoryConflicts(line.Fullpath, dirs)
+		s.setIndexLine(line)
+	}
+	s.pending = make(map[string]os.FileInfo)
+	return nil
+}
+
+// setIndexLine stages line, replacing the entry of its path. Staging
+// a conflicted path resolves it, dropping its stages.
+func (s *Staged) setIndexLine(line IndexLine) {
+	if idx, ok := s.indexMap[line.Fullpath]; ok {
+		if s.IndexLines[idx].Stage == 0 {
+			s.IndexLines[idx] = line
+			return
 		}
+		s.IndexLines = slices.DeleteFunc(s.IndexLines, func(l IndexLine) bool {
+			return l.Fullpath == line.Fullpath
+		})
+		s.rebuildIndexMap()
+	}
+	s.indexMap[line.Fullpath] = len(s.IndexLines)
+	s.IndexLines = append(s.IndexLines, line)
+}
 
-		idx := IndexLine{
-			Fullpath:   parts[0],
-			BlobHash:   parts[1],
-			FileMode:   uint32(mode),
-			FileSize:   size,
-			TimeStamps: ts,
+// dropDirectoryConflicts unstages what rel replaces when it is staged
+// as a file: entries below it, left from when it was a directory, and
+// entries at its parents, left from when those were files. dirs are
+// the directories the index held before staging.
+func (s *Staged) dropDirectoryConflicts(rel string, dirs map[string]bool) {
+	conflict := dirs[rel]
+	for dir := filepath.Dir(rel); !conflict && dir != "."; dir = filepath.Dir(dir) {
+		_, conflict = s.indexMap[dir]
+	}
+	if !conflict {
+		return
+	}
+	s.IndexLines = slices.DeleteFunc(s.IndexLines, func(l IndexLine) bool {
+		return strings.HasPrefix(l.Fullpath, rel+"/") || strings.HasPrefix(rel, l.Fullpath+"/")
+	})
+	s.rebuildIndexMap()
+}
+
+// unstageMissing drops index entries at or below rel whose files
+// were not seen in the working tree, and reports how many it dropped.
+func (s *Staged) unstageMissing(rel string, seen map[string]bool) int {
+	filtered := s.IndexLines[:0]
+	removed := 0
+	for _, line := range s.IndexLines {
+		if pathWithin(line.Fullpath, rel) && !seen[line.Fullpath] {
+			removed++
+			continue
 		}
+		filtered = append(filtered, line)
+	}
+	s.IndexLines = filtered
+	s.rebuildIndexMap()
+	return removed
+}
 
-		s.indexMap[idx.Fullpath] = len(s.IndexLines)
-		s.IndexLines = append(s.IndexLines, idx)
+func (s *Staged) rebuildIndexMap() {
+	s.indexMap = make(map[string]int, len(s.IndexLines))
+	for i, line := range s.IndexLines {
+		s.indexMap[line.Fullpath] = i
 	}
+}
 
-	return nil
+// pathWithin reports whether p is dir itself or inside it.
+func pathWithin(p, dir string) bool {
+	return dir == "." || p == dir || strings.HasPrefix(p, dir+"/")
 }
-func (s *Staged) visitWorkingDirFiles(repoRoot string) error {
-	return filepath.WalkDir(repoRoot, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
 
-		if d.IsDir() {
-			if d.Name() == ".git" || d.Name() == ".owngit" {
-				return filepath.SkipDir
-			}
-			return nil
-		}
+func isGlobPattern(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
 
-		info, err := d.Info()
+// walkWorktree calls fn for every file under dir (relative to the
+// repository root), skipping the repository folders.
+func (s *Staged) walkWorktree(dir string, fn func(rel string, info os.FileInfo) error) error {
+	dirs := trackedDirs(nil, s.indexMap)
+	return filepath.WalkDir(filepath.Join(s.baseRoot, dir), func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == ".owngit") {
+			return filepath.SkipDir
+		}
 		rel, err := filepath.Rel(s.baseRoot, path)
 		if err != nil {
 			return err
 		}
-		s.seen[rel] = true
-
-		if idx, ok := s.indexMap[rel]; ok {
-			old := s.IndexLines[idx]
-
-			if old.FileSize != info.Size() ||
-				old.TimeStamps != info.ModTime().UnixNano() {
-
-				hash, err := hashFile(path, info)
-				if err != nil {
-					return err
-				}
+		rel = filepath.ToSlash(rel)
 
-				if hash != old.BlobHash {
-					s.IndexLines[idx] = IndexLine{
-						Fullpath:   rel,
-						BlobHash:   hash,
-						FileMode:   getGitMode(info.Mode()),
-						FileSize:   info.Size(),
-						TimeStamps: info.ModTime().UnixNano(),
-					}
+		if d.IsDir() {
+			// ignored directories are only entered for their tracked files
+			if rel != "." && !dirs[rel] {
+				ignored, err := s.isIgnored(rel, true)
+				if err != nil || ignored {
+					return errOrSkipDir(err)
 				}
 			}
 			return nil
 		}
-
-		// New file
-		hash, err := hashFile(path, info)
+		if _, tracked := s.indexMap[rel]; !tracked {
+			if ignored, err := s.isIgnored(rel, false); err != nil || ignored {
+				return err
+			}
+		}
+		info, err := d.Info()
 		if err != nil {
 			return err
 		}
-
-		s.indexMap[rel] = len(s.IndexLines)
-		s.IndexLines = append(s.IndexLines, IndexLine{
-			Fullpath:   rel,
-			BlobHash:   hash,
-			FileMode:   getGitMode(info.Mode()),
-			FileSize:   info.Size(),
-			TimeStamps: info.ModTime().UnixNano(),
-		})
-
-		return nil
+		return fn(rel, info)
 	})
 }
 
-func (s *Staged) removeDeleted() {
-	filtered := s.IndexLines[:0]
-
-	for _, line := range s.IndexLines {
-		if s.currentDir != "" && !strings.HasPrefix(line.Fullpath, s.currentDir+"/") && line.Fullpath != s.currentDir {
-			filtered = append(filtered, line)
-			continue
-		}
-		if s.seen[line.Fullpath] {
-			filtered = append(filtered, line)
-		}
+func errOrSkipDir(err error) error {
+	if err != nil {
+		return err
 	}
-	s.IndexLines = filtered
+	return filepath.SkipDir
 }
 
-func getAddRoot(repoRoot, cwd string) (string, error) {
-	rel, err := filepath.Rel(repoRoot, cwd)
-	if err != nil {
-		return "", err
-	}
-	if rel == "." {
-		return "", nil
+// isIgnored applies the ignore rules unless they are disabled by -f.
+func (s *Staged) isIgnored(rel string, isDir bool) (bool, error) {
+	if s.excludes == nil || s.force {
+		return false, nil
 	}
-	return filepath.ToSlash(rel), nil
-
+	return s.excludes.IsIgnored(rel, isDir)
 }
 
-func (s *Staged) writeIndex(path string) error {
-	sort.Slice(s.IndexLines, func(i, j int) bool {
-		return s.IndexLines[i].Fullpath < s.IndexLines[j].Fullpath
+// addGlob stages every worktree file and drops every deleted
+// index entry whose path matches pattern.
+func (s *Staged) addGlob(pattern string) (bool, error) {
+	matched := false
+	seen := make(map[string]bool)
+	err := s.walkWorktree(".", func(rel string, info os.FileInfo) error {
+		ok, err := path.Match(pattern, rel)
+		if err != nil || !ok {
+			return err
+		}
+		matched = true
+		seen[rel] = true
+		s.stageFile(rel, info)
+		return nil
 	})
-
-	lock := path + "index.lock"
-	f, err := os.Create(lock)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	w := bufio.NewWriter(f)
+	filtered := s.IndexLines[:0]
 	for _, line := range s.IndexLines {
-		fmt.Fprintf(w, "%s\t%s\t%o\t%d\t%d\n",
-			line.Fullpath,
-			line.BlobHash,
-			line.FileMode,
-			line.FileSize,
-			line.TimeStamps,
-		)
-	}
-
-	if err := w.Flush(); err != nil {
-		f.Close()
-		return err
-	}
-	if err := f.Sync(); err != nil {
-		f.Close()
-		return err
+		if ok, _ := path.Match(pattern, line.Fullpath); ok && !seen[line.Fullpath] {
+			matched = true
+			continue
+		}
+		filtered = append(filtered, line)
 	}
-	f.Close()
-
-	return os.Rename(lock, path+"index")
+	s.IndexLines = filtered
+	s.rebuildIndexMap()
+	return matched, nil
 }
 
-func (s *Staged) addSpecificFiles(path string) error {
-	convertedPath, err := filepath.Abs(path)
+// addSpecificFiles stages one pathspec: a file, a directory (recursively),
+// a path deleted from the working tree, or a glob pattern.
+func (s *Staged) addSpecificFiles(p string) error {
+	convertedPath, err := filepath.Abs(p)
 	if err != nil {
 		return err
 	}
@@ -268,20 +307,74 @@ func (s *Staged) addSpecificFiles(path string) error {
 	if strings.HasPrefix(currentRelPath, "..") {
 		return fmt.Errorf("%s is outside repository at %s\n", currentRelPath, s.baseRoot)
 	}
-	fi, err := os.Open(convertedPath)
+	rel := filepath.ToSlash(currentRelPath)
+
+	info, err := os.Lstat(convertedPath)
+	if os.IsNotExist(err) {
+		if isGlobPattern(rel) {
+			matched, err := s.addGlob(rel)
+			if err != nil {
+				return err
+			}
+			if matched {
+				return nil
+			}
+		} else if s.unstageMissing(rel, nil) > 0 {
+			// deleted from the working tree: stage the removal
+			return nil
+		}
+		return fmt.Errorf("pathspec '%s' did not match any files", p)
+	}
 	if err != nil {
 		return err
 	}
-	defer fi.Close()
-	if line, ok := s.indexMap[currentRelPath]; ok {
-		fmt.Println("the line : ", line, "the is rel : ", currentRelPath)
+	if rel == ".owngit" || strings.HasPrefix(rel, ".owngit/") {
+		return fmt.Errorf("'%s' is inside the repository folder", p)
+	}
+
+	_, tracked := s.indexMap[rel]
+	if !tracked {
+		tracked = trackedDirs(nil, s.indexMap)[rel]
+	}
+	if !tracked {
+		ignored, err := s.isIgnored(rel, info.IsDir())
+		if err != nil {
+			return err
+		}
+		if ignored {
+			return fmt.Errorf("The following paths are ignored by one of your .gitignore files:\n%s\nhint: Use -f if you really want to add them.", p)
+		}
+	}
+
+	if !info.IsDir() {
+		s.stageFile(rel, info)
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	err = s.walkWorktree(rel, func(fileRel string, fileInfo os.FileInfo) error {
+		seen[fileRel] = true
+		s.stageFile(fileRel, fileInfo)
 		return nil
+	})
+	if err != nil {
+		return err
 	}
+	s.unstageMissing(rel, seen)
 	return nil
 }
 
 func HandleAddCommand() error {
-	if len(os.Args[2:]) < 1 {
+	var pathspecs []string
+	force := false
+	for _, arg := range os.Args[2:] {
+		if arg == "-f" || arg == "--force" {
+			force = true
+			continue
+		}
+		pathspecs = append(pathspecs, arg)
+	}
+	if len(pathspecs) < 1 {
 		slog.Info("hint: Maybe you wanted to say 'git add .'?")
 		//TODO: FOR LATER
 		slog.Info("hint: Disable this message with 'git config advice.addEmptyPathspec false'")
@@ -301,25 +394,21 @@ func HandleAddCommand() error {
 	s := NewStaged()
 
 	s.baseRoot = fullpath
-	root, err := getAddRoot(fullpath, path)
-	if err != nil {
+	s.store = NewObjectStore(fullpath)
+	s.force = force
+	if s.excludes, err = newIgnoreMatcher(fullpath); err != nil {
 		return err
 	}
-	s.currentDir = root
 	if err := s.parseIndexFile(); err != nil {
 		return err
 	}
-	if os.Args[2] == "." {
-		if err := s.visitWorkingDirFiles(path); err != nil {
+	for _, p := range pathspecs {
+		if err := s.addSpecificFiles(p); err != nil {
 			return err
 		}
-		s.removeDeleted()
-	} else {
-		for _, p := range os.Args[2:] {
-			if err := s.addSpecificFiles(p); err != nil {
-				return err
-			}
-		}
+	}
+	if err := s.writePending(); err != nil {
+		return err
 	}
 	return s.writeIndex(fullpath + ROOTDIR)
 }
@@ -1,9 +1,157 @@
 package snapshots
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/bibektamang7/own-git/index"
+	"github.com/stretchr/testify/assert"
 )
 
-func TestScanAndAddIndexLines(t *testing.T) {
+func TestWriteBlobsStoresEveryFile(t *testing.T) {
+	root := t.TempDir()
+	store := NewLooseStore(filepath.Join(root, "objects"))
+
+	var jobs []stageJob
+	for i := 0; i < 50; i++ {
+		rel := fmt.Sprintf("file%02d.txt", i)
+		path := filepath.Join(root, rel)
+		assert.NoError(t, os.WriteFile(path, []byte(strings.Repeat(rel, i)), 0644))
+		info, err := os.Lstat(path)
+		assert.NoError(t, err)
+		jobs = append(jobs, stageJob{rel: rel, info: info})
+	}
+
+	lines, err := writeBlobs(store, root, jobs)
+	assert.NoError(t, err)
+	assert.Len(t, lines, len(jobs))
+	for i, line := range lines {
+		assert.Equal(t, jobs[i].rel, line.Fullpath)
+
+		want, err := hashFile(filepath.Join(root, line.Fullpath), jobs[i].info)
+		assert.NoError(t, err)
+		assert.Equal(t, want, line.BlobHash)
+
+		objType, content, err := store.Read(line.BlobHash)
+		assert.NoError(t, err)
+		assert.Equal(t, Blob, objType)
+		assert.Equal(t, strings.Repeat(line.Fullpath, i), string(content))
+	}
+}
+
+func TestWriteStreamSizeMismatch(t *testing.T) {
+	store := NewLooseStore(t.TempDir())
+	_, err := store.WriteStream(Blob, 10, strings.NewReader("short"))
+	assert.ErrorIs(t, err, ERROR_SIZE_MISMATCH)
+
+	entries, _ := os.ReadDir(store.objectsDir)
+	assert.Empty(t, entries)
+}
+
+func TestWriteStreamObjectMode(t *testing.T) {
+	store := NewLooseStore(t.TempDir())
+	hash, err := store.WriteStream(Blob, 5, strings.NewReader("hello"))
+	assert.NoError(t, err)
+	info, err := os.Stat(store.path(hash))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0444), info.Mode().Perm())
+}
+
+func TestWriteObjectMode(t *testing.T) {
+	store := NewLooseStore(t.TempDir())
+	hash, err := store.Write(Blob, []byte("hello"))
+	assert.NoError(t, err)
+	info, err := os.Stat(store.path(hash))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0444), info.Mode().Perm())
+
+	// only the object is left behind
+	entries, err := os.ReadDir(store.objectsDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.True(t, entries[0].IsDir())
+}
+
+func TestSetIndexLineResolvesConflict(t *testing.T) {
+	s := NewStaged()
+	for _, line := range []IndexLine{
+		{Fullpath: "a", BlobHash: "1"},
+		{Fullpath: "f", BlobHash: "2", Stage: 1},
+		{Fullpath: "f", BlobHash: "3", Stage: 2},
+		{Fullpath: "f", BlobHash: "4", Stage: 3},
+	} {
+		s.indexMap[line.Fullpath] = len(s.IndexLines)
+		s.IndexLines = append(s.IndexLines, line)
+	}
+
+	s.setIndexLine(IndexLine{Fullpath: "f", BlobHash: "5"})
+	assert.Equal(t, []IndexLine{{Fullpath: "a", BlobHash: "1"}, {Fullpath: "f", BlobHash: "5"}}, s.IndexLines)
+	assert.Equal(t, 1, s.indexMap["f"])
+}
+
+func TestAddReplacesDirectoryConflicts(t *testing.T) {
+	root := newStatusRepo(t)
+	chdir(t, root)
+	hash := hashObject(Blob, []byte("old\n"))
+	assert.NoError(t, writeIndexFile(indexFilePath(root), 0, []IndexLine{
+		{Fullpath: "d/x", BlobHash: hash, FileMode: 0100644},
+		{Fullpath: "d/y/z", BlobHash: hash, FileMode: 0100644},
+		{Fullpath: "e", BlobHash: hash, FileMode: 0100644},
+		{Fullpath: "keep", BlobHash: hash, FileMode: 0100644},
+	}))
+	// d turned from a directory into a file and e the other way round
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "d"), []byte("file\n"), 0644))
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "e"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "e", "f"), []byte("file\n"), 0644))
+
+	s := NewStaged()
+	s.baseRoot = root
+	s.store = NewObjectStore(root)
+	assert.NoError(t, s.parseIndexFile())
+	assert.NoError(t, s.addSpecificFiles("d"))
+	assert.NoError(t, s.addSpecificFiles("e/f"))
+	assert.NoError(t, s.writePending())
+
+	var paths []string
+	for _, line := range s.IndexLines {
+		paths = append(paths, line.Fullpath)
+	}
+	sort.Strings(paths)
+	assert.Equal(t, []string{"d", "e/f", "keep"}, paths)
+	for rel, i := range s.indexMap {
+		assert.Equal(t, rel, s.IndexLines[i].Fullpath)
+	}
+}
+
+func TestStagedKeepsEntryFlags(t *testing.T) {
+	root := newStatusRepo(t)
+	hash := hashObject(Blob, []byte("x\n"))
+	idx := index.New()
+	idx.Entries = []index.Entry{
+		{Mode: 0100644, Hash: hash, Path: "assumed", AssumeValid: true},
+		{Mode: 0100644, Hash: hash, Path: "intent", IntentToAdd: true},
+		{Mode: 0100644, Hash: hash, Path: "plain"},
+		{Mode: 0100644, Hash: hash, Path: "sparse", SkipWorktree: true},
+	}
+	assert.NoError(t, index.WriteFile(indexFilePath(root), idx))
+
+	s := NewStaged()
+	s.baseRoot = root
+	assert.NoError(t, s.parseIndexFile())
+	assert.NoError(t, s.writeIndex(root+ROOTDIR))
+
+	got, err := index.ReadFile(indexFilePath(root))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), got.Version)
+	assert.Equal(t, idx.Entries, got.Entries)
+}
 
+func TestTrackedDirs(t *testing.T) {
+	dirs := trackedDirs(nil, map[string]int{"a/b/c.txt": 0, "a/d.txt": 0, "top.txt": 0})
+	dirs = trackedDirs(dirs, map[string]bool{"x/y.txt": true})
+	assert.Equal(t, map[string]bool{"a": true, "a/b": true, "x": true}, dirs)
 }
@@ -0,0 +1,254 @@
+package snapshots
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// isAncestor reports whether ancestor is reachable from descendant.
+func isAncestor(store ObjectStore, ancestor, descendant string) (bool, error) {
+	seen := make(map[string]bool)
+	queue := []string{descendant}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if hash == ancestor {
+			return true, nil
+		}
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		commit, err := readCommit(store, hash)
+		if err != nil {
+			return false, err
+		}
+		queue = append(queue, commit.parents...)
+	}
+	return false, nil
+}
+
+// listBranches returns every branch name under refs/heads, sorted.
+func listBranches(gitRoot string) ([]string, error) {
+	refs, err := listRefs(gitRoot, BRANCH_PREFIX)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		names[i] = strings.TrimPrefix(ref.name, BRANCH_PREFIX)
+	}
+	return names, nil
+}
+
+func branchExists(gitRoot, name string) bool {
+	_, err := readRef(gitRoot, BRANCH_PREFIX+name)
+	return err == nil
+}
+
+func printBranches(gitRoot string) error {
+	ref, hash, err := readHEAD(gitRoot)
+	if err != nil {
+		return err
+	}
+	if ref == "" && hash != "" {
+		fmt.Printf("* (HEAD detached at %s)\n", hash[:7])
+	}
+	names, err := listBranches(gitRoot)
+	if err != nil {
+		return err
+	}
+	current := strings.TrimPrefix(ref, BRANCH_PREFIX)
+	for _, name := range names {
+		if ref != "" && name == current {
+			fmt.Printf("* %s\n", name)
+			continue
+		}
+		fmt.Printf("  %s\n", name)
+	}
+	return nil
+}
+
+// branchStart checks that a branch name may be created, or reset when
+// force is set, and resolves the commit it would start at.
+func branchStart(gitRoot string, store ObjectStore, name, startPoint string, force bool) (string, error) {
+	if err := checkRefName(name); err != nil {
+		return "", err
+	}
+	if branchExists(gitRoot, name) && !force {
+		return "", fmt.Errorf("a branch named '%s' already exists", name)
+	}
+	if current, ok, _ := CurrentBranch(gitRoot); ok && current == name && force {
+		return "", fmt.Errorf("cannot force update the current branch")
+	}
+	return resolveCommitish(gitRoot, store, startPoint)
+}
+
+func createBranch(gitRoot string, store ObjectStore, name, startPoint string, force bool) error {
+	hash, err := branchStart(gitRoot, store, name, startPoint, force)
+	if err != nil {
+		return err
+	}
+	return writeRef(gitRoot, BRANCH_PREFIX+name, hash)
+}
+
+func deleteBranch(gitRoot string, store ObjectStore, name string, force bool) error {
+	hash, err := readRef(gitRoot, BRANCH_PREFIX+name)
+	if err != nil {
+		return fmt.Errorf("branch '%s' not found", name)
+	}
+	if current, ok, _ := CurrentBranch(gitRoot); ok && current == name {
+		return fmt.Errorf("cannot delete branch '%s' checked out at '%s'", name, gitRoot)
+	}
+	if !force {
+		head, err := resolveHEAD(gitRoot)
+		merged := false
+		if err == nil {
+			merged, err = isAncestor(store, hash, head)
+			if err != nil {
+				return err
+			}
+		}
+		if !merged {
+			return fmt.Errorf("the branch '%s' is not fully merged\nIf you are sure you want to delete it, run 'branch -D %s'", name, name)
+		}
+	}
+	if err := deleteRef(gitRoot, BRANCH_PREFIX+name); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted branch %s (was %s).\n", name, hash[:7])
+	return nil
+}
+
+// moveRef renames the ref oldRef at hash to newRef. The new ref is
+// written before the old one goes, unless one name is a directory of
+// the other: then the old ref is put back when newRef can't be written.
+func moveRef(gitRoot, oldRef, newRef, hash string) error {
+	if !strings.HasPrefix(newRef, oldRef+"/") && !strings.HasPrefix(oldRef, newRef+"/") {
+		if err := writeRef(gitRoot, newRef, hash); err != nil {
+			return err
+		}
+		return deleteRef(gitRoot, oldRef)
+	}
+	if err := deleteRef(gitRoot, oldRef); err != nil {
+		return err
+	}
+	if err := writeRef(gitRoot, newRef, hash); err != nil {
+		if restoreErr := writeRef(gitRoot, oldRef, hash); restoreErr != nil {
+			return fmt.Errorf("%w; could not restore %s: %v", err, oldRef, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func renameBranch(gitRoot, oldName, newName string, force bool) error {
+	if err := checkRefName(newName); err != nil {
+		return err
+	}
+	ref, _, err := readHEAD(gitRoot)
+	if err != nil {
+		return err
+	}
+	isCurrent := ref == BRANCH_PREFIX+oldName
+
+	hash, err := readRef(gitRoot, BRANCH_PREFIX+oldName)
+	if err != nil && !(err == ERROR_REF_NOT_FOUND && isCurrent) {
+		return fmt.Errorf("no branch named '%s'", oldName)
+	}
+	if oldName != newName && branchExists(gitRoot, newName) && !force {
+		return fmt.Errorf("a branch named '%s' already exists", newName)
+	}
+
+	// an unborn current branch only lives in HEAD
+	if hash != "" && oldName != newName {
+		if err := moveRef(gitRoot, BRANCH_PREFIX+oldName, BRANCH_PREFIX+newName, hash); err != nil {
+			return err
+		}
+	}
+	if isCurrent {
+		return setHEAD(gitRoot, BRANCH_PREFIX+newName)
+	}
+	return nil
+}
+
+func HandleBranchCommand() error {
+	path, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	gitRoot, ok, err := CheckGitFolderExists(path)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ERROR_OUTSIDE_GIT
+	}
+	store := NewObjectStore(gitRoot)
+
+	var mode string
+	force := false
+	var args []string
+	for _, arg := range os.Args[2:] {
+		switch arg {
+		case "-d", "--delete":
+			mode = "delete"
+		case "-D":
+			mode, force = "delete", true
+		case "-m", "--move":
+			mode = "move"
+		case "-M":
+			mode, force = "move", true
+		case "-f", "--force":
+			force = true
+		case "-l", "--list":
+			mode = "list"
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return fmt.Errorf("unknown option: %s", arg)
+			}
+			args = append(args, arg)
+		}
+	}
+
+	switch mode {
+	case "delete":
+		if len(args) == 0 {
+			return fmt.Errorf("branch name required")
+		}
+		for _, name := range args {
+			if err := deleteBranch(gitRoot, store, name, force); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "move":
+		switch len(args) {
+		case 1:
+			current, ok, err := CurrentBranch(gitRoot)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("cannot rename the current branch while not on any")
+			}
+			return renameBranch(gitRoot, current, args[0], force)
+		case 2:
+			return renameBranch(gitRoot, args[0], args[1], force)
+		default:
+			return fmt.Errorf("too many arguments for a rename operation")
+		}
+	}
+
+	switch len(args) {
+	case 0:
+		return printBranches(gitRoot)
+	case 1:
+		return createBranch(gitRoot, store, args[0], "HEAD", force)
+	case 2:
+		return createBranch(gitRoot, store, args[0], args[1], force)
+	default:
+		return fmt.Errorf("too many arguments")
+	}
+}
@@ -0,0 +1,194 @@
+package snapshots
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newBranchRepo writes root - a on main and root - b on side, with
+// HEAD on main.
+func newBranchRepo(t *testing.T) (string, ObjectStore, map[string]string) {
+	root := newStatusRepo(t)
+	store := NewObjectStore(root)
+	hashes := make(map[string]string)
+	writeTestCommit(t, store, hashes, "root", 1)
+	writeTestCommit(t, store, hashes, "a", 2, "root")
+	writeTestCommit(t, store, hashes, "b", 3, "root")
+	assert.NoError(t, writeRef(root, BRANCH_PREFIX+"main", hashes["a"]))
+	assert.NoError(t, writeRef(root, BRANCH_PREFIX+"side", hashes["b"]))
+	return root, store, hashes
+}
+
+func TestBranchCommands(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		run     func(root string, store ObjectStore) error
+		wantErr string
+		want    map[string]string // branch to commit name
+		head    string
+	}{
+		{
+			name: "create at HEAD",
+			run: func(root string, store ObjectStore) error {
+				return createBranch(root, store, "topic", "HEAD", false)
+			},
+			want: map[string]string{"main": "a", "side": "b", "topic": "a"},
+		},
+		{
+			name: "create at start point",
+			run: func(root string, store ObjectStore) error {
+				return createBranch(root, store, "topic", "side~1", false)
+			},
+			want: map[string]string{"main": "a", "side": "b", "topic": "root"},
+		},
+		{
+			name: "create existing",
+			run: func(root string, store ObjectStore) error {
+				return createBranch(root, store, "side", "HEAD", false)
+			},
+			wantErr: "a branch named 'side' already exists",
+			want:    map[string]string{"main": "a", "side": "b"},
+		},
+		{
+			name: "force create existing",
+			run: func(root string, store ObjectStore) error {
+				return createBranch(root, store, "side", "HEAD", true)
+			},
+			want: map[string]string{"main": "a", "side": "a"},
+		},
+		{
+			name: "force create current",
+			run: func(root string, store ObjectStore) error {
+				return createBranch(root, store, "main", "side", true)
+			},
+			wantErr: "cannot force update the current branch",
+			want:    map[string]string{"main": "a", "side": "b"},
+		},
+		{
+			name: "create invalid name",
+			run: func(root string, store ObjectStore) error {
+				return createBranch(root, store, "bad..name", "HEAD", false)
+			},
+			wantErr: ERROR_INVALID_REF_NAME.Error(),
+			want:    map[string]string{"main": "a", "side": "b"},
+		},
+		{
+			name: "delete merged",
+			run: func(root string, store ObjectStore) error {
+				if err := createBranch(root, store, "old", "main~1", false); err != nil {
+					return err
+				}
+				return deleteBranch(root, store, "old", false)
+			},
+			want: map[string]string{"main": "a", "side": "b"},
+		},
+		{
+			name: "delete unmerged",
+			run: func(root string, store ObjectStore) error {
+				return deleteBranch(root, store, "side", false)
+			},
+			wantErr: "the branch 'side' is not fully merged",
+			want:    map[string]string{"main": "a", "side": "b"},
+		},
+		{
+			name: "force delete unmerged",
+			run: func(root string, store ObjectStore) error {
+				return deleteBranch(root, store, "side", true)
+			},
+			want: map[string]string{"main": "a"},
+		},
+		{
+			name: "delete current",
+			run: func(root string, store ObjectStore) error {
+				return deleteBranch(root, store, "main", true)
+			},
+			wantErr: "cannot delete branch 'main'",
+			want:    map[string]string{"main": "a", "side": "b"},
+		},
+		{
+			name: "rename",
+			run: func(root string, store ObjectStore) error {
+				return renameBranch(root, "side", "feature/side", false)
+			},
+			want: map[string]string{"main": "a", "feature/side": "b"},
+		},
+		{
+			name: "rename current",
+			run: func(root string, store ObjectStore) error {
+				return renameBranch(root, "main", "trunk", false)
+			},
+			want: map[string]string{"trunk": "a", "side": "b"},
+			head: "trunk",
+		},
+		{
+			name: "rename into a directory of its own name",
+			run: func(root string, store ObjectStore) error {
+				return renameBranch(root, "side", "side/b", false)
+			},
+			want: map[string]string{"main": "a", "side/b": "b"},
+		},
+		{
+			name: "rename out of a directory of its new name",
+			run: func(root string, store ObjectStore) error {
+				if err := renameBranch(root, "side", "side/b", false); err != nil {
+					return err
+				}
+				return renameBranch(root, "side/b", "side", false)
+			},
+			want: map[string]string{"main": "a", "side": "b"},
+		},
+		{
+			name: "rename onto a path another branch blocks",
+			run: func(root string, store ObjectStore) error {
+				return renameBranch(root, "side", "main/side", false)
+			},
+			wantErr: "not a directory",
+			want:    map[string]string{"main": "a", "side": "b"},
+		},
+		{
+			name: "rename onto existing",
+			run: func(root string, store ObjectStore) error {
+				return renameBranch(root, "side", "main", false)
+			},
+			wantErr: "a branch named 'main' already exists",
+			want:    map[string]string{"main": "a", "side": "b"},
+		},
+		{
+			name: "force rename onto existing",
+			run: func(root string, store ObjectStore) error {
+				return renameBranch(root, "main", "side", true)
+			},
+			want: map[string]string{"side": "a"},
+			head: "side",
+		},
+	} {
+		root, store, hashes := newBranchRepo(t)
+		err := tc.run(root, store)
+		if tc.wantErr != "" {
+			assert.ErrorContains(t, err, tc.wantErr, tc.name)
+		} else {
+			assert.NoError(t, err, tc.name)
+		}
+
+		refs, err := listRefs(root, BRANCH_PREFIX)
+		assert.NoError(t, err)
+		got := make(map[string]string)
+		for _, ref := range refs {
+			for name, hash := range hashes {
+				if hash == ref.hash {
+					got[ref.name[len(BRANCH_PREFIX):]] = name
+				}
+			}
+		}
+		assert.Equal(t, tc.want, got, tc.name)
+
+		head := tc.head
+		if head == "" {
+			head = "main"
+		}
+		current, _, err := CurrentBranch(root)
+		assert.NoError(t, err)
+		assert.Equal(t, head, current, tc.name)
+	}
+}
@@ -5,13 +5,21 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 )
 
 func HandleCatFile() error {
-	hash := os.Args[2]
-	if len(hash) < 5 {
-		return fmt.Errorf("at least 5 hash characters")
+	mode := "-p"
+	var revs []string
+	for _, arg := range os.Args[2:] {
+		switch arg {
+		case "-p", "-t", "-s", "-e":
+			mode = arg
+		default:
+			revs = append(revs, arg)
+		}
+	}
+	if len(revs) != 1 {
+		return fmt.Errorf("usage: cat-file [-p | -t | -s | -e] <object>")
 	}
 	path, err := os.Getwd()
 	if err != nil {
@@ -25,25 +33,54 @@ func HandleCatFile() error {
 		return fmt.Errorf("outside git repository")
 	}
 
-	hashPath := filepath.Join(gitRootPath, ROOTDIR, "objects", hash[:2], hash[2:])
-	matches, err := filepath.Glob(fmt.Sprintf("%s*", hashPath))
+	store := NewObjectStore(gitRootPath)
+	hash, err := ResolveRevision(gitRootPath, store, revs[0])
 	if err != nil {
+		if mode == "-e" {
+			return ERROR_SILENT_EXIT
+		}
 		return err
 	}
-
-	if len(matches) == 0 {
-		return fmt.Errorf("no file found matching pattern : %s", hashPath)
-	}
-	fi, err := os.Open(matches[0])
+	objType, size, fi, err := store.Stream(hash)
 	if err != nil {
+		if mode == "-e" {
+			return ERROR_SILENT_EXIT
+		}
 		return err
 	}
 	defer fi.Close()
 
+	switch mode {
+	case "-e":
+		return nil
+	case "-t":
+		fmt.Println(objType)
+		return nil
+	case "-s":
+		fmt.Println(size)
+		return nil
+	}
+
+	if objType == Tree {
+		data, err := io.ReadAll(fi)
+		if err != nil {
+			return err
+		}
+		entries, err := decodeTree(data)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			fmt.Printf("%06s %s %s\t%s\n", e.fileMode, e.contentType, e.Hash, e.Name)
+		}
+		return nil
+	}
+
 	reader := bufio.NewReader(fi)
 	for {
 		line, err := reader.ReadString('\n')
 		if err == io.EOF {
+			fmt.Printf("%s", line)
 			break
 		}
 		if err != nil {
@@ -0,0 +1,498 @@
+package snapshots
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/bibektamang7/own-git/index"
+)
+
+var ERROR_LOCAL_CHANGES = fmt.Errorf("your local changes would be overwritten by checkout")
+
+// checkoutTarget is where HEAD ends up after a checkout.
+type checkoutTarget struct {
+	commitHash string
+	branchRef  string // empty for a detached checkout
+	// writeBranch points branchRef at commitHash once the worktree is
+	// updated, before HEAD moves to it
+	writeBranch bool
+}
+
+// worktreeHash hashes the working tree file at rel the way it
+// would be stored, or returns "" when the file does not exist.
+func worktreeHash(gitRoot, rel string) (string, os.FileInfo, error) {
+	path := filepath.Join(gitRoot, rel)
+	info, err := os.Lstat(path)
+	if err != nil {
+		// a file where a parent directory would be hides nothing
+		if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+	if info.IsDir() {
+		return "", info, nil
+	}
+	hash, err := hashWorktreeFile(path, info)
+	return hash, info, err
+}
+
+// checkoutBlockers are the paths that stop a switch before anything
+// is changed.
+type checkoutBlockers struct {
+	changed     []string // local changes that would be overwritten
+	overwritten []string // untracked files where the target puts a file or directory
+	removed     []string // untracked files in a directory the target replaces by a file
+}
+
+// err describes the blockers the way command would, ending with what
+// to do before the action; it is nil when nothing is in the way.
+func (b *checkoutBlockers) err(localChanges error, command, action string) error {
+	switch {
+	case len(b.changed) > 0:
+		return localChangesError(localChanges, b.changed, action)
+	case len(b.overwritten) > 0:
+		return untrackedFilesError("overwritten", command, b.overwritten, action)
+	case len(b.removed) > 0:
+		return untrackedFilesError("removed", command, b.removed, action)
+	}
+	return nil
+}
+
+// checkoutConflicts finds what a switch from current to target would
+// clobber: files whose index or working tree copy differs from HEAD and
+// from the target, and untracked files in the target's way, including
+// those inside a directory the target replaces by a file and files
+// standing where the target needs a directory.
+func checkoutConflicts(gitRoot string, staged *Staged, current, target TreePaths) (*checkoutBlockers, error) {
+	changed := make(map[string]bool)
+	overwritten := make(map[string]bool)
+	removed := make(map[string]bool)
+
+	// inTheWay sorts a worktree file the target displaces. Files of
+	// HEAD are checked for local changes like any other tracked path.
+	inTheWay := func(rel string, untracked map[string]bool) {
+		if _, ok := current.TreePaths[rel]; ok {
+			return
+		}
+		if _, ok := staged.indexMap[rel]; ok {
+			changed[rel] = true
+			return
+		}
+		untracked[rel] = true
+	}
+
+	for p := range target.TreePaths {
+		path := filepath.Join(gitRoot, p)
+		info, err := os.Lstat(path)
+		if err != nil && !os.IsNotExist(err) && !errors.Is(err, syscall.ENOTDIR) {
+			return nil, err
+		}
+		if err == nil && info.IsDir() {
+			err := filepath.WalkDir(path, func(file string, d os.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(gitRoot, file)
+				if err != nil {
+					return err
+				}
+				inTheWay(filepath.ToSlash(rel), removed)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for dir := filepath.ToSlash(filepath.Dir(p)); dir != "."; dir = filepath.ToSlash(filepath.Dir(dir)) {
+			info, err := os.Lstat(filepath.Join(gitRoot, dir))
+			if err != nil {
+				if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+					continue
+				}
+				return nil, err
+			}
+			if !info.IsDir() {
+				inTheWay(dir, overwritten)
+			}
+		}
+	}
+
+	paths := make(map[string]bool)
+	for p := range current.TreePaths {
+		paths[p] = true
+	}
+	for p := range target.TreePaths {
+		paths[p] = true
+	}
+
+	for p := range paths {
+		headHash, targetHash := current.TreePaths[p], target.TreePaths[p]
+		if headHash == targetHash && current.FileModes[p] == target.FileModes[p] {
+			continue
+		}
+
+		idx, tracked := staged.indexMap[p]
+		indexHash := ""
+		if tracked {
+			indexHash = staged.IndexLines[idx].BlobHash
+		}
+		if indexHash != headHash && indexHash != targetHash {
+			changed[p] = true
+			continue
+		}
+
+		workHash, _, err := worktreeHash(gitRoot, p)
+		if err != nil {
+			return nil, err
+		}
+		if workHash != indexHash && workHash != targetHash {
+			if !tracked && headHash == "" {
+				overwritten[p] = true
+			} else {
+				changed[p] = true
+			}
+		}
+	}
+	return &checkoutBlockers{
+		changed:     sortedKeys(changed),
+		overwritten: sortedKeys(overwritten),
+		removed:     sortedKeys(removed),
+	}, nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeWorktreeFile materializes a blob at rel with the given git mode.
+func writeWorktreeFile(gitRoot string, store ObjectStore, rel, hash string, mode uint32) (os.FileInfo, error) {
+	path := filepath.Join(gitRoot, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(path); err == nil && info.IsDir() {
+		// checkoutConflicts made sure no file is left in there
+		if err := removeEmptyDirs(path); err != nil {
+			return nil, err
+		}
+	} else if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	_, content, err := store.Read(hash)
+	if err != nil {
+		return nil, err
+	}
+	if mode == 0120000 {
+		os.Remove(path)
+		if err := os.Symlink(string(content), path); err != nil {
+			return nil, err
+		}
+		return os.Lstat(path)
+	}
+
+	perm := os.FileMode(0644)
+	if mode == 0100755 {
+		perm = 0755
+	}
+	if err := os.WriteFile(path, content, perm); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		return nil, err
+	}
+	return os.Lstat(path)
+}
+
+// removeEmptyDirs deletes the directory tree at path, refusing to when
+// any file is left in it.
+func removeEmptyDirs(path string) error {
+	err := filepath.WalkDir(path, func(file string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			err = fmt.Errorf("'%s' is in the way", file)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
+
+// removeWorktreeFile deletes rel and any directories it leaves empty.
+func removeWorktreeFile(gitRoot, rel string) error {
+	path := filepath.Join(gitRoot, rel)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := filepath.Dir(path); dir != filepath.Clean(gitRoot); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func newIndexLineFromInfo(rel, hash string, info os.FileInfo) IndexLine {
+	return IndexLine{
+		Fullpath: rel,
+		BlobHash: hash,
+		FileMode: getGitMode(info.Mode()),
+		Stat:     index.StatFromFileInfo(info),
+	}
+}
+
+// checkoutCommit moves the working tree, the index and HEAD to target.
+// Local changes to files that differ between HEAD and target abort the
+// checkout; changes to other files are carried over.
+func checkoutCommit(gitRoot string, store ObjectStore, target checkoutTarget) error {
+	current := NewTreePaths()
+	headHash, err := resolveHEAD(gitRoot)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if headHash != "" {
+		if current, err = ParseCommit(store, headHash); err != nil {
+			return err
+		}
+	}
+	next, err := ParseCommit(store, target.commitHash)
+	if err != nil {
+		return err
+	}
+
+	staged := NewStaged()
+	staged.baseRoot = gitRoot
+	if err := staged.parseIndexFile(); err != nil {
+		return err
+	}
+
+	blockers, err := checkoutConflicts(gitRoot, staged, current, next)
+	if err != nil {
+		return err
+	}
+	if err := blockers.err(ERROR_LOCAL_CHANGES, "checkout", "switch branches"); err != nil {
+		return err
+	}
+	if err := updateWorktree(gitRoot, store, staged, current, next); err != nil {
+		return err
+	}
+	if err := staged.writeIndex(gitRoot + ROOTDIR); err != nil {
+		return err
+	}
+
+	if target.branchRef == "" {
+		return detachHEAD(gitRoot, target.commitHash)
+	}
+	if target.writeBranch {
+		if err := writeRef(gitRoot, target.branchRef, target.commitHash); err != nil {
+			return err
+		}
+	}
+	return setHEAD(gitRoot, target.branchRef)
+}
+
+// localChangesError lists the paths whose local changes stop a
+// command, ending with what to do before the action.
+func localChangesError(base error, paths []string, action string) error {
+	return pathsError(base.Error(), paths, fmt.Sprintf("Please commit your changes or stash them before you %s.", action))
+}
+
+// untrackedFilesError lists the untracked files command would remove
+// or overwrite.
+func untrackedFilesError(fate, command string, paths []string, action string) error {
+	return pathsError(fmt.Sprintf("the following untracked working tree files would be %s by %s", fate, command),
+		paths, fmt.Sprintf("Please move or remove them before you %s.", action))
+}
+
+func pathsError(header string, paths []string, advice string) error {
+	var buf strings.Builder
+	buf.WriteString(header)
+	buf.WriteString(":\n")
+	for _, p := range paths {
+		fmt.Fprintf(&buf, "\t%s\n", p)
+	}
+	buf.WriteString(advice)
+	return fmt.Errorf("%s", buf.String())
+}
+
+// updateWorktree rewrites the files that differ between current and
+// next, and points the staged index at next. Index entries of files the two
+// share, and of files in neither, are kept.
+func updateWorktree(gitRoot string, store ObjectStore, staged *Staged, current, next TreePaths) error {
+	// files leaving the tree
+	for p := range current.TreePaths {
+		if _, ok := next.TreePaths[p]; ok {
+			continue
+		}
+		if err := removeWorktreeFile(gitRoot, p); err != nil {
+			return err
+		}
+	}
+
+	var lines []IndexLine
+	kept := make(map[string]bool)
+	for p, hash := range next.TreePaths {
+		mode := next.FileModes[p]
+		idx, tracked := staged.indexMap[p]
+		if currentHash, ok := current.TreePaths[p]; ok && currentHash == hash && current.FileModes[p] == mode {
+			// untouched by the switch: keep local state as is, a staged
+			// deletion included
+			if tracked {
+				lines = append(lines, staged.IndexLines[idx])
+			}
+			kept[p] = true
+			continue
+		}
+		info, err := writeWorktreeFile(gitRoot, store, p, hash, mode)
+		if err != nil {
+			return err
+		}
+		line := newIndexLineFromInfo(p, hash, info)
+		line.FileMode = mode
+		lines = append(lines, line)
+		kept[p] = true
+	}
+
+	// entries added to the index but in neither tree stay staged
+	for _, line := range staged.IndexLines {
+		_, inCurrent := current.TreePaths[line.Fullpath]
+		if !kept[line.Fullpath] && !inCurrent {
+			lines = append(lines, line)
+		}
+	}
+	staged.IndexLines = lines
+	staged.rebuildIndexMap()
+	return nil
+}
+
+func commitSubject(store ObjectStore, hash string) string {
+	commit, err := readCommit(store, hash)
+	if err != nil {
+		return ""
+	}
+	subject, _, _ := strings.Cut(commit.message, "\n")
+	return subject
+}
+
+// runCheckout implements both `switch` and `checkout`. When allowDetach
+// is false (plain switch) the revision must name a branch.
+func runCheckout(args []string, createFlag string, allowDetach bool) error {
+	path, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	gitRoot, ok, err := CheckGitFolderExists(path)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ERROR_OUTSIDE_GIT
+	}
+	store := NewObjectStore(gitRoot)
+
+	var newBranch string
+	detach := false
+	forceCreate := false
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case createFlag, strings.ToUpper(createFlag):
+			if i+1 >= len(args) {
+				return fmt.Errorf("option '%s' requires a value", args[i])
+			}
+			forceCreate = args[i] == strings.ToUpper(createFlag)
+			newBranch = args[i+1]
+			i++
+		case "--detach", "-d":
+			detach = true
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+
+	if newBranch != "" {
+		start := "HEAD"
+		if len(rest) > 0 {
+			start = rest[0]
+		}
+		hash, err := branchStart(gitRoot, store, newBranch, start, forceCreate)
+		if err != nil {
+			return err
+		}
+		// the branch is only written once the checkout went through, so
+		// a refused checkout leaves an existing branch where it was
+		existed := branchExists(gitRoot, newBranch)
+		target := checkoutTarget{commitHash: hash, branchRef: BRANCH_PREFIX + newBranch, writeBranch: true}
+		if err := checkoutCommit(gitRoot, store, target); err != nil {
+			return err
+		}
+		if existed {
+			fmt.Printf("Switched to and reset branch '%s'\n", newBranch)
+		} else {
+			fmt.Printf("Switched to a new branch '%s'\n", newBranch)
+		}
+		return nil
+	}
+
+	if len(rest) != 1 {
+		return fmt.Errorf("exactly one branch or revision required")
+	}
+	name := rest[0]
+
+	if !detach && branchExists(gitRoot, name) {
+		current, onBranch, err := CurrentBranch(gitRoot)
+		if err != nil {
+			return err
+		}
+		hash, err := readRef(gitRoot, BRANCH_PREFIX+name)
+		if err != nil {
+			return err
+		}
+		if onBranch && current == name {
+			fmt.Printf("Already on '%s'\n", name)
+			return nil
+		}
+		if err := checkoutCommit(gitRoot, store, checkoutTarget{commitHash: hash, branchRef: BRANCH_PREFIX + name}); err != nil {
+			return err
+		}
+		fmt.Printf("Switched to branch '%s'\n", name)
+		return nil
+	}
+
+	if !allowDetach && !detach {
+		return fmt.Errorf("a branch is expected, got '%s'\nhint: use --detach to check out a commit", name)
+	}
+	hash, err := resolveCommitish(gitRoot, store, name)
+	if err != nil {
+		return err
+	}
+	if err := checkoutCommit(gitRoot, store, checkoutTarget{commitHash: hash}); err != nil {
+		return err
+	}
+	fmt.Printf("HEAD is now at %s %s\n", hash[:7], commitSubject(store, hash))
+	return nil
+}
+
+func HandleCheckoutCommand() error {
+	return runCheckout(os.Args[2:], "-b", true)
+}
+
+func HandleSwitchCommand() error {
+	return runCheckout(os.Args[2:], "-c", false)
+}
@@ -0,0 +1,229 @@
+package snapshots
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// chdir moves into dir for the rest of the test, since the command
+// handlers find the repository from the working directory.
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// newCheckoutRepo checks out main at two, a child of one, with other
+// left at one. Both commits hold f and g; only f differs.
+func newCheckoutRepo(t *testing.T) (string, ObjectStore, map[string]string) {
+	root := newStatusRepo(t)
+	store := NewObjectStore(root)
+	hashes := make(map[string]string)
+	writeFilesCommit(t, store, hashes, "one", 1, map[string]string{"f": "one\n", "g": "same\n"})
+	writeFilesCommit(t, store, hashes, "two", 2, map[string]string{"f": "two\n", "g": "same\n"}, "one")
+	assert.NoError(t, checkoutCommit(root, store, checkoutTarget{commitHash: hashes["two"], branchRef: BRANCH_PREFIX + "main"}))
+	assert.NoError(t, writeRef(root, BRANCH_PREFIX+"main", hashes["two"]))
+	assert.NoError(t, writeRef(root, BRANCH_PREFIX+"other", hashes["one"]))
+	chdir(t, root)
+	return root, store, hashes
+}
+
+func TestCheckoutAndSwitch(t *testing.T) {
+	writeFile := func(rel, content string) func(root string, commits map[string]string) {
+		return func(root string, commits map[string]string) {
+			assert.NoError(t, os.WriteFile(filepath.Join(root, rel), []byte(content), 0644))
+		}
+	}
+	// otherWith points other at a child of two that also holds files.
+	otherWith := func(files map[string]string) func(root string, commits map[string]string) {
+		return func(root string, commits map[string]string) {
+			files["f"], files["g"] = "two\n", "same\n"
+			writeFilesCommit(t, NewObjectStore(root), commits, "three", 3, files, "two")
+			assert.NoError(t, writeRef(root, BRANCH_PREFIX+"other", commits["three"]))
+		}
+	}
+	for _, tc := range []struct {
+		name      string
+		command   string // checkout or switch
+		args      []string
+		prepare   func(root string, commits map[string]string)
+		wantErr   string
+		wantHead  string // "" when detached
+		wantAt    string
+		wantFiles map[string]string // "" for a missing file
+		wantRefs  map[string]string
+		wantIndex []string
+	}{
+		{
+			name: "checkout -b", command: "checkout", args: []string{"-b", "new"},
+			wantHead: "new", wantAt: "two", wantFiles: map[string]string{"f": "two\n"},
+		},
+		{
+			name: "checkout -b at start point", command: "checkout", args: []string{"-b", "new", "other"},
+			wantHead: "new", wantAt: "one", wantFiles: map[string]string{"f": "one\n"},
+			wantRefs: map[string]string{"main": "two", "other": "one"},
+		},
+		{
+			name: "checkout -b existing", command: "checkout", args: []string{"-b", "other"},
+			wantErr:  "a branch named 'other' already exists",
+			wantHead: "main", wantAt: "two", wantRefs: map[string]string{"other": "one"},
+		},
+		{
+			name: "checkout -b unwritable ref", command: "checkout", args: []string{"-b", "other/new"},
+			wantErr:  "other",
+			wantHead: "main", wantAt: "two", wantRefs: map[string]string{"main": "two", "other": "one"},
+		},
+		{
+			name: "checkout -B existing", command: "checkout", args: []string{"-B", "other"},
+			wantHead: "other", wantAt: "two", wantFiles: map[string]string{"f": "two\n"},
+		},
+		{
+			name: "switch -c", command: "switch", args: []string{"-c", "new", "other"},
+			wantHead: "new", wantAt: "one", wantFiles: map[string]string{"f": "one\n"},
+		},
+		{
+			name: "switch -C existing", command: "switch", args: []string{"-C", "other", "main~1"},
+			wantHead: "other", wantAt: "one", wantFiles: map[string]string{"f": "one\n"},
+		},
+		{
+			name: "checkout branch", command: "checkout", args: []string{"other"},
+			wantHead: "other", wantAt: "one", wantFiles: map[string]string{"f": "one\n", "g": "same\n"},
+		},
+		{
+			name: "checkout detaches at a commit", command: "checkout", args: []string{"main~1"},
+			wantAt: "one", wantFiles: map[string]string{"f": "one\n"},
+		},
+		{
+			name: "switch needs --detach", command: "switch", args: []string{"main~1"},
+			wantErr:  "a branch is expected, got 'main~1'",
+			wantHead: "main", wantAt: "two",
+		},
+		{
+			name: "switch --detach", command: "switch", args: []string{"--detach", "main~1"},
+			wantAt: "one", wantFiles: map[string]string{"f": "one\n"},
+		},
+		{
+			name: "local change refused", command: "checkout", args: []string{"other"},
+			prepare:  writeFile("f", "local\n"),
+			wantErr:  ERROR_LOCAL_CHANGES.Error(),
+			wantHead: "main", wantAt: "two", wantFiles: map[string]string{"f": "local\n"},
+		},
+		{
+			name: "refused -C keeps the branch", command: "switch", args: []string{"-C", "other", "main~1"},
+			prepare: func(root string, commits map[string]string) {
+				assert.NoError(t, writeRef(root, BRANCH_PREFIX+"other", commits["two"]))
+				writeFile("f", "local\n")(root, commits)
+			},
+			wantErr:  ERROR_LOCAL_CHANGES.Error(),
+			wantHead: "main", wantAt: "two", wantFiles: map[string]string{"f": "local\n"},
+			wantRefs: map[string]string{"other": "two"},
+		},
+		{
+			name: "local change carried over", command: "switch", args: []string{"other"},
+			prepare:  writeFile("g", "mine\n"),
+			wantHead: "other", wantAt: "one", wantFiles: map[string]string{"f": "one\n", "g": "mine\n"},
+		},
+		{
+			name: "staged deletion kept", command: "switch", args: []string{"other"},
+			prepare: func(root string, commits map[string]string) {
+				lines, _, err := readIndex(root)
+				assert.NoError(t, err)
+				assert.NoError(t, writeIndexFile(indexFilePath(root), 0, lines[:1]))
+				assert.NoError(t, os.Remove(filepath.Join(root, "g")))
+			},
+			wantHead: "other", wantAt: "one", wantFiles: map[string]string{"f": "one\n", "g": ""},
+			wantIndex: []string{"f"},
+		},
+		{
+			name: "untracked file in a directory the target replaces", command: "switch", args: []string{"other"},
+			prepare: func(root string, commits map[string]string) {
+				otherWith(map[string]string{"d": "file\n"})(root, commits)
+				assert.NoError(t, os.Mkdir(filepath.Join(root, "d"), 0755))
+				writeFile("d/untracked", "keep\n")(root, commits)
+			},
+			wantErr:  "the following untracked working tree files would be removed by checkout:\n\td/untracked\n",
+			wantHead: "main", wantAt: "two", wantFiles: map[string]string{"d/untracked": "keep\n"},
+		},
+		{
+			name: "untracked file where the target needs a directory", command: "switch", args: []string{"other"},
+			prepare: func(root string, commits map[string]string) {
+				otherWith(map[string]string{"d/x": "x\n", "e": "e\n"})(root, commits)
+				writeFile("d", "keep\n")(root, commits)
+			},
+			wantErr:  "the following untracked working tree files would be overwritten by checkout:\n\td\n",
+			wantHead: "main", wantAt: "two", wantFiles: map[string]string{"d": "keep\n", "e": ""},
+		},
+		{
+			name: "tracked directory replaced by a file", command: "switch", args: []string{"other"},
+			prepare: func(root string, commits map[string]string) {
+				otherWith(map[string]string{"d": "file\n"})(root, commits)
+				store := NewObjectStore(root)
+				writeFilesCommit(t, store, commits, "dir", 4, map[string]string{"f": "two\n", "g": "same\n", "d/x": "x\n"}, "two")
+				assert.NoError(t, checkoutCommit(root, store, checkoutTarget{commitHash: commits["dir"], branchRef: BRANCH_PREFIX + "main"}))
+				assert.NoError(t, writeRef(root, BRANCH_PREFIX+"main", commits["dir"]))
+			},
+			wantHead: "other", wantAt: "three", wantFiles: map[string]string{"d": "file\n"},
+			wantIndex: []string{"d", "f", "g"},
+		},
+	} {
+		root, store, commits := newCheckoutRepo(t)
+		if tc.prepare != nil {
+			tc.prepare(root, commits)
+		}
+
+		var err error
+		if tc.command == "switch" {
+			err = runCheckout(tc.args, "-c", false)
+		} else {
+			err = runCheckout(tc.args, "-b", true)
+		}
+		if tc.wantErr != "" {
+			assert.ErrorContains(t, err, tc.wantErr, tc.name)
+		} else {
+			assert.NoError(t, err, tc.name)
+		}
+
+		ref, hash, err := readHEAD(root)
+		assert.NoError(t, err)
+		if tc.wantHead == "" {
+			assert.Equal(t, "", ref, tc.name)
+		} else {
+			assert.Equal(t, BRANCH_PREFIX+tc.wantHead, ref, tc.name)
+		}
+		assert.Equal(t, commits[tc.wantAt], hash, tc.name)
+
+		for rel, want := range tc.wantFiles {
+			content, err := os.ReadFile(filepath.Join(root, rel))
+			if want == "" {
+				assert.True(t, os.IsNotExist(err), tc.name+": "+rel)
+				continue
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, want, string(content), tc.name+": "+rel)
+		}
+		for branch, want := range tc.wantRefs {
+			got, err := readRef(root, BRANCH_PREFIX+branch)
+			assert.NoError(t, err)
+			assert.Equal(t, commits[want], got, tc.name+": "+branch)
+		}
+
+		// local changes stay unstaged, so the index matches the commit
+		lines, _, err := readIndex(root)
+		assert.NoError(t, err)
+		next, err := ParseCommit(store, hash)
+		assert.NoError(t, err)
+		var paths []string
+		for _, line := range lines {
+			assert.Equal(t, next.TreePaths[line.Fullpath], line.BlobHash, tc.name+": "+line.Fullpath)
+			paths = append(paths, line.Fullpath)
+		}
+		if tc.wantIndex == nil {
+			tc.wantIndex = []string{"f", "g"}
+		}
+		assert.Equal(t, tc.wantIndex, paths, tc.name)
+	}
+}
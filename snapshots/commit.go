@@ -13,14 +13,15 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"time"
 )
 
 type ContentType string
 
 const (
-	Blob ContentType = "blob"
-	Tree ContentType = "tree"
+	Blob       ContentType = "blob"
+	Tree       ContentType = "tree"
+	CommitType ContentType = "commit"
+	TagType    ContentType = "tag"
 )
 
 type CommitTree struct {
@@ -32,9 +33,9 @@ type CommitTree struct {
 
 type Commit struct {
 	tree     string
-	parent   string
-	author   []string
-	commiter []string
+	parents  []string
+	author   Signature
+	commiter Signature
 	message  string
 }
 
@@ -42,6 +43,7 @@ type TreePaths struct {
 	commitHash string
 	treeHash   string
 	TreePaths  map[string]string
+	FileModes  map[string]uint32
 }
 
 var (
@@ -49,41 +51,73 @@ var (
 	ERROR_MALFORMED_COMMIT_FORMAT = fmt.Errorf("malformed commit format")
 )
 
+// parseCommit reads the headers and message of a commit object.
+func parseCommit(content []byte) (*Commit, error) {
+	headers, message, _ := strings.Cut(string(content), "\n\n")
+	commit := &Commit{message: message}
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		var err error
+		switch key {
+		case "tree":
+			commit.tree = value
+		case "parent":
+			commit.parents = append(commit.parents, value)
+		case "author":
+			commit.author, err = parseSignature(value)
+		case "committer":
+			commit.commiter, err = parseSignature(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if commit.tree == "" {
+		return nil, ERROR_MALFORMED_COMMIT_FORMAT
+	}
+	return commit, nil
+}
+
+func readCommit(store ObjectStore, hash string) (*Commit, error) {
+	objType, content, err := store.Read(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != CommitType {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", hash, objType)
+	}
+	return parseCommit(content)
+}
+
 func NewTreePaths() TreePaths {
 	return TreePaths{
 		TreePaths: make(map[string]string),
+		FileModes: make(map[string]uint32),
 	}
 }
 
-func (t *TreePaths) parseTreeFile(r io.Reader, gitRoot, treePath string) error {
-	reader := bufio.NewReader(r)
-	for {
-		line, err := reader.ReadString('\n')
-		if err == io.EOF {
-			return nil
-		}
-		if err != nil {
-			return err
-		}
-		trimLine := strings.TrimSuffix(line, "\n")
-		parts := strings.SplitN(trimLine, "\t", 4)
-		if len(parts) != 4 {
-			return ERROR_MALFORMED_TREE_FORMAT
-		}
-		filePath := filepath.Join(treePath, parts[3])
-		if parts[1] == "tree" {
-			treeHash := strings.TrimSpace(parts[2])
-			treeHashParts := []string{treeHash[:2], treeHash[2:]}
-			if len(treeHashParts) != 2 {
-				return ERROR_MALFORMED_COMMIT_FORMAT
-			}
-			treeHashFilePath := filepath.Join(gitRoot, ROOTDIR, "objects", treeHashParts[0], treeHashParts[1])
-			treeHashFile, err := os.Open(treeHashFilePath)
+func (t *TreePaths) parseTreeFile(r io.Reader, store ObjectStore, treePath string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	entries, err := decodeTree(data)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		filePath := filepath.Join(treePath, entry.Name)
+		if entry.contentType == Tree {
+			_, _, treeHashFile, err := store.Stream(entry.Hash)
 			if err != nil {
 				return err
 			}
 
-			if err := t.parseTreeFile(treeHashFile, gitRoot, filePath); err != nil {
+			if err := t.parseTreeFile(treeHashFile, store, filePath); err != nil {
+				treeHashFile.Close()
 				return err
 			}
 
@@ -93,11 +127,17 @@ func (t *TreePaths) parseTreeFile(r io.Reader, gitRoot, treePath string) error {
 
 		// assigning blob to tree path, which is useful
 		// when comparing with index lines
-		t.TreePaths[filePath] = parts[2]
+		t.TreePaths[filePath] = entry.Hash
+		mode, err := strconv.ParseUint(entry.fileMode, 8, 32)
+		if err != nil {
+			return ERROR_MALFORMED_TREE_FORMAT
+		}
+		t.FileModes[filePath] = uint32(mode)
 	}
+	return nil
 }
 
-func (tp *TreePaths) parseCommitFile(r io.Reader, basePath string) error {
+func (tp *TreePaths) parseCommitFile(r io.Reader, store ObjectStore) error {
 	treeReader := bufio.NewReader(r)
 
 	treeLine, err := treeReader.ReadString('\n')
@@ -113,68 +153,66 @@ func (tp *TreePaths) parseCommitFile(r io.Reader, basePath string) error {
 		return ERROR_MALFORMED_COMMIT_FORMAT
 	}
 	treeHash := strings.TrimSpace(treeParts[1])
-	treeHashParts := []string{treeHash[:2], treeHash[2:]}
-	if len(treeHashParts) != 2 {
-		return ERROR_MALFORMED_COMMIT_FORMAT
-	}
 	tp.treeHash = treeHash
 
-	treeHashFilePath := basePath + ROOTDIR + "objects/" + treeHashParts[0] + "/" + treeHashParts[1]
-	treeHashFile, err := os.Open(treeHashFilePath)
+	_, _, treeHashFile, err := store.Stream(treeHash)
 	if err != nil {
 		return err
 	}
 	defer treeHashFile.Close()
 
-	if err := tp.parseTreeFile(treeHashFile, basePath, ""); err != nil {
+	if err := tp.parseTreeFile(treeHashFile, store, ""); err != nil {
 		return err
 	}
 	return nil
 }
 
+// GetPreviousCommitHash returns the commit HEAD resolves to,
+// or io.EOF when there are no commits yet.
 func GetPreviousCommitHash(gitBasePath string) (string, error) {
-	fi, err := os.Open(gitBasePath + ROOTDIR + "HEAD")
-	if err != nil {
-		return "", err
-	}
-	defer fi.Close()
-
-	reader := bufio.NewReader(fi)
-
-	commitHash, err := reader.ReadString('\n')
-	if err != nil {
-		return "", err
-	}
-
-	commitTrimHash := strings.TrimSpace(commitHash)
-	return commitTrimHash, nil
+	return resolveHEAD(gitBasePath)
 }
 
-func ParseHeadAndCommitFile(basePath string) (TreePaths, error) {
-	commitTrimHash, err := GetPreviousCommitHash(basePath)
+// ParseCommit flattens the tree of commitHash into TreePaths.
+func ParseCommit(store ObjectStore, commitHash string) (TreePaths, error) {
+	_, _, commitFile, err := store.Stream(commitHash)
 	if err != nil {
 		return TreePaths{}, err
 	}
+	defer commitFile.Close()
 
-	parts := []string{commitTrimHash[:2], commitTrimHash[2:]}
-	if len(parts) != 2 {
-		return TreePaths{}, ERROR_MALFORMED_COMMIT_FORMAT
+	treePaths := NewTreePaths()
+	treePaths.commitHash = commitHash
+	if err := treePaths.parseCommitFile(commitFile, store); err != nil {
+		return TreePaths{}, err
 	}
-	commitFilePath := basePath + ROOTDIR + "objects/" + parts[0] + "/" + parts[1]
-	commitFile, err := os.Open(commitFilePath)
+	return treePaths, nil
+}
+
+// ParseTree flattens the tree treeHash into TreePaths.
+func ParseTree(store ObjectStore, treeHash string) (TreePaths, error) {
+	_, _, treeFile, err := store.Stream(treeHash)
 	if err != nil {
 		return TreePaths{}, err
 	}
-	defer commitFile.Close()
+	defer treeFile.Close()
 
 	treePaths := NewTreePaths()
-	treePaths.commitHash = commitTrimHash
-	if err := treePaths.parseCommitFile(commitFile, basePath); err != nil {
+	treePaths.treeHash = treeHash
+	if err := treePaths.parseTreeFile(treeFile, store, ""); err != nil {
 		return TreePaths{}, err
 	}
 	return treePaths, nil
 }
 
+func ParseHeadAndCommitFile(basePath string, store ObjectStore) (TreePaths, error) {
+	commitTrimHash, err := GetPreviousCommitHash(basePath)
+	if err != nil {
+		return TreePaths{}, err
+	}
+	return ParseCommit(store, commitTrimHash)
+}
+
 //
 // func groupIndexByDir(index []IndexLine) map[string][]IndexLine {
 // 	dirs := make(map[string][]IndexLine)
@@ -201,70 +239,14 @@ func ParseHeadAndCommitFile(basePath string) (TreePaths, error) {
 //
 
 func writeTreeObject(
-	gitRoot string,
+	store ObjectStore,
 	entries []CommitTree,
 ) (string, error) {
-
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Name < entries[j].Name
-	})
-
-	var buf strings.Builder
-	for _, e := range entries {
-		fmt.Fprintf(&buf, "%s\t%s\t%s\t%s\n",
-			e.fileMode,
-			e.contentType,
-			e.Hash,
-			e.Name,
-		)
-	}
-
-	content := buf.String()
-	header := fmt.Sprintf("tree %d\x00", len(content))
-	hash := hashBytes([]byte(header + content))
-
-	objPath := objectPath(gitRoot, hash)
-	if err := writeObject(objPath, content); err != nil {
-		return "", err
-	}
-
-	return hash, nil
-}
-
-func writeObject(path string, content string) error {
-	dir := filepath.Dir(path)
-
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
-
-	// If object already exists, do nothing (Git behavior)
-	if _, err := os.Stat(path); err == nil {
-		return nil
-	}
-
-	tmp := path + ".tmp"
-	f, err := os.Create(tmp)
+	content, err := encodeTree(entries)
 	if err != nil {
-		return err
-	}
-
-	if _, err := f.WriteString(content); err != nil {
-		f.Close()
-		return err
-	}
-
-	if err := f.Close(); err != nil {
-		return err
+		return "", err
 	}
-
-	return os.Rename(tmp, path)
-}
-
-func objectPath(gitRoot, hash string) string {
-	dir := hash[:2]
-	file := hash[2:]
-	return filepath.Join(gitRoot, ROOTDIR, "objects", dir, file)
+	return store.Write(Tree, content)
 }
 
 func hashBytes(data []byte) string {
@@ -274,7 +256,8 @@ func hashBytes(data []byte) string {
 }
 
 func getAllDirs(index []IndexLine) []string {
-	dirSet := make(map[string]bool)
+	// the root is always written, as the empty tree for an empty index
+	dirSet := map[string]bool{".": true}
 	for _, line := range index {
 		dir := filepath.Dir(line.Fullpath)
 		// Traverse up to the root and add every parent directory
@@ -292,11 +275,18 @@ func getAllDirs(index []IndexLine) []string {
 		dirs = append(dirs, d)
 	}
 
-	// Sort by length descending to ensure deepest paths come first
-	// This ensures "a/b/c" is processed before "a/b", and "a/b" before "a"
+	// Sort by depth descending to ensure deepest paths come first
+	// This ensures "a/b/c" is processed before "a/b", "a/b" before "a"
+	// and every directory before the root "."
+	depth := func(dir string) int {
+		if dir == "." {
+			return -1
+		}
+		return strings.Count(dir, "/")
+	}
 	sort.Slice(dirs, func(i, j int) bool {
 		// Count slashes first, then string length for precision
-		cI, cJ := strings.Count(dirs[i], "/"), strings.Count(dirs[j], "/")
+		cI, cJ := depth(dirs[i]), depth(dirs[j])
 		if cI != cJ {
 			return cI > cJ
 		}
@@ -306,7 +296,7 @@ func getAllDirs(index []IndexLine) []string {
 }
 
 func buildTreesFromIndex(
-	gitRoot string,
+	store ObjectStore,
 	index []IndexLine,
 ) (string, error) {
 
@@ -341,7 +331,7 @@ func buildTreesFromIndex(
 		for childPath, childHash := range treeHashes {
 			if filepath.Dir(childPath) == dir && childPath != dir {
 				entries = append(entries, CommitTree{
-					fileMode:    "40000",
+					fileMode:    TreeMode,
 					Name:        filepath.Base(childPath),
 					Hash:        childHash,
 					contentType: Tree,
@@ -349,7 +339,7 @@ func buildTreesFromIndex(
 			}
 		}
 
-		treeHash, err := writeTreeObject(gitRoot, entries)
+		treeHash, err := writeTreeObject(store, entries)
 		if err != nil {
 			return "", err
 		}
@@ -360,160 +350,126 @@ func buildTreesFromIndex(
 	return treeHashes["."], nil
 }
 
-func compareAndFindStagedFiles(gitRootPath, message string) error {
+// compareAndFindStagedFiles commits the index on top of HEAD. The
+// author, committer and message come from commit; tree and parents
+// are filled in here.
+func compareAndFindStagedFiles(gitRootPath string, commit *Commit) error {
 	staged := NewStaged()
 
 	staged.baseRoot = gitRootPath
 	if err := staged.parseIndexFile(); err != nil {
 		return err
 	}
-	treePaths, err := ParseHeadAndCommitFile(gitRootPath)
-	if err != io.EOF && err != nil {
-		return nil
-	}
-
-	stagedCount := 0
-	for k, _ := range staged.indexMap {
-		if _, ok := treePaths.TreePaths[k]; !ok {
-			stagedCount++
-		}
-	}
-
-	if stagedCount == 0 {
-		fmt.Println("On branch main")
-		fmt.Println("Your branch is up to date")
-		fmt.Println("Nothing to commit, working tree clean")
-		return nil
+	indexMap, unmerged := splitIndex(staged.IndexLines)
+	if len(unmerged) > 0 {
+		return fmt.Errorf("committing is not possible because you have unmerged files")
 	}
 
-	if err == io.EOF {
-		treeHash, err := buildTreesFromIndex(gitRootPath, staged.IndexLines)
-		if err != nil {
-			return err
-		}
-		commitHash, err := writeCommit(gitRootPath, treeHash, "", message)
-		if err != nil {
-			return err
-		}
-
-		return updateHEAD(gitRootPath, commitHash)
-	}
+	store := NewObjectStore(gitRootPath)
+	headLine, err := headDescription(gitRootPath)
 	if err != nil {
-		fmt.Println("eof error")
 		return err
 	}
-	changed := false
-
-	for path, idx := range staged.indexMap {
-		idxLine := staged.IndexLines[idx]
-
-		if headHash, ok := treePaths.TreePaths[path]; !ok {
-			changed = true
-			break
-		} else if headHash != idxLine.BlobHash {
-			changed = true
-			break
-		}
-	}
-
-	if !changed {
-		for path := range treePaths.TreePaths {
-			if _, ok := staged.indexMap[path]; !ok {
-				changed = true
-				break
-			}
-		}
+	treePaths, err := ParseHeadAndCommitFile(gitRootPath, store)
+	if err == io.EOF {
+		treePaths = NewTreePaths()
+	} else if err != nil {
+		return err
 	}
 
-	if !changed {
-		fmt.Println("On branch main")
+	// a merge is committed even when it changes nothing
+	merging := mergeInProgress(gitRootPath)
+	if !merging && len(compareHeadToIndex(treePaths, indexMap)) == 0 {
+		fmt.Println(headLine)
 		fmt.Println("nothing to commit, working tree clean")
 		return nil
 	}
 
-	treeHash, err := buildTreesFromIndex(gitRootPath, staged.IndexLines)
+	treeHash, err := buildTreesFromIndex(store, staged.IndexLines)
 	if err != nil {
 		return err
 	}
 
-	if treeHash == treePaths.treeHash {
-		return nil
+	commit.tree = treeHash
+	if treePaths.commitHash != "" {
+		commit.parents = []string{treePaths.commitHash}
 	}
-
-	commitHash, err := writeCommit(gitRootPath, treeHash, treePaths.commitHash, message)
+	if merging {
+		mergeHead, err := readRef(gitRootPath, MERGE_HEAD)
+		if err != nil {
+			return err
+		}
+		commit.parents = append(commit.parents, mergeHead)
+	}
+	commitHash, err := writeCommit(store, commit)
 	if err != nil {
 		return err
 	}
 
-	return updateHEAD(gitRootPath, commitHash)
+	if err := updateHEAD(gitRootPath, commitHash); err != nil {
+		return err
+	}
+	if merging {
+		return clearMergeState(gitRootPath)
+	}
+	return nil
 }
 
-func writeCommit(
-	gitRoot string,
-	treeHash string,
-	parentHash string,
-	message string,
-) (string, error) {
-
-	now := time.Now()
-	timestamp := strconv.FormatInt(now.Unix(), 10)
-	timezone := now.Format("-0700")
-
+// encodeCommit serializes a commit object: headers, a blank line
+// and the message.
+func encodeCommit(commit *Commit) []byte {
 	var buf strings.Builder
 
 	// tree is mandatory
 	buf.WriteString("tree ")
-	buf.WriteString(treeHash)
+	buf.WriteString(commit.tree)
 	buf.WriteByte('\n')
 
-	// parent is optional (first commit)
-	if parentHash != "" {
+	// parents are optional (first commit), merges have several
+	for _, parent := range commit.parents {
 		buf.WriteString("parent ")
-		buf.WriteString(parentHash)
+		buf.WriteString(parent)
 		buf.WriteByte('\n')
 	}
 
-	// author
 	buf.WriteString("author ")
-	buf.WriteString("Your Name <you@example.com> ")
-	buf.WriteString(timestamp)
-	buf.WriteByte(' ')
-	buf.WriteString(timezone)
+	buf.WriteString(commit.author.String())
 	buf.WriteByte('\n')
 
-	// committer
 	buf.WriteString("committer ")
-	buf.WriteString("Your Name <you@example.com> ")
-	buf.WriteString(timestamp)
-	buf.WriteByte(' ')
-	buf.WriteString(timezone)
+	buf.WriteString(commit.commiter.String())
 	buf.WriteString("\n\n")
 
 	// commit message
-	buf.WriteString(message)
-	buf.WriteByte('\n')
-
-	content := buf.String()
-
-	header := fmt.Sprintf("commit %d\x00", len(content))
-	hash := hashBytes([]byte(header + content))
-
-	objPath := objectPath(gitRoot, hash)
-	if err := writeObject(objPath, content); err != nil {
-		return "", err
+	buf.WriteString(commit.message)
+	if !strings.HasSuffix(commit.message, "\n") {
+		buf.WriteByte('\n')
 	}
+	return []byte(buf.String())
+}
 
-	return hash, nil
+func writeCommit(store ObjectStore, commit *Commit) (string, error) {
+	return store.Write(CommitType, encodeCommit(commit))
 }
 
+// updateHEAD advances the checked out branch to commitHash,
+// or moves HEAD itself when it is detached.
 func updateHEAD(gitRoot string, commitHash string) error {
-	headPath := filepath.Join(gitRoot, ROOTDIR, "HEAD")
-	return os.WriteFile(headPath, []byte(commitHash+"\n"), 0644)
+	ref, _, err := readHEAD(gitRoot)
+	if err != nil {
+		return err
+	}
+	if ref == "" {
+		return detachHEAD(gitRoot, commitHash)
+	}
+	return writeRef(gitRoot, ref, commitHash)
 }
 
 func HandleCommitCommand() error {
 	fs := flag.NewFlagSet("commit", flag.ExitOnError)
 	msg := fs.String("m", "", "commit message")
+	author := fs.String("author", "", "override the commit author, as 'Name <email>'")
+	date := fs.String("date", "", "override the author date")
 
 	fs.Parse(os.Args[2:])
 	args := fs.Args()
@@ -521,10 +477,6 @@ func HandleCommitCommand() error {
 	if len(args) > 0 {
 		log.Fatalf("invalid command argument: %s\n", args[0])
 	}
-	if len(*msg) < 1 {
-		return fmt.Errorf("empty commit message")
-	}
-
 	path, err := os.Getwd()
 	if err != nil {
 		return err
@@ -538,7 +490,31 @@ func HandleCommitCommand() error {
 		return fmt.Errorf("outside of Git repository")
 	}
 
-	if err := compareAndFindStagedFiles(fullpath, *msg); err != nil {
+	// concluding a merge may take the message git merge left
+	if len(*msg) < 1 && mergeInProgress(fullpath) {
+		if *msg, err = readMergeMessage(fullpath); err != nil {
+			return err
+		}
+	}
+	if len(*msg) < 1 {
+		return fmt.Errorf("empty commit message")
+	}
+
+	cfg, err := LoadConfig(fullpath)
+	if err != nil {
+		return err
+	}
+	authorSig, committerSig, err := commitIdentities(cfg, *author, *date)
+	if err != nil {
+		return err
+	}
+
+	commit := &Commit{
+		author:   authorSig,
+		commiter: committerSig,
+		message:  *msg,
+	}
+	if err := compareAndFindStagedFiles(fullpath, commit); err != nil {
 		return err
 	}
 
@@ -1 +1,53 @@
 package snapshots
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTreesAndCommitInMemory(t *testing.T) {
+	store := NewMemoryStore()
+	blobA, _ := store.Write(Blob, []byte("hello\n"))
+	blobB, _ := store.Write(Blob, []byte("world\n"))
+
+	index := []IndexLine{
+		{Fullpath: "a.txt", BlobHash: blobA, FileMode: 0100644},
+		{Fullpath: "dir/b.txt", BlobHash: blobB, FileMode: 0100644},
+	}
+	treeHash, err := buildTreesFromIndex(store, index)
+	assert.NoError(t, err)
+	assert.True(t, store.Has(treeHash))
+
+	commitHash, err := writeCommit(store, &Commit{tree: treeHash, message: "first"})
+	assert.NoError(t, err)
+
+	treePaths, err := ParseCommit(store, commitHash)
+	assert.NoError(t, err)
+	assert.Equal(t, treeHash, treePaths.treeHash)
+	assert.Equal(t, map[string]string{
+		"a.txt":     blobA,
+		"dir/b.txt": blobB,
+	}, treePaths.TreePaths)
+}
+
+func TestBuildTreesFromEmptyIndex(t *testing.T) {
+	store := NewMemoryStore()
+	treeHash, err := buildTreesFromIndex(store, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "4b825dc642cb6eb9a060e54bf8d69288fbee4904", treeHash)
+	assert.True(t, store.Has(treeHash))
+
+	commitHash, err := writeCommit(store, &Commit{tree: treeHash, message: "empty"})
+	assert.NoError(t, err)
+	treePaths, err := ParseCommit(store, commitHash)
+	assert.NoError(t, err)
+	assert.Equal(t, treeHash, treePaths.treeHash)
+	assert.Empty(t, treePaths.TreePaths)
+}
+
+func TestMemoryStoreMissingObject(t *testing.T) {
+	store := NewMemoryStore()
+	_, _, err := store.Read("0000000000000000000000000000000000000000")
+	assert.ErrorIs(t, err, ERROR_OBJECT_NOT_FOUND)
+}
@@ -0,0 +1,88 @@
+package snapshots
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bibektamang7/own-git/ini"
+)
+
+const GLOBAL_CONFIG string = ".owngitconfig"
+
+// Config layers the repository config over the global ~/.owngitconfig.
+type Config struct {
+	files []*ini.FileINI // lowest priority first
+}
+
+func loadINIFile(path string) (*ini.FileINI, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	fINI := ini.NewFileINI()
+	if err := fINI.ParseINIFile(f); err != nil {
+		return nil, err
+	}
+	return fINI, nil
+}
+
+func globalConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, GLOBAL_CONFIG)
+}
+
+// LoadConfig reads the global config and, when gitRoot is set,
+// the repository config on top of it.
+func LoadConfig(gitRoot string) (*Config, error) {
+	cfg := &Config{}
+	paths := []string{globalConfigPath()}
+	if gitRoot != "" {
+		paths = append(paths, filepath.Join(gitRoot, ROOTDIR, "config"))
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		fINI, err := loadINIFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if fINI != nil {
+			cfg.files = append(cfg.files, fINI)
+		}
+	}
+	return cfg, nil
+}
+
+// Get returns the value of "section.key" from the most specific
+// file that sets it. Keys are matched case-insensitively like git.
+func (c *Config) Get(name string) string {
+	section, key, ok := strings.Cut(name, ".")
+	if !ok {
+		return ""
+	}
+	for i := len(c.files) - 1; i >= 0; i-- {
+		for _, candidate := range []string{key, strings.ToLower(key)} {
+			if value := c.files[i].Get(section, candidate); value != "" {
+				return unquoteConfigValue(value)
+			}
+		}
+	}
+	return ""
+}
+
+func unquoteConfigValue(value string) string {
+	if len(value) >= 2 && strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
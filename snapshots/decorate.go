@@ -0,0 +1,210 @@
+package snapshots
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// decoration styles, as named by --decorate
+const (
+	DECORATE_NO    = "no"
+	DECORATE_SHORT = "short"
+	DECORATE_FULL  = "full"
+	DECORATE_AUTO  = "auto" // short on a terminal, otherwise no
+)
+
+const REMOTE_PREFIX = "refs/remotes/"
+
+// defaultDecorationRefs are the namespaces decorated when neither
+// --decorate-refs nor --decorate-refs-exclude is given.
+var defaultDecorationRefs = []string{"HEAD", "refs/heads", "refs/tags", "refs/remotes", "refs/stash"}
+
+// parseDecorate reads the value of --decorate or log.decorate.
+func parseDecorate(value string) (string, error) {
+	switch value {
+	case DECORATE_NO, DECORATE_SHORT, DECORATE_FULL, DECORATE_AUTO:
+		return value, nil
+	case "false":
+		return DECORATE_NO, nil
+	case "true":
+		return DECORATE_SHORT, nil
+	}
+	return "", fmt.Errorf("invalid --decorate option: %s", value)
+}
+
+// decorationFilter holds the patterns of --decorate-refs and
+// --decorate-refs-exclude.
+type decorationFilter struct {
+	include []string
+	exclude []string
+}
+
+// normalizeRefPattern makes pattern a full ref name the way git does:
+// "heads" and "heads/" both mean refs/heads.
+func normalizeRefPattern(pattern string) string {
+	if !strings.HasPrefix(pattern, "refs/") && pattern != "HEAD" {
+		pattern = "refs/" + pattern
+	}
+	return strings.TrimSuffix(pattern, "/")
+}
+
+func (f *decorationFilter) Include(pattern string) {
+	f.include = append(f.include, normalizeRefPattern(pattern))
+}
+
+func (f *decorationFilter) Exclude(pattern string) {
+	f.exclude = append(f.exclude, normalizeRefPattern(pattern))
+}
+
+// matchRefPattern matches a pattern without wildcards as a prefix of
+// whole components, and a pattern with them as a glob where '*' also
+// matches '/'.
+func matchRefPattern(pattern, name string) bool {
+	if !strings.ContainsAny(pattern, "*?[") {
+		rest, ok := strings.CutPrefix(name, pattern)
+		return ok && (rest == "" || rest[0] == '/')
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	return err == nil && re.MatchString(name)
+}
+
+// matches reports whether the ref name should be decorated. Excludes
+// win over includes, and no patterns at all means the default
+// namespaces.
+func (f *decorationFilter) matches(name string) bool {
+	include := f.include
+	if len(f.include) == 0 && len(f.exclude) == 0 {
+		include = defaultDecorationRefs
+	}
+	for _, pattern := range f.exclude {
+		if matchRefPattern(pattern, name) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if matchRefPattern(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// decorations maps commit hashes to the refs pointing at them.
+type decorations struct {
+	refs       map[string][]string // full ref names, newest-sorted first
+	headBranch string              // the branch HEAD points at, if any
+	full       bool                // show full ref names
+}
+
+// loadDecorations reads every ref and HEAD the filter lets through,
+// peeling annotated tags down to the commit they tag.
+func loadDecorations(gitRoot string, store ObjectStore, filter *decorationFilter, full bool) (*decorations, error) {
+	d := &decorations{refs: make(map[string][]string), full: full}
+	refs, err := listRefs(gitRoot, "refs/")
+	if err != nil {
+		return nil, err
+	}
+	// git lists the refs of a commit in reverse name order
+	for i := len(refs) - 1; i >= 0; i-- {
+		ref := refs[i]
+		if !filter.matches(ref.name) {
+			continue
+		}
+		hash, err := peel(store, ref.hash, "")
+		if err != nil {
+			continue // a ref to a missing object decorates nothing
+		}
+		d.refs[hash] = append(d.refs[hash], ref.name)
+	}
+
+	if filter.matches("HEAD") {
+		branch, hash, err := readHEAD(gitRoot)
+		if err != nil {
+			return nil, err
+		}
+		if hash != "" {
+			d.headBranch = branch
+			d.refs[hash] = append([]string{"HEAD"}, d.refs[hash]...)
+		}
+	}
+	return d, nil
+}
+
+// shortName is how a ref shows without --decorate=full.
+func shortName(name string) string {
+	for _, prefix := range []string{BRANCH_PREFIX, TAG_PREFIX, REMOTE_PREFIX} {
+		if short, ok := strings.CutPrefix(name, prefix); ok {
+			return short
+		}
+	}
+	return name
+}
+
+// format lists the refs pointing at hash, as in "HEAD -> main, tag: v1".
+// HEAD swallows the branch it points at.
+func (d *decorations) format(hash string) string {
+	if d == nil {
+		return ""
+	}
+	names := d.refs[hash]
+	current := false
+	if len(names) > 0 && names[0] == "HEAD" {
+		for _, name := range names[1:] {
+			if name == d.headBranch && strings.HasPrefix(name, BRANCH_PREFIX) {
+				current = true
+			}
+		}
+	}
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		if current && name == d.headBranch {
+			continue
+		}
+		shown := name
+		if !d.full {
+			shown = shortName(name)
+		}
+		switch {
+		case name == "HEAD" && current:
+			branch := d.headBranch
+			if !d.full {
+				branch = shortName(branch)
+			}
+			shown = "HEAD -> " + branch
+		case strings.HasPrefix(name, TAG_PREFIX):
+			shown = "tag: " + shown
+		}
+		parts = append(parts, shown)
+	}
+	return strings.Join(parts, ", ")
+}
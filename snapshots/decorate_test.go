@@ -0,0 +1,95 @@
+package snapshots
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecorations(t *testing.T) {
+	root := t.TempDir()
+	store := NewMemoryStore()
+	hashes := writeHistory(t, store)
+	tag, err := store.Write(TagType, []byte(fmt.Sprintf("object %s\ntype commit\ntag v1\n\nrelease\n", hashes["m"])))
+	assert.NoError(t, err)
+
+	assert.NoError(t, writeRef(root, BRANCH_PREFIX+DEFAULT_BRANCH, hashes["m"]))
+	assert.NoError(t, setHEAD(root, BRANCH_PREFIX+DEFAULT_BRANCH))
+	assert.NoError(t, writeRef(root, "refs/remotes/origin/main", hashes["m"]))
+	assert.NoError(t, writeRef(root, "refs/notes/commits", hashes["m"]))
+	// packed-refs, with topic overridden by its loose ref
+	packed := fmt.Sprintf("# pack-refs with: peeled fully-peeled sorted \n"+
+		"%s refs/heads/topic\n%s refs/tags/v0\n%s refs/tags/v1\n^%s\n",
+		hashes["root"], hashes["a1"], tag, hashes["m"])
+	assert.NoError(t, os.WriteFile(refPath(root, PACKED_REFS), []byte(packed), 0644))
+	assert.NoError(t, writeRef(root, "refs/heads/topic", hashes["b2"]))
+
+	d, err := loadDecorations(root, store, &decorationFilter{}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "HEAD -> main, tag: v1, origin/main", d.format(hashes["m"]))
+	assert.Equal(t, "topic", d.format(hashes["b2"]))
+	assert.Equal(t, "tag: v0", d.format(hashes["a1"]))
+	assert.Equal(t, "", d.format(hashes["root"]))
+
+	d, err = loadDecorations(root, store, &decorationFilter{}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "HEAD -> refs/heads/main, tag: refs/tags/v1, refs/remotes/origin/main", d.format(hashes["m"]))
+
+	filter := &decorationFilter{}
+	filter.Include("heads/")
+	filter.Include("notes")
+	filter.Exclude("refs/heads/t*")
+	d, err = loadDecorations(root, store, filter, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/notes/commits, main", d.format(hashes["m"]))
+	assert.Equal(t, "", d.format(hashes["b2"]))
+
+	filter = &decorationFilter{}
+	filter.Include("HEAD")
+	d, err = loadDecorations(root, store, filter, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "HEAD", d.format(hashes["m"]))
+}
+
+func TestPackedRefs(t *testing.T) {
+	root := t.TempDir()
+	packed := "# pack-refs with: peeled fully-peeled sorted \n" +
+		"1111111111111111111111111111111111111111 refs/heads/main\n" +
+		"2222222222222222222222222222222222222222 refs/tags/v1\n" +
+		"^3333333333333333333333333333333333333333\n"
+	assert.NoError(t, os.MkdirAll(refPath(root, ""), 0755))
+	assert.NoError(t, os.WriteFile(refPath(root, PACKED_REFS), []byte(packed), 0644))
+
+	hash, err := readRef(root, "refs/tags/v1")
+	assert.NoError(t, err)
+	assert.Equal(t, "2222222222222222222222222222222222222222", hash)
+
+	branches, err := listBranches(root)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main"}, branches)
+
+	// a loose ref wins over its packed entry
+	assert.NoError(t, writeRef(root, "refs/heads/topic", "4444444444444444444444444444444444444444"))
+	refs, err := listRefs(root, "refs/")
+	assert.NoError(t, err)
+	assert.Equal(t, []namedRef{
+		{name: "refs/heads/main", hash: "1111111111111111111111111111111111111111"},
+		{name: "refs/heads/topic", hash: "4444444444444444444444444444444444444444"},
+		{name: "refs/tags/v1", hash: "2222222222222222222222222222222222222222"},
+	}, refs)
+	assert.NoError(t, writeRef(root, "refs/heads/main", "5555555555555555555555555555555555555555"))
+	refs, err = listRefs(root, BRANCH_PREFIX)
+	assert.NoError(t, err)
+	assert.Equal(t, "5555555555555555555555555555555555555555", refs[0].hash)
+	assert.NoError(t, deleteRef(root, "refs/heads/topic"))
+
+	assert.NoError(t, deleteRef(root, "refs/tags/v1"))
+	_, err = readRef(root, "refs/tags/v1")
+	assert.ErrorIs(t, err, ERROR_REF_NOT_FOUND)
+	data, err := os.ReadFile(refPath(root, PACKED_REFS))
+	assert.NoError(t, err)
+	assert.Equal(t, "# pack-refs with: peeled fully-peeled sorted \n"+
+		"1111111111111111111111111111111111111111 refs/heads/main\n", string(data))
+}
@@ -0,0 +1,130 @@
+package snapshots
+
+const (
+	deltaBlockSize = 16
+	maxDeltaInsert = 0x7f
+	maxDeltaCopy   = 0x10000
+)
+
+func blockHash(b []byte) uint64 {
+	// FNV-1a over a single block
+	h := uint64(14695981039346656037)
+	for _, c := range b[:deltaBlockSize] {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	return h
+}
+
+func appendDeltaSize(out []byte, size int) []byte {
+	for size >= 0x80 {
+		out = append(out, byte(size&0x7f)|0x80)
+		size >>= 7
+	}
+	return append(out, byte(size))
+}
+
+func appendDeltaInsert(out, data []byte) []byte {
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxDeltaInsert {
+			n = maxDeltaInsert
+		}
+		out = append(out, byte(n))
+		out = append(out, data[:n]...)
+		data = data[n:]
+	}
+	return out
+}
+
+func appendDeltaCopy(out []byte, offset, size int) []byte {
+	for size > 0 {
+		n := size
+		if n > maxDeltaCopy {
+			n = maxDeltaCopy
+		}
+		op := byte(0x80)
+		var args []byte
+		for i := 0; i < 4; i++ {
+			if b := byte(offset >> (8 * i)); b != 0 {
+				op |= 1 << i
+				args = append(args, b)
+			}
+		}
+		// a zero size field means 0x10000
+		if n != maxDeltaCopy {
+			for i := 0; i < 3; i++ {
+				if b := byte(n >> (8 * i)); b != 0 {
+					op |= 1 << (4 + i)
+					args = append(args, b)
+				}
+			}
+		}
+		out = append(out, op)
+		out = append(out, args...)
+		offset += n
+		size -= n
+	}
+	return out
+}
+
+// createDelta encodes target as copy/insert instructions against base
+// in git's delta format. It gives up and returns nil once the delta
+// grows past maxSize, since the caller would store the object whole.
+func createDelta(base, target []byte, maxSize int) []byte {
+	if len(base) < deltaBlockSize || len(target) == 0 {
+		return nil
+	}
+
+	// index every aligned block of the base
+	blocks := make(map[uint64][]int, len(base)/deltaBlockSize)
+	for i := 0; i+deltaBlockSize <= len(base); i += deltaBlockSize {
+		h := blockHash(base[i:])
+		if len(blocks[h]) < 64 {
+			blocks[h] = append(blocks[h], i)
+		}
+	}
+
+	out := appendDeltaSize(nil, len(base))
+	out = appendDeltaSize(out, len(target))
+
+	pending := 0 // start of bytes not yet emitted
+	i := 0
+	for i+deltaBlockSize <= len(target) {
+		bestOff, bestLen := 0, 0
+		for _, off := range blocks[blockHash(target[i:])] {
+			n := 0
+			for off+n < len(base) && i+n < len(target) && base[off+n] == target[i+n] {
+				n++
+			}
+			if n > bestLen {
+				bestOff, bestLen = off, n
+			}
+		}
+		if bestLen < deltaBlockSize {
+			i++
+			continue
+		}
+
+		// grow the match backwards into the pending literal bytes
+		for bestOff > 0 && i > pending && base[bestOff-1] == target[i-1] {
+			bestOff--
+			i--
+			bestLen++
+		}
+
+		out = appendDeltaInsert(out, target[pending:i])
+		out = appendDeltaCopy(out, bestOff, bestLen)
+		i += bestLen
+		pending = i
+
+		if maxSize > 0 && len(out) > maxSize {
+			return nil
+		}
+	}
+	out = appendDeltaInsert(out, target[pending:])
+	if maxSize > 0 && len(out) > maxSize {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,516 @@
+package snapshots
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bibektamang7/own-git/diff"
+)
+
+const DEFAULT_DIFF_CONTEXT = 3
+
+// diffEntry is one side of a file pair. Worktree entries also carry
+// the file to read, since their blobs are not in the object store.
+type diffEntry struct {
+	mode uint32
+	hash string
+	file string
+}
+
+// diffSide maps repository paths to the files on one side of a diff.
+type diffSide map[string]diffEntry
+
+// filePair is one file in a diff. old is nil for added files and new
+// for deleted ones.
+type filePair struct {
+	oldPath, newPath string
+	old, new         *diffEntry
+	unmerged         bool
+}
+
+func (p filePair) path() string {
+	if p.new != nil {
+		return p.newPath
+	}
+	return p.oldPath
+}
+
+type diffOptions struct {
+	context int
+	cached  bool
+	revs    []string
+	paths   []string
+	lines   diff.Options
+}
+
+// treeSide lists the files of the tree a revision points at.
+func treeSide(store ObjectStore, hash string) (diffSide, error) {
+	treeHash, err := peel(store, hash, Tree)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := ParseTree(store, treeHash)
+	if err != nil {
+		return nil, err
+	}
+	side := make(diffSide, len(tree.TreePaths))
+	for p, blob := range tree.TreePaths {
+		side[p] = diffEntry{mode: tree.FileModes[p], hash: blob}
+	}
+	return side, nil
+}
+
+// indexSide lists the merged index entries and the unmerged paths.
+func indexSide(lines []IndexLine) (diffSide, []string) {
+	merged, conflicts := splitIndex(lines)
+	side := make(diffSide, len(merged))
+	for p, line := range merged {
+		side[p] = diffEntry{mode: line.FileMode, hash: line.BlobHash}
+	}
+	unmerged := make([]string, 0, len(conflicts))
+	for p := range conflicts {
+		unmerged = append(unmerged, p)
+	}
+	return side, unmerged
+}
+
+// worktreeSide lists the tracked files of the working tree. Files
+// whose stat data matches the index reuse the index hash; the rest
+// are hashed from disk.
+func worktreeSide(gitRoot string, lines []IndexLine, timestamp time.Time) (diffSide, error) {
+	side := make(diffSide)
+	for _, line := range lines {
+		if line.Stage != 0 {
+			continue
+		}
+		file := filepath.Join(gitRoot, line.Fullpath)
+		info, err := os.Lstat(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		entry := diffEntry{mode: getGitMode(info.Mode()), hash: line.BlobHash, file: file}
+		if !line.statClean(info, timestamp) {
+			if entry.hash, err = hashWorktreeFile(file, info); err != nil {
+				return nil, err
+			}
+		}
+		side[line.Fullpath] = entry
+	}
+	return side, nil
+}
+
+// filterSide keeps the paths matching one of paths; no paths keeps all.
+func filterSide(side diffSide, paths []string) diffSide {
+	if len(paths) == 0 {
+		return side
+	}
+	filtered := make(diffSide)
+	for p, entry := range side {
+		if matchesPathspec(p, paths) {
+			filtered[p] = entry
+		}
+	}
+	return filtered
+}
+
+func matchesPathspec(p string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, spec := range paths {
+		if pathWithin(p, spec) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffPairs pairs up the files of a and b that differ. Files deleted
+// from a and added in b with the same blob are shown as renames, and
+// a file that changes type is shown as a deletion and an addition.
+func diffPairs(a, b diffSide) []filePair {
+	var pairs []filePair
+	var deleted, added []string
+	for p, old := range a {
+		cur, ok := b[p]
+		if !ok {
+			deleted = append(deleted, p)
+			continue
+		}
+		if old.hash == cur.hash && old.mode == cur.mode {
+			continue
+		}
+		if modeType(old.mode) != modeType(cur.mode) {
+			pairs = append(pairs,
+				filePair{oldPath: p, newPath: p, old: &old},
+				filePair{oldPath: p, newPath: p, new: &cur})
+			continue
+		}
+		pairs = append(pairs, filePair{oldPath: p, newPath: p, old: &old, new: &cur})
+	}
+	for p := range b {
+		if _, ok := a[p]; !ok {
+			added = append(added, p)
+		}
+	}
+	sort.Strings(deleted)
+	sort.Strings(added)
+
+	sources := make(map[string][]string)
+	for _, p := range deleted {
+		sources[a[p].hash] = append(sources[a[p].hash], p)
+	}
+	renamed := make(map[string]bool)
+	for _, p := range added {
+		cur := b[p]
+		if from := sources[cur.hash]; len(from) > 0 {
+			old := a[from[0]]
+			sources[cur.hash] = from[1:]
+			renamed[from[0]] = true
+			pairs = append(pairs, filePair{oldPath: from[0], newPath: p, old: &old, new: &cur})
+			continue
+		}
+		pairs = append(pairs, filePair{oldPath: p, newPath: p, new: &cur})
+	}
+	for _, p := range deleted {
+		if !renamed[p] {
+			old := a[p]
+			pairs = append(pairs, filePair{oldPath: p, newPath: p, old: &old})
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].path() < pairs[j].path()
+	})
+	return pairs
+}
+
+// readDiffContent loads the content of one side of a pair.
+func readDiffContent(store ObjectStore, entry *diffEntry) ([]byte, error) {
+	if entry == nil {
+		return nil, nil
+	}
+	if entry.file != "" {
+		if entry.mode == 0120000 {
+			target, err := os.Readlink(entry.file)
+			return []byte(target), err
+		}
+		return os.ReadFile(entry.file)
+	}
+	objType, content, err := store.Read(entry.hash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != Blob {
+		return nil, fmt.Errorf("object %s is a %s, not a blob", entry.hash, objType)
+	}
+	return content, nil
+}
+
+// diffHash abbreviates the blob of one side, zeros for a missing side.
+func diffHash(entry *diffEntry) string {
+	if entry == nil {
+		return shortHash(zeroHash)
+	}
+	return shortHash(entry.hash)
+}
+
+// diffName is how a side is named in ---/+++ and binary lines.
+func diffName(prefix, p string, entry *diffEntry) string {
+	if entry == nil {
+		return "/dev/null"
+	}
+	return quotePath(prefix + p)
+}
+
+// headerName is diffName for the ---/+++ lines, where git ends names
+// containing a space with a tab so patch tools find where they end.
+func headerName(prefix, p string, entry *diffEntry) string {
+	name := diffName(prefix, p, entry)
+	if strings.Contains(name, " ") {
+		name += "\t"
+	}
+	return name
+}
+
+// writeFilePair writes the git style patch of one file pair. A pair
+// whose hunks all vanish under the whitespace options is left out,
+// unless the header says more than that the content changed.
+func writeFilePair(w io.Writer, store ObjectStore, pair filePair, opts diffOptions) error {
+	if pair.unmerged {
+		_, err := fmt.Fprintf(w, "* Unmerged path %s\n", pair.oldPath)
+		return err
+	}
+	old, cur := pair.old, pair.new
+	var header strings.Builder
+	fmt.Fprintf(&header, "diff --git %s %s\n", quotePath("a/"+pair.oldPath), quotePath("b/"+pair.newPath))
+	mustShow := true
+	switch {
+	case old == nil:
+		fmt.Fprintf(&header, "new file mode %06o\n", cur.mode)
+	case cur == nil:
+		fmt.Fprintf(&header, "deleted file mode %06o\n", old.mode)
+	default:
+		mustShow = old.mode != cur.mode || pair.oldPath != pair.newPath
+		if old.mode != cur.mode {
+			fmt.Fprintf(&header, "old mode %06o\nnew mode %06o\n", old.mode, cur.mode)
+		}
+		if pair.oldPath != pair.newPath {
+			fmt.Fprintf(&header, "similarity index 100%%\nrename from %s\nrename to %s\n",
+				quotePath(pair.oldPath), quotePath(pair.newPath))
+		}
+	}
+	if old != nil && cur != nil && old.hash == cur.hash {
+		_, err := io.WriteString(w, header.String())
+		return err
+	}
+
+	fmt.Fprintf(&header, "index %s..%s", diffHash(old), diffHash(cur))
+	if old != nil && cur != nil && old.mode == cur.mode {
+		fmt.Fprintf(&header, " %06o", cur.mode)
+	}
+	header.WriteString("\n")
+
+	a, err := readDiffContent(store, old)
+	if err != nil {
+		return err
+	}
+	b, err := readDiffContent(store, cur)
+	if err != nil {
+		return err
+	}
+	if diff.IsBinary(a) || diff.IsBinary(b) {
+		_, err := fmt.Fprintf(w, "%sBinary files %s and %s differ\n", header.String(),
+			diffName("a/", pair.oldPath, old), diffName("b/", pair.newPath, cur))
+		return err
+	}
+
+	aLines, bLines := diff.SplitLines(a), diff.SplitLines(b)
+	edits := diff.Lines(aLines, bLines, opts.lines)
+	if len(diff.Hunks(aLines, bLines, edits, opts.context, opts.lines)) == 0 {
+		if mustShow {
+			_, err = io.WriteString(w, header.String())
+		}
+		return err
+	}
+	fmt.Fprintf(w, "%s--- %s\n+++ %s\n", header.String(),
+		headerName("a/", pair.oldPath, old), headerName("b/", pair.newPath, cur))
+	return diff.WriteUnified(w, aLines, bLines, edits, opts.context, opts.lines)
+}
+
+// writeDiff writes the patches between two sides, with the unmerged
+// paths noted in path order.
+func writeDiff(w io.Writer, store ObjectStore, a, b diffSide, unmerged []string, opts diffOptions) error {
+	a, b = filterSide(a, opts.paths), filterSide(b, opts.paths)
+	pairs := diffPairs(a, b)
+	for _, p := range unmerged {
+		if matchesPathspec(p, opts.paths) {
+			pairs = append(pairs, filePair{oldPath: p, newPath: p, unmerged: true})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].path() < pairs[j].path()
+	})
+
+	for _, pair := range pairs {
+		if err := writeFilePair(w, store, pair, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseDiffArgs splits the diff arguments into options, revisions and
+// paths. Before "--", arguments are revisions until one fails to resolve.
+func parseDiffArgs(gitRoot string, store ObjectStore, cfg *Config, args []string) (diffOptions, error) {
+	opts := diffOptions{context: DEFAULT_DIFF_CONTEXT}
+	if name := cfg.Get("diff.algorithm"); name != "" {
+		algorithm, err := diff.ParseAlgorithm(name)
+		if err != nil {
+			return opts, fmt.Errorf("unknown value for config 'diff.algorithm': %s", name)
+		}
+		opts.lines.Algorithm = algorithm
+	}
+
+	// with an explicit "--" everything before it is a revision
+	dashed := slices.Contains(args, "--")
+	var paths []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			paths = append(paths, args[i+1:]...)
+			i = len(args)
+		case arg == "--cached" || arg == "--staged":
+			opts.cached = true
+		case arg == "--patience":
+			opts.lines.Algorithm = diff.PATIENCE
+		case arg == "--histogram":
+			opts.lines.Algorithm = diff.HISTOGRAM
+		case arg == "--minimal":
+			opts.lines.Algorithm = diff.MINIMAL
+		case strings.HasPrefix(arg, "--diff-algorithm="):
+			algorithm, err := diff.ParseAlgorithm(strings.TrimPrefix(arg, "--diff-algorithm="))
+			if err != nil {
+				return opts, err
+			}
+			opts.lines.Algorithm = algorithm
+		case arg == "-w" || arg == "--ignore-all-space":
+			opts.lines.IgnoreAllSpace = true
+		case arg == "-b" || arg == "--ignore-space-change":
+			opts.lines.IgnoreSpaceChange = true
+		case arg == "--ignore-blank-lines":
+			opts.lines.IgnoreBlankLines = true
+		case strings.HasPrefix(arg, "-U") || strings.HasPrefix(arg, "--unified="):
+			value := strings.TrimPrefix(strings.TrimPrefix(arg, "-U"), "--unified=")
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("invalid context length '%s'", value)
+			}
+			opts.context = n
+		case strings.HasPrefix(arg, "-"):
+			return opts, fmt.Errorf("unknown option '%s'", arg)
+		case len(paths) == 0:
+			if from, to, ok := splitRange(arg); ok && (dashed || isCommitRange(gitRoot, store, arg)) {
+				opts.revs = append(opts.revs, from, to)
+				continue
+			}
+			if _, err := ResolveRevision(gitRoot, store, arg); err == nil || dashed {
+				opts.revs = append(opts.revs, arg)
+				continue
+			}
+			if _, err := os.Lstat(arg); err != nil {
+				return opts, fmt.Errorf("ambiguous argument '%s': unknown revision or path not in the working tree", arg)
+			}
+			paths = append(paths, arg)
+		default:
+			paths = append(paths, arg)
+		}
+	}
+
+	var err error
+	if opts.paths, err = repoPaths(gitRoot, paths); err != nil {
+		return opts, err
+	}
+	if len(opts.revs) > 2 || (opts.cached && len(opts.revs) > 1) {
+		return opts, fmt.Errorf("usage: diff [--cached] [-U<n>] [--patience | --histogram] [-w | -b] [--ignore-blank-lines] [<commit> [<commit>]] [-- <path>...]")
+	}
+	return opts, nil
+}
+
+// repoPaths makes paths given on the command line relative to the
+// repository root.
+func repoPaths(gitRoot string, paths []string) ([]string, error) {
+	var rels []string
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(gitRoot, abs)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("%s is outside repository at %s", p, gitRoot)
+		}
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	return rels, nil
+}
+
+// revisionSide resolves rev to the files of its tree.
+func revisionSide(gitRoot string, store ObjectStore, rev string) (diffSide, error) {
+	hash, err := ResolveRevision(gitRoot, store, rev)
+	if err != nil {
+		return nil, err
+	}
+	return treeSide(store, hash)
+}
+
+func HandleDiffCommand() error {
+	path, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	gitRoot, ok, err := CheckGitFolderExists(path)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("outside git repository")
+	}
+	store := NewObjectStore(gitRoot)
+	cfg, err := LoadConfig(gitRoot)
+	if err != nil {
+		return err
+	}
+	opts, err := parseDiffArgs(gitRoot, store, cfg, os.Args[2:])
+	if err != nil {
+		return err
+	}
+
+	var a, b diffSide
+	var unmerged []string
+	switch {
+	case len(opts.revs) == 2:
+		if a, err = revisionSide(gitRoot, store, opts.revs[0]); err != nil {
+			return err
+		}
+		if b, err = revisionSide(gitRoot, store, opts.revs[1]); err != nil {
+			return err
+		}
+	default:
+		lines, idx, err := readIndex(gitRoot)
+		if err != nil {
+			return err
+		}
+		if opts.cached {
+			// the index against HEAD, or against nothing before the first commit
+			a = make(diffSide)
+			rev := "HEAD"
+			if len(opts.revs) == 1 {
+				rev = opts.revs[0]
+			}
+			if _, headHash, err := readHEAD(gitRoot); err != nil {
+				return err
+			} else if headHash != "" || rev != "HEAD" {
+				if a, err = revisionSide(gitRoot, store, rev); err != nil {
+					return err
+				}
+			}
+			b, unmerged = indexSide(lines)
+			break
+		}
+		if len(opts.revs) == 1 {
+			if a, err = revisionSide(gitRoot, store, opts.revs[0]); err != nil {
+				return err
+			}
+		} else {
+			a, unmerged = indexSide(lines)
+		}
+		if b, err = worktreeSide(gitRoot, lines, idx.Timestamp); err != nil {
+			return err
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	if err := writeDiff(out, store, a, b, unmerged, opts); err != nil {
+		return err
+	}
+	return out.Flush()
+}
@@ -0,0 +1,103 @@
+package snapshots
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bibektamang7/own-git/diff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDiffHeaders(t *testing.T) {
+	store := NewMemoryStore()
+	blob := func(content string) diffEntry {
+		hash, err := store.Write(Blob, []byte(content))
+		assert.NoError(t, err)
+		return diffEntry{mode: 0100644, hash: hash}
+	}
+
+	a := diffSide{"edit": blob("one\n"), "old": blob("moved\n"), "gone": blob("bye\n")}
+	b := diffSide{"edit": blob("two\n"), "new": blob("moved\n"), "bin": blob("\x00\x01")}
+
+	var out bytes.Buffer
+	assert.NoError(t, writeDiff(&out, store, a, b, []string{"conflict"}, diffOptions{context: DEFAULT_DIFF_CONTEXT}))
+	assert.Equal(t, "diff --git a/bin b/bin\n"+
+		"new file mode 100644\n"+
+		"index 0000000.."+shortHash(b["bin"].hash)+"\n"+
+		"Binary files /dev/null and b/bin differ\n"+
+		"* Unmerged path conflict\n"+
+		"diff --git a/edit b/edit\n"+
+		"index "+shortHash(a["edit"].hash)+".."+shortHash(b["edit"].hash)+" 100644\n"+
+		"--- a/edit\n"+
+		"+++ b/edit\n"+
+		"@@ -1 +1 @@\n"+
+		"-one\n"+
+		"+two\n"+
+		"diff --git a/gone b/gone\n"+
+		"deleted file mode 100644\n"+
+		"index "+shortHash(a["gone"].hash)+"..0000000\n"+
+		"--- a/gone\n"+
+		"+++ /dev/null\n"+
+		"@@ -1 +0,0 @@\n"+
+		"-bye\n"+
+		"diff --git a/old b/new\n"+
+		"similarity index 100%\n"+
+		"rename from old\n"+
+		"rename to new\n", out.String())
+}
+
+func TestDiffAlgorithmFromConfig(t *testing.T) {
+	root := newStatusRepo(t)
+	config := "[diff]\n\talgorithm = histogram\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(root, ROOTDIR, "config"), []byte(config), 0644))
+	cfg, err := LoadConfig(root)
+	assert.NoError(t, err)
+	store := NewObjectStore(root)
+
+	opts, err := parseDiffArgs(root, store, cfg, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, diff.HISTOGRAM, opts.lines.Algorithm)
+
+	// the command line wins over the config
+	opts, err = parseDiffArgs(root, store, cfg, []string{"--patience", "-w"})
+	assert.NoError(t, err)
+	assert.Equal(t, diff.PATIENCE, opts.lines.Algorithm)
+	assert.True(t, opts.lines.IgnoreAllSpace)
+}
+
+func TestDiffRangeOrPath(t *testing.T) {
+	root := newStatusRepo(t)
+	store := NewObjectStore(root)
+	hashes := make(map[string]string)
+	writeTestCommit(t, store, hashes, "first", 1)
+	assert.NoError(t, writeRef(root, BRANCH_PREFIX+DEFAULT_BRANCH, hashes["first"]))
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "sub"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "other.c"), []byte("x\n"), 0644))
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(filepath.Join(root, "sub")))
+	defer os.Chdir(wd)
+	cfg, err := LoadConfig(root)
+	assert.NoError(t, err)
+
+	opts, err := parseDiffArgs(root, store, cfg, []string{"../other.c"})
+	assert.NoError(t, err)
+	assert.Empty(t, opts.revs)
+	assert.Equal(t, []string{"other.c"}, opts.paths)
+
+	opts, err = parseDiffArgs(root, store, cfg, []string{DEFAULT_BRANCH + "..", "../other.c"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{DEFAULT_BRANCH, "HEAD"}, opts.revs)
+	assert.Equal(t, []string{"other.c"}, opts.paths)
+
+	// before "--" an argument is a revision even if it does not resolve
+	opts, err = parseDiffArgs(root, store, cfg, []string{"nope..HEAD", "--"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"nope", "HEAD"}, opts.revs)
+
+	_, err = parseDiffArgs(root, store, cfg, []string{"nope..HEAD"})
+	assert.Error(t, err)
+}
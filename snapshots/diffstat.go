@@ -0,0 +1,242 @@
+package snapshots
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bibektamang7/own-git/diff"
+)
+
+// DEFAULT_STAT_WIDTH is the width --stat fills when $COLUMNS is unset.
+const DEFAULT_STAT_WIDTH = 80
+
+// fileStat counts what one file pair adds and deletes: lines, or the
+// sizes of both sides for binary files.
+type fileStat struct {
+	name           string // "old => new" for renames
+	binary         bool
+	added, deleted int
+}
+
+// renameName shortens a rename to the parts that differ, as in
+// "dir/{old => new}/file".
+func renameName(a, b string) string {
+	qa, qb := quotePath(a), quotePath(b)
+	if qa != a || qb != b {
+		return qa + " => " + qb
+	}
+
+	// the common prefix, up to and including a slash
+	prefix := 0
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '/' {
+			prefix = i + 1
+		}
+	}
+	// the common suffix, from a slash on, possibly sharing the slash
+	// ending the prefix
+	suffix := 0
+	adjust := 0
+	if prefix > 0 {
+		adjust = 1
+	}
+	for i, j := len(a), len(b); i >= prefix-adjust && j >= prefix-adjust; i, j = i-1, j-1 {
+		ca, cb := byte(0), byte(0)
+		if i < len(a) {
+			ca = a[i]
+		}
+		if j < len(b) {
+			cb = b[j]
+		}
+		if ca != cb {
+			break
+		}
+		if ca == '/' {
+			suffix = len(a) - i
+		}
+	}
+
+	aMid := max(len(a)-prefix-suffix, 0)
+	bMid := max(len(b)-prefix-suffix, 0)
+	if prefix+suffix == 0 {
+		return a[prefix:prefix+aMid] + " => " + b[prefix:prefix+bMid]
+	}
+	return a[:prefix] + "{" + a[prefix:prefix+aMid] + " => " + b[prefix:prefix+bMid] + "}" + a[len(a)-suffix:]
+}
+
+// statFilePair counts the changes of one file pair.
+func statFilePair(store ObjectStore, pair filePair, opts diffOptions) (fileStat, error) {
+	stat := fileStat{name: quotePath(pair.path())}
+	if pair.oldPath != pair.newPath {
+		stat.name = renameName(pair.oldPath, pair.newPath)
+	}
+	a, err := readDiffContent(store, pair.old)
+	if err != nil {
+		return stat, err
+	}
+	b, err := readDiffContent(store, pair.new)
+	if err != nil {
+		return stat, err
+	}
+	same := pair.old != nil && pair.new != nil && pair.old.hash == pair.new.hash
+	if diff.IsBinary(a) || diff.IsBinary(b) {
+		stat.binary = true
+		if !same {
+			stat.added, stat.deleted = len(b), len(a)
+		}
+		return stat, nil
+	}
+	if same {
+		return stat, nil
+	}
+	for _, edit := range diff.Lines(diff.SplitLines(a), diff.SplitLines(b), opts.lines) {
+		switch edit.Op {
+		case diff.Insert:
+			stat.added++
+		case diff.Delete:
+			stat.deleted++
+		}
+	}
+	return stat, nil
+}
+
+// statWidth is how wide --stat may draw: $COLUMNS, or
+// DEFAULT_STAT_WIDTH.
+func statWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return DEFAULT_STAT_WIDTH
+}
+
+// scaleLinear scales n changes to a graph of width columns, where
+// maxChange fills all of them.
+func scaleLinear(n, width, maxChange int) int {
+	if n == 0 {
+		return 0
+	}
+	return 1 + n*(width-1)/maxChange
+}
+
+// writeStat writes the --stat lines within width columns: a name
+// column of at most 5/8 of them, the change count and a graph of
+// '+' and '-' scaled to the largest change.
+func writeStat(w io.Writer, stats []fileStat, width int) {
+	maxName, maxChange, numberWidth, binWidth := 0, 0, 0, 0
+	for _, s := range stats {
+		maxName = max(maxName, len(s.name))
+		if s.binary {
+			// "Bin XXX -> YYY bytes"
+			binWidth = max(binWidth, 14+len(strconv.Itoa(s.added))+len(strconv.Itoa(s.deleted)))
+			numberWidth = 3
+			continue
+		}
+		maxChange = max(maxChange, s.added+s.deleted)
+	}
+	numberWidth = max(numberWidth, len(strconv.Itoa(maxChange)))
+	width = max(width, 16+6+numberWidth)
+
+	graphWidth := maxChange
+	if maxChange+4 <= binWidth {
+		graphWidth = binWidth - 4
+	}
+	nameWidth := maxName
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = max(width*3/8-numberWidth-6, 6)
+		}
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+
+	adds, dels := 0, 0
+	for _, s := range stats {
+		prefix, name := "", s.name
+		room := nameWidth
+		if len(name) > nameWidth {
+			// keep the end of the name, from a slash if there is one
+			prefix = "..."
+			room = max(room-3, 0)
+			name = name[len(name)-room:]
+			if i := strings.IndexByte(name, '/'); i >= 0 {
+				name = name[i:]
+			}
+		}
+		padding := strings.Repeat(" ", max(room-len(name), 0))
+
+		if s.binary {
+			fmt.Fprintf(w, " %s%s%s | %*s", prefix, name, padding, numberWidth, "Bin")
+			if s.added != 0 || s.deleted != 0 {
+				fmt.Fprintf(w, " %d -> %d bytes", s.deleted, s.added)
+			}
+			io.WriteString(w, "\n")
+			continue
+		}
+
+		add, del := s.added, s.deleted
+		if graphWidth <= maxChange {
+			total := scaleLinear(add+del, graphWidth, maxChange)
+			if total < 2 && add > 0 && del > 0 {
+				total = 2 // room for both a '+' and a '-'
+			}
+			if add < del {
+				add = scaleLinear(add, graphWidth, maxChange)
+				del = total - add
+			} else {
+				del = scaleLinear(del, graphWidth, maxChange)
+				add = total - del
+			}
+		}
+		space := ""
+		if s.added+s.deleted > 0 {
+			space = " "
+		}
+		fmt.Fprintf(w, " %s%s%s | %*d%s%s%s\n", prefix, name, padding, numberWidth, s.added+s.deleted, space,
+			strings.Repeat("+", add), strings.Repeat("-", del))
+		adds += s.added
+		dels += s.deleted
+	}
+	writeStatSummary(w, len(stats), adds, dels)
+}
+
+// writeStatSummary writes the line closing --stat, as in
+// " 2 files changed, 3 insertions(+), 1 deletion(-)".
+func writeStatSummary(w io.Writer, files, adds, dels int) {
+	if files == 0 {
+		io.WriteString(w, " 0 files changed\n")
+		return
+	}
+	fmt.Fprintf(w, " %s changed", plural(int64(files), "file"))
+	if adds > 0 || dels == 0 {
+		fmt.Fprintf(w, ", %d insertion%s(+)", adds, pluralSuffix(adds))
+	}
+	if dels > 0 || adds == 0 {
+		fmt.Fprintf(w, ", %d deletion%s(-)", dels, pluralSuffix(dels))
+	}
+	io.WriteString(w, "\n")
+}
+
+func pluralSuffix(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// writeNumstat writes the tab separated counts of --numstat, "-" for
+// binary files.
+func writeNumstat(w io.Writer, stats []fileStat) {
+	for _, s := range stats {
+		if s.binary {
+			fmt.Fprintf(w, "-\t-\t%s\n", s.name)
+			continue
+		}
+		fmt.Fprintf(w, "%d\t%d\t%s\n", s.added, s.deleted, s.name)
+	}
+}
@@ -0,0 +1,45 @@
+package snapshots
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenameName(t *testing.T) {
+	for _, tc := range []struct{ a, b, want string }{
+		{"f", "h", "f => h"},
+		{"d/g", "a/b/g", "{d => a/b}/g"},
+		{"a/b/g", "a/c", "a/{b/g => c}"},
+		{"src/old/main.go", "src/new/main.go", "src/{old => new}/main.go"},
+		{"dir/file", "dir/sub/file", "dir/{ => sub}/file"},
+		{"bin", "bin.dat", "bin => bin.dat"},
+	} {
+		assert.Equal(t, tc.want, renameName(tc.a, tc.b), tc.a)
+	}
+}
+
+func TestWriteStat(t *testing.T) {
+	var b strings.Builder
+	writeStat(&b, []fileStat{
+		{name: "big", added: 200},
+		{name: "small", added: 20, deleted: 10},
+		{name: "very/long/directory/name/for/testing/the/stat/width/file.txt", added: 5},
+		{name: "image.png", binary: true, added: 10},
+	}, 80)
+	assert.Equal(t,
+		" big                                                | 200 +++++++++++++++++++++\n"+
+			" small                                              |  30 ++--\n"+
+			" .../name/for/testing/the/stat/width/file.txt       |   5 +\n"+
+			" image.png                                          | Bin 0 -> 10 bytes\n"+
+			" 4 files changed, 225 insertions(+), 10 deletions(-)\n", b.String())
+
+	b.Reset()
+	writeNumstat(&b, []fileStat{{name: "f => h"}, {name: "image.png", binary: true, added: 10}})
+	assert.Equal(t, "0\t0\tf => h\n-\t-\timage.png\n", b.String())
+
+	b.Reset()
+	writeStatSummary(&b, 1, 0, 0)
+	assert.Equal(t, " 1 file changed, 0 insertions(+), 0 deletions(-)\n", b.String())
+}
@@ -0,0 +1,205 @@
+package snapshots
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// looseObjectHashes lists every object stored under objects/xx/.
+func looseObjectHashes(gitRoot string) ([]string, error) {
+	objectsDir := filepath.Join(gitRoot, ROOTDIR, "objects")
+	dirs, err := os.ReadDir(objectsDir)
+	if err != nil {
+		return nil, err
+	}
+	var hashes []string
+	for _, d := range dirs {
+		if !d.IsDir() || len(d.Name()) != 2 {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(objectsDir, d.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if len(f.Name()) == 38 {
+				hashes = append(hashes, d.Name()+f.Name())
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// refTips returns the commit hashes every ref and HEAD point at.
+func refTips(gitRoot string) []string {
+	var tips []string
+	head, err := os.ReadFile(filepath.Join(gitRoot, ROOTDIR, "HEAD"))
+	if err == nil && !strings.HasPrefix(string(head), "ref: ") {
+		if h := strings.TrimSpace(string(head)); h != "" {
+			tips = append(tips, h)
+		}
+	}
+	refs, _ := listRefs(gitRoot, "refs/")
+	for _, ref := range refs {
+		tips = append(tips, ref.hash)
+	}
+	return tips
+}
+
+// objectPaths walks every commit reachable from tips and records
+// the path each tree and blob was first seen at.
+func objectPaths(store ObjectStore, tips []string) map[string]string {
+	paths := make(map[string]string)
+	var walkTree func(hash, prefix string)
+	walkTree = func(hash, prefix string) {
+		if _, ok := paths[hash]; ok {
+			return
+		}
+		paths[hash] = prefix
+		entries, err := readTree(store, hash)
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			switch e.contentType {
+			case Tree:
+				walkTree(e.Hash, filepath.Join(prefix, e.Name))
+			case Blob:
+				if _, ok := paths[e.Hash]; !ok {
+					paths[e.Hash] = filepath.Join(prefix, e.Name)
+				}
+			}
+		}
+	}
+
+	queue := append([]string{}, tips...)
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if _, ok := paths[hash]; ok {
+			continue
+		}
+		paths[hash] = ""
+		objType, content, err := store.Read(hash)
+		if err != nil || objType != CommitType {
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				break
+			}
+			if tree, ok := strings.CutPrefix(line, "tree "); ok {
+				walkTree(tree, "")
+			}
+			if parent, ok := strings.CutPrefix(line, "parent "); ok {
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return paths
+}
+
+// repack writes every loose and packed object into a single new pack,
+// then prunes the loose files and the packs it replaced.
+func repack(gitRoot string, opts PackOptions) (string, int, error) {
+	loose, err := looseObjectHashes(gitRoot)
+	if err != nil {
+		return "", 0, err
+	}
+	packs := NewPackStore(gitRoot)
+	if err := packs.load(); err != nil {
+		return "", 0, err
+	}
+	defer packs.Close()
+
+	seen := make(map[string]bool)
+	var hashes []string
+	for _, h := range loose {
+		if !seen[h] {
+			seen[h] = true
+			hashes = append(hashes, h)
+		}
+	}
+	var oldPacks []string
+	for _, pack := range packs.packs {
+		oldPacks = append(oldPacks, pack.path)
+		for i := 0; i < pack.idx.count(); i++ {
+			if h := pack.idx.hashAt(i); !seen[h] {
+				seen[h] = true
+				hashes = append(hashes, h)
+			}
+		}
+	}
+	if len(hashes) == 0 {
+		return "", 0, nil
+	}
+
+	store := &repoStore{loose: NewLooseStore(gitRoot), packs: packs}
+	paths := objectPaths(store, refTips(gitRoot))
+
+	objects := make([]*PackObject, 0, len(hashes))
+	for _, h := range hashes {
+		objType, size, r, err := store.Stream(h)
+		if err != nil {
+			return "", 0, err
+		}
+		r.Close()
+		objects = append(objects, &PackObject{Hash: h, Type: objType, Size: size, Path: paths[h]})
+	}
+
+	packPath, err := WritePack(store, filepath.Join(gitRoot, ROOTDIR, "objects", "pack"), objects, opts)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// everything is safely in the new pack now
+	for _, old := range oldPacks {
+		if old == packPath {
+			continue
+		}
+		os.Remove(strings.TrimSuffix(old, ".pack") + ".idx")
+		os.Remove(old)
+	}
+	for _, h := range loose {
+		os.Remove(store.loose.path(h))
+		os.Remove(filepath.Dir(store.loose.path(h)))
+	}
+	return packPath, len(objects), nil
+}
+
+func HandleGCCommand() error {
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	window := fs.Int("window", 10, "number of objects considered as delta bases")
+	depth := fs.Int("depth", 50, "maximum delta chain length")
+	fs.Parse(os.Args[2:])
+
+	path, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	gitRoot, ok, err := CheckGitFolderExists(path)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ERROR_OUTSIDE_GIT
+	}
+
+	packPath, count, err := repack(gitRoot, PackOptions{Window: *window, Depth: *depth})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		fmt.Println("Nothing new to pack.")
+		return nil
+	}
+	fmt.Printf("Packed %d objects into %s\n", count, filepath.Base(packPath))
+	return nil
+}
@@ -0,0 +1,595 @@
+package snapshots
+
+import (
+	"io"
+	"strings"
+)
+
+// states a commit goes through while its graph lines are drawn
+const (
+	graphPadding    = iota // lanes run straight down, the commit is done
+	graphSkip              // the previous commit never finished drawing
+	graphPreCommit         // widen the lanes around an octopus merge
+	graphCommit            // the line with the "*"
+	graphPostMerge         // the edges leaving a merge
+	graphCollapsing        // lanes moving left into place
+)
+
+// commitGraph draws the lanes of log --graph one line at a time. It is
+// a port of git's graph.c, so the drawing matches git's line for line.
+//
+// columns are the lanes entering the current commit's lines, newColumns
+// the lanes leaving them. mapping holds, for every screen position of
+// the line being drawn, the index in newColumns its lane ends up at.
+type commitGraph struct {
+	walk            *RevWalk
+	commit          *RevCommit
+	numParents      int
+	width           int
+	expansionRow    int
+	state           int
+	prevState       int
+	commitIndex     int
+	prevCommitIndex int
+	mergeLayout     int // -1 until chosen; 0 when the first parent is to the left
+	edgesAdded      int
+	prevEdgesAdded  int
+
+	columns       []*RevCommit
+	newColumns    []*RevCommit
+	numColumns    int
+	numNewColumns int
+	mapping       []int
+	oldMapping    []int
+	mappingSize   int
+}
+
+func newCommitGraph(walk *RevWalk) *commitGraph {
+	g := &commitGraph{walk: walk, state: graphPadding, prevState: graphPadding}
+	g.ensureCapacity(30)
+	return g
+}
+
+func (g *commitGraph) ensureCapacity(n int) {
+	if len(g.columns) >= n {
+		return
+	}
+	capacity := max(len(g.columns), 1)
+	for capacity < n {
+		capacity *= 2
+	}
+	grow := func(s []int, size int) []int {
+		out := make([]int, size)
+		for i := range out {
+			out[i] = -1
+		}
+		copy(out, s)
+		return out
+	}
+	g.columns = append(g.columns, make([]*RevCommit, capacity-len(g.columns))...)
+	g.newColumns = append(g.newColumns, make([]*RevCommit, capacity-len(g.newColumns))...)
+	g.mapping = grow(g.mapping, 2*capacity)
+	g.oldMapping = grow(g.oldMapping, 2*capacity)
+}
+
+// interestingParents lists the parents that get a lane: the ones the
+// walk shows, or only the first one with --first-parent.
+func (g *commitGraph) interestingParents() []*RevCommit {
+	var parents []*RevCommit
+	for i, p := range g.commit.Parents {
+		if i > 0 && g.walk.FirstParent {
+			break
+		}
+		if g.walk.interesting(p) {
+			parents = append(parents, p)
+		}
+	}
+	return parents
+}
+
+func (g *commitGraph) setState(state int) {
+	g.prevState = g.state
+	g.state = state
+}
+
+// update moves the graph on to c, the next commit to be shown.
+func (g *commitGraph) update(c *RevCommit) {
+	g.commit = c
+	g.numParents = len(g.interestingParents())
+	g.prevCommitIndex = g.commitIndex
+	g.updateColumns()
+	g.expansionRow = 0
+
+	// prevState is left alone: no line was drawn in the old state
+	switch {
+	case g.state != graphPadding:
+		g.state = graphSkip
+	case g.needsPreCommitLine():
+		g.state = graphPreCommit
+	default:
+		g.state = graphCommit
+	}
+}
+
+func (g *commitGraph) findNewColumn(c *RevCommit) int {
+	for i := 0; i < g.numNewColumns; i++ {
+		if g.newColumns[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertIntoNewColumns gives c a lane after the current commit, reusing
+// its lane if it has one already. idx is the current commit's column
+// when c is one of its parents, -1 otherwise.
+func (g *commitGraph) insertIntoNewColumns(c *RevCommit, idx int) {
+	i := g.findNewColumn(c)
+	if i < 0 {
+		i = g.numNewColumns
+		g.numNewColumns++
+		g.newColumns[i] = c
+	}
+
+	var mappingIdx int
+	switch {
+	case g.numParents > 1 && idx > -1 && g.mergeLayout == -1:
+		// the first parent of a merge picks the layout of the merge
+		// edges: skewed left when that parent is to the left
+		dist := idx - i
+		shift := 1
+		if dist > 1 {
+			shift = 2*dist - 3
+		}
+		g.mergeLayout = 1
+		if dist > 0 {
+			g.mergeLayout = 0
+		}
+		g.edgesAdded = g.numParents + g.mergeLayout - 2
+		mappingIdx = g.width + (g.mergeLayout-1)*shift
+		g.width += 2 * g.mergeLayout
+	case g.edgesAdded > 0 && i == g.mapping[g.width-2]:
+		// the new edge joins the last existing lane right away
+		mappingIdx = g.width - 2
+		g.edgesAdded = -1
+	default:
+		mappingIdx = g.width
+		g.width += 2
+	}
+	g.mapping[mappingIdx] = i
+}
+
+func (g *commitGraph) updateColumns() {
+	g.columns, g.newColumns = g.newColumns, g.columns
+	g.numColumns = g.numNewColumns
+	g.numNewColumns = 0
+
+	// keep where the lanes ended up, for the commit line
+	g.mapping, g.oldMapping = g.oldMapping, g.mapping
+	maxNewColumns := g.numColumns + g.numParents
+	g.ensureCapacity(maxNewColumns)
+	g.mappingSize = 2 * maxNewColumns
+	for i := 0; i < g.mappingSize; i++ {
+		g.mapping[i] = -1
+	}
+	g.width = 0
+	g.prevEdgesAdded = g.edgesAdded
+	g.edgesAdded = 0
+
+	seenThis := false
+	for i := 0; i <= g.numColumns; i++ {
+		var colCommit *RevCommit
+		if i == g.numColumns {
+			if seenThis {
+				break
+			}
+			colCommit = g.commit
+		} else {
+			colCommit = g.columns[i]
+		}
+
+		if colCommit != g.commit {
+			g.insertIntoNewColumns(colCommit, -1)
+			continue
+		}
+		seenThis = true
+		g.commitIndex = i
+		g.mergeLayout = -1
+		for _, p := range g.interestingParents() {
+			g.insertIntoNewColumns(p, i)
+		}
+		// the commit takes up two places even without parents
+		if g.numParents == 0 {
+			g.width += 2
+		}
+	}
+	for g.mappingSize > 1 && g.mapping[g.mappingSize-1] < 0 {
+		g.mappingSize--
+	}
+}
+
+func (g *commitGraph) numDashedParents() int {
+	return g.numParents + g.mergeLayout - 3
+}
+
+func (g *commitGraph) needsPreCommitLine() bool {
+	return g.numParents >= 3 &&
+		g.commitIndex < g.numColumns-1 &&
+		g.expansionRow < 2*g.numDashedParents()
+}
+
+// mappingCorrect reports whether every lane has reached its column,
+// or is one place right of it and drawn as "/" already.
+func (g *commitGraph) mappingCorrect() bool {
+	for i := 0; i < g.mappingSize; i++ {
+		if target := g.mapping[i]; target >= 0 && target != i/2 {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *commitGraph) paddingLine(line *strings.Builder) {
+	for i := 0; i < g.numNewColumns; i++ {
+		line.WriteString("| ")
+	}
+}
+
+func (g *commitGraph) skipLine(line *strings.Builder) {
+	line.WriteString("...")
+	if g.needsPreCommitLine() {
+		g.setState(graphPreCommit)
+	} else {
+		g.setState(graphCommit)
+	}
+}
+
+// preCommitLine makes room for the dashes of an octopus merge, two
+// lines for each parent past the second.
+func (g *commitGraph) preCommitLine(line *strings.Builder) {
+	seenThis := false
+	for i := 0; i < g.numColumns; i++ {
+		switch {
+		case g.columns[i] == g.commit:
+			seenThis = true
+			line.WriteByte('|')
+			line.WriteString(strings.Repeat(" ", g.expansionRow))
+		case seenThis && g.expansionRow == 0:
+			// lanes the previous merge left as "\" carry on as "\"
+			if g.prevState == graphPostMerge && g.prevCommitIndex < i {
+				line.WriteByte('\\')
+			} else {
+				line.WriteByte('|')
+			}
+		case seenThis:
+			line.WriteByte('\\')
+		default:
+			line.WriteByte('|')
+		}
+		line.WriteByte(' ')
+	}
+
+	g.expansionRow++
+	if !g.needsPreCommitLine() {
+		g.setState(graphCommit)
+	}
+}
+
+func (g *commitGraph) commitLine(line *strings.Builder) {
+	seenThis := false
+	for i := 0; i <= g.numColumns; i++ {
+		var colCommit *RevCommit
+		if i == g.numColumns {
+			if seenThis {
+				break
+			}
+			colCommit = g.commit
+		} else {
+			colCommit = g.columns[i]
+		}
+
+		switch {
+		case colCommit == g.commit:
+			seenThis = true
+			line.WriteByte('*')
+			// the dashes of an octopus merge
+			for j := 0; j < g.numDashedParents(); j++ {
+				if j == g.numDashedParents()-1 {
+					line.WriteString("-.")
+				} else {
+					line.WriteString("--")
+				}
+			}
+		case seenThis && g.edgesAdded > 1:
+			line.WriteByte('\\')
+		case seenThis && g.edgesAdded == 1:
+			// a merge without pre-commit lines continues the "\"
+			// lanes of a merge just above it
+			if g.prevState == graphPostMerge && g.prevEdgesAdded > 0 && g.prevCommitIndex < i {
+				line.WriteByte('\\')
+			} else {
+				line.WriteByte('|')
+			}
+		case g.prevState == graphCollapsing && g.oldMapping[2*i+1] == i && g.mapping[2*i] < i:
+			line.WriteByte('/')
+		default:
+			line.WriteByte('|')
+		}
+		line.WriteByte(' ')
+	}
+
+	switch {
+	case g.numParents > 1:
+		g.setState(graphPostMerge)
+	case g.mappingCorrect():
+		g.setState(graphPadding)
+	default:
+		g.setState(graphCollapsing)
+	}
+}
+
+// mergeChars are the edges to the parents of a merge, by layout.
+var mergeChars = []byte{'/', '|', '\\'}
+
+func (g *commitGraph) postMergeLine(line *strings.Builder) {
+	parents := g.interestingParents()
+	seenThis := false
+	parentCol := false
+	for i := 0; i <= g.numColumns; i++ {
+		var colCommit *RevCommit
+		if i == g.numColumns {
+			if seenThis {
+				break
+			}
+			colCommit = g.commit
+		} else {
+			colCommit = g.columns[i]
+		}
+
+		switch {
+		case colCommit == g.commit:
+			seenThis = true
+			idx := g.mergeLayout
+			for j := range parents {
+				line.WriteByte(mergeChars[idx])
+				if idx == 2 {
+					if g.edgesAdded > 0 || j < len(parents)-1 {
+						line.WriteByte(' ')
+					}
+				} else {
+					idx++
+				}
+			}
+			if g.edgesAdded == 0 {
+				line.WriteByte(' ')
+			}
+		case seenThis:
+			if g.edgesAdded > 0 {
+				line.WriteByte('\\')
+			} else {
+				line.WriteByte('|')
+			}
+			line.WriteByte(' ')
+		default:
+			line.WriteByte('|')
+			if g.mergeLayout != 0 || i != g.commitIndex-1 {
+				if parentCol {
+					line.WriteByte('_')
+				} else {
+					line.WriteByte(' ')
+				}
+			}
+		}
+
+		if colCommit == parents[0] {
+			parentCol = true
+		}
+	}
+
+	if g.mappingCorrect() {
+		g.setState(graphPadding)
+	} else {
+		g.setState(graphCollapsing)
+	}
+}
+
+// collapsingLine moves every lane that is right of its column one
+// place left, letting a single lane cross the others horizontally.
+func (g *commitGraph) collapsingLine(line *strings.Builder) {
+	usedHorizontal := false
+	horizontalEdge, horizontalTarget := -1, -1
+
+	// past mappingSize too, so the commit line after this one sees
+	// no lanes from earlier lines
+	g.mapping, g.oldMapping = g.oldMapping, g.mapping
+	for i := range g.mapping {
+		g.mapping[i] = -1
+	}
+
+	for i := 0; i < g.mappingSize; i++ {
+		target := g.oldMapping[i]
+		switch {
+		case target < 0:
+		case target*2 == i:
+			g.mapping[i] = target
+		case g.mapping[i-1] < 0:
+			// nothing to the left, move left by one
+			g.mapping[i-1] = target
+			if horizontalEdge == -1 {
+				horizontalEdge, horizontalTarget = i, target
+				for j := target*2 + 3; j < i-2; j += 2 {
+					g.mapping[j] = target
+				}
+			}
+		case g.mapping[i-1] == target:
+			// the lane to the left goes to the same commit
+		default:
+			// cross the lane to the left
+			g.mapping[i-2] = target
+			if horizontalEdge == -1 {
+				horizontalEdge, horizontalTarget = i-1, target
+				for j := target*2 + 3; j < i-2; j += 2 {
+					g.mapping[j] = target
+				}
+			}
+		}
+	}
+
+	if g.mapping[g.mappingSize-1] < 0 {
+		g.mappingSize--
+	}
+
+	for i := 0; i < g.mappingSize; i++ {
+		target := g.mapping[i]
+		switch {
+		case target < 0:
+			line.WriteByte(' ')
+		case target*2 == i:
+			line.WriteByte('|')
+		case target == horizontalTarget && i != horizontalEdge-1:
+			// only the first segment carries on to the next line
+			if i != target*2+3 {
+				g.mapping[i] = -1
+			}
+			usedHorizontal = true
+			line.WriteByte('_')
+		default:
+			if usedHorizontal && i < horizontalEdge {
+				g.mapping[i] = -1
+			}
+			line.WriteByte('/')
+		}
+	}
+
+	if g.mappingCorrect() {
+		g.setState(graphPadding)
+	}
+}
+
+// nextLine draws the next graph line, padded to the width of the
+// graph, and reports whether it was the commit's own line.
+func (g *commitGraph) nextLine() (string, bool) {
+	var line strings.Builder
+	shownCommit := false
+	switch g.state {
+	case graphPadding:
+		g.paddingLine(&line)
+	case graphSkip:
+		g.skipLine(&line)
+	case graphPreCommit:
+		g.preCommitLine(&line)
+	case graphCommit:
+		g.commitLine(&line)
+		shownCommit = true
+	case graphPostMerge:
+		g.postMergeLine(&line)
+	case graphCollapsing:
+		g.collapsingLine(&line)
+	}
+	if n := g.width - line.Len(); n > 0 {
+		line.WriteString(strings.Repeat(" ", n))
+	}
+	return line.String(), shownCommit
+}
+
+func (g *commitGraph) finished() bool {
+	return g.state == graphPadding
+}
+
+// showPadding draws a line that leaves the lanes as they are, for the
+// blank line between two commits.
+func (g *commitGraph) showPadding(w io.Writer) {
+	if g == nil {
+		return
+	}
+	if g.state != graphCommit {
+		line, _ := g.nextLine()
+		io.WriteString(w, line)
+		return
+	}
+
+	var line strings.Builder
+	for i := 0; i < g.numColumns; i++ {
+		line.WriteByte('|')
+		if g.columns[i] == g.commit && g.numParents > 2 {
+			line.WriteString(strings.Repeat(" ", (g.numParents-2)*2))
+		} else {
+			line.WriteByte(' ')
+		}
+	}
+	if n := g.width - line.Len(); n > 0 {
+		line.WriteString(strings.Repeat(" ", n))
+	}
+	io.WriteString(w, line.String())
+	g.prevState = graphPadding
+}
+
+// showCommit draws the lines up to and including the commit's own
+// line, which is left open for the commit header.
+func (g *commitGraph) showCommit(w io.Writer) {
+	if g == nil {
+		return
+	}
+	if g.finished() {
+		g.showPadding(w)
+		return
+	}
+	for {
+		line, shownCommit := g.nextLine()
+		io.WriteString(w, line)
+		if shownCommit || g.finished() {
+			return
+		}
+		io.WriteString(w, "\n")
+	}
+}
+
+// showRemainder draws the lines left after the commit, without a
+// final newline.
+func (g *commitGraph) showRemainder(w io.Writer) {
+	if g == nil || g.finished() {
+		return
+	}
+	for {
+		line, _ := g.nextLine()
+		io.WriteString(w, line)
+		if g.finished() {
+			return
+		}
+		io.WriteString(w, "\n")
+	}
+}
+
+// showMessage writes the lines of a formatted commit, each after the
+// next graph line, then whatever of the graph the commit still needs.
+func (g *commitGraph) showMessage(w io.Writer, msg string) {
+	if g == nil {
+		io.WriteString(w, msg)
+		return
+	}
+	for rest := msg; ; {
+		line, next, ok := strings.Cut(rest, "\n")
+		io.WriteString(w, line)
+		if !ok {
+			break
+		}
+		io.WriteString(w, "\n")
+		if next == "" {
+			break
+		}
+		graphLine, _ := g.nextLine()
+		io.WriteString(w, graphLine)
+		rest = next
+	}
+
+	if !g.finished() {
+		terminated := strings.HasSuffix(msg, "\n")
+		if !terminated {
+			io.WriteString(w, "\n")
+		}
+		g.showRemainder(w)
+		if terminated {
+			io.WriteString(w, "\n")
+		}
+	}
+}
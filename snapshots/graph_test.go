@@ -0,0 +1,64 @@
+package snapshots
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func graphLog(t *testing.T, store ObjectStore, tip string) string {
+	walk := NewRevWalk(store)
+	walk.TopoOrder = true
+	assert.NoError(t, walk.Push(tip))
+
+	var out strings.Builder
+	pretty := defaultPrettyOptions()
+	assert.NoError(t, pretty.parsePretty("%s"))
+	gl := &GitLog{Store: store, pretty: pretty, graph: newCommitGraph(walk), out: &out}
+	for {
+		c, err := walk.Next()
+		assert.NoError(t, err)
+		if c == nil {
+			return out.String()
+		}
+		gl.logCommit(c)
+	}
+}
+
+func TestGraphMerge(t *testing.T) {
+	store := NewMemoryStore()
+	hashes := writeHistory(t, store)
+
+	assert.Equal(t, strings.Join([]string{
+		"*   m",
+		"|\\  ",
+		"| * b2",
+		"| * b1",
+		"* | a2",
+		"* | a1",
+		"|/  ",
+		"* root",
+	}, "\n")+"\n", graphLog(t, store, hashes["m"]))
+}
+
+func TestGraphOctopus(t *testing.T) {
+	store := NewMemoryStore()
+	hashes := writeHistory(t, store)
+	writeTestCommit(t, store, hashes, "x", 7, "m")
+	writeTestCommit(t, store, hashes, "y", 8, "m")
+	writeTestCommit(t, store, hashes, "z", 9, "m")
+	writeTestCommit(t, store, hashes, "o", 10, "x", "y", "z")
+
+	got := graphLog(t, store, hashes["o"])
+	assert.True(t, strings.HasPrefix(got, strings.Join([]string{
+		"*-.   o",
+		"|\\ \\  ",
+		"| | * z",
+		"| * | y",
+		"| |/  ",
+		"* / x",
+		"|/  ",
+		"*   m",
+	}, "\n")+"\n"), got)
+}
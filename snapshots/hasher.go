@@ -0,0 +1,91 @@
+package snapshots
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// stageJob is a worktree file whose blob still has to be written.
+type stageJob struct {
+	rel  string
+	info os.FileInfo
+}
+
+// writeWorktreeBlob streams a worktree entry into store while hashing
+// it: the file content, or the link target for symlinks.
+func writeWorktreeBlob(store ObjectStore, path string, info os.FileInfo) (string, error) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		return store.WriteStream(Blob, int64(len(target)), strings.NewReader(target))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return store.WriteStream(Blob, info.Size(), f)
+}
+
+// hashWorktreeFile computes the blob hash of a worktree entry
+// without storing it.
+func hashWorktreeFile(path string, info os.FileInfo) (string, error) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		return hashObject(Blob, []byte(target)), nil
+	}
+	return hashFile(path, info)
+}
+
+// writeBlobs writes the blobs of jobs using one worker per CPU and
+// returns their index lines in job order. Only the first error is kept.
+func writeBlobs(store ObjectStore, root string, jobs []stageJob) ([]IndexLine, error) {
+	lines := make([]IndexLine, len(jobs))
+	work := make(chan int)
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	workers := runtime.NumCPU()
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				job := jobs[i]
+				hash, err := writeWorktreeBlob(store, filepath.Join(root, job.rel), job.info)
+				if err != nil {
+					once.Do(func() {
+						firstErr = fmt.Errorf("adding %s: %w", job.rel, err)
+					})
+					continue
+				}
+				lines[i] = newIndexLineFromInfo(job.rel, hash, job.info)
+			}
+		}()
+	}
+
+	for i := range jobs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return lines, nil
+}
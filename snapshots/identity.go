@@ -0,0 +1,135 @@
+package snapshots
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ERROR_IDENTITY_UNKNOWN = fmt.Errorf("identity unknown")
+
+const identityHint = `
+
+*** Please tell me who you are.
+
+Add to .owngit/config (this repository) or ~/.owngitconfig (every repository):
+
+  [user]
+  	name = Your Name
+  	email = you@example.com
+
+or set the GIT_%[3]s_NAME and GIT_%[3]s_EMAIL environment variables`
+
+// dateLayouts are the non-raw formats accepted in GIT_*_DATE and --date.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02 15:04:05",
+	time.RFC1123Z,
+	"Mon, _2 Jan 2006 15:04:05 -0700",
+	"_2 Jan 2006 15:04:05 -0700",
+	time.RubyDate,
+	"Mon Jan _2 15:04:05 2006 -0700",
+	"2006-01-02",
+}
+
+// parseGitDate understands git's raw "<unix> <zone>" format (with an
+// optional leading @), RFC 2822 and ISO 8601 dates.
+func parseGitDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	raw := strings.TrimPrefix(value, "@")
+	parts := strings.Fields(raw)
+	if len(parts) >= 1 && len(parts) <= 2 {
+		if seconds, err := strconv.ParseInt(parts[0], 10, 64); err == nil {
+			loc := time.UTC
+			if len(parts) == 2 {
+				if loc, err = parseTimezone(parts[1]); err != nil {
+					return time.Time{}, fmt.Errorf("invalid date format: %s", value)
+				}
+			}
+			return time.Unix(seconds, 0).In(loc), nil
+		}
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date format: %s", value)
+}
+
+// parseIdent splits "Name <email>" as given to --author.
+func parseIdent(value string) (string, string, error) {
+	lt := strings.Index(value, "<")
+	gt := strings.LastIndex(value, ">")
+	if lt == -1 || gt < lt {
+		return "", "", fmt.Errorf("--author '%s' is not 'Name <email>'", value)
+	}
+	return strings.TrimSpace(value[:lt]), strings.TrimSpace(value[lt+1 : gt]), nil
+}
+
+// identity builds the author ("AUTHOR") or committer ("COMMITTER")
+// signature. Environment variables win over user.name/user.email.
+func identity(cfg *Config, role string, now time.Time) (Signature, error) {
+	sig := Signature{
+		Name:  cfg.Get("user.name"),
+		Email: cfg.Get("user.email"),
+		When:  now,
+	}
+	if name, ok := os.LookupEnv("GIT_" + role + "_NAME"); ok {
+		sig.Name = name
+	}
+	if email, ok := os.LookupEnv("GIT_" + role + "_EMAIL"); ok {
+		sig.Email = email
+	}
+	if date, ok := os.LookupEnv("GIT_" + role + "_DATE"); ok && date != "" {
+		when, err := parseGitDate(date)
+		if err != nil {
+			return Signature{}, err
+		}
+		sig.When = when
+	}
+	if strings.TrimSpace(sig.Name) == "" || strings.TrimSpace(sig.Email) == "" {
+		who := strings.ToUpper(role[:1]) + strings.ToLower(role[1:])
+		return Signature{}, fmt.Errorf("%s %w"+identityHint, who, ERROR_IDENTITY_UNKNOWN, role)
+	}
+	return sig, nil
+}
+
+// commitIdentities returns the author and committer of a new commit.
+// authorFlag and dateFlag are the values of --author and --date.
+func commitIdentities(cfg *Config, authorFlag, dateFlag string) (Signature, Signature, error) {
+	now := time.Now()
+
+	var author Signature
+	var err error
+	if authorFlag != "" {
+		name, email, err := parseIdent(authorFlag)
+		if err != nil {
+			return Signature{}, Signature{}, err
+		}
+		author = Signature{Name: name, Email: email, When: now}
+		if date, ok := os.LookupEnv("GIT_AUTHOR_DATE"); ok && date != "" {
+			if author.When, err = parseGitDate(date); err != nil {
+				return Signature{}, Signature{}, err
+			}
+		}
+	} else if author, err = identity(cfg, "AUTHOR", now); err != nil {
+		return Signature{}, Signature{}, err
+	}
+	if dateFlag != "" {
+		if author.When, err = parseGitDate(dateFlag); err != nil {
+			return Signature{}, Signature{}, err
+		}
+	}
+
+	committer, err := identity(cfg, "COMMITTER", now)
+	if err != nil {
+		return Signature{}, Signature{}, err
+	}
+	return author, committer, nil
+}
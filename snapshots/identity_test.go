@@ -0,0 +1,44 @@
+package snapshots
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGitDate(t *testing.T) {
+	for _, value := range []string{
+		"1700000000 +0545",
+		"@1700000000 +0545",
+		"2023-11-15T03:58:20+05:45",
+		"2023-11-15 03:58:20 +0545",
+		"Wed, 15 Nov 2023 03:58:20 +0545",
+	} {
+		when, err := parseGitDate(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, int64(1700000000), when.Unix(), value)
+		assert.Equal(t, "+0545", when.Format("-0700"), value)
+	}
+
+	_, err := parseGitDate("yesterday-ish")
+	assert.Error(t, err)
+}
+
+func TestIdentityFromEnvironment(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "Env Author")
+	t.Setenv("GIT_AUTHOR_EMAIL", "author@example.com")
+	t.Setenv("GIT_AUTHOR_DATE", "1700000000 +0000")
+	t.Setenv("GIT_COMMITTER_NAME", "")
+	t.Setenv("HOME", t.TempDir())
+
+	cfg, err := LoadConfig("")
+	assert.NoError(t, err)
+
+	author, err := identity(cfg, "AUTHOR", time.Unix(1600000000, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "Env Author <author@example.com> 1700000000 +0000", author.String())
+
+	_, err = identity(cfg, "COMMITTER", author.When)
+	assert.ErrorIs(t, err, ERROR_IDENTITY_UNKNOWN)
+}
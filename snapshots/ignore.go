@@ -0,0 +1,152 @@
+package snapshots
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bibektamang7/own-git/ignore"
+)
+
+// newIgnoreMatcher builds the ignore rules of the repository at gitRoot:
+// core.excludesFile, then info/exclude, then the per-directory files.
+func newIgnoreMatcher(gitRoot string) (*ignore.Matcher, error) {
+	cfg, err := LoadConfig(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var excludesFile []*ignore.Pattern
+	if file := cfg.Get("core.excludesFile"); file != "" {
+		if rest, ok := strings.CutPrefix(file, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			file = filepath.Join(home, rest)
+		}
+		if excludesFile, err = ignore.ReadPatternFile(file, "", file); err != nil {
+			return nil, err
+		}
+	}
+
+	exclude, err := ignore.ReadPatternFile(gitRoot+ROOTDIR+"info/exclude", "", ".owngit/info/exclude")
+	if err != nil {
+		return nil, err
+	}
+	return ignore.NewMatcher(gitRoot, excludesFile, exclude), nil
+}
+
+// trackedDirs adds to dirs every directory that holds a tracked path,
+// so a walk can tell with one lookup whether an ignored directory still
+// has to be entered. A nil dirs starts a new set.
+func trackedDirs[V any](dirs map[string]bool, tracked map[string]V) map[string]bool {
+	if dirs == nil {
+		dirs = make(map[string]bool)
+	}
+	for p := range tracked {
+		for i := len(p) - 1; i > 0; i-- {
+			if p[i] != '/' {
+				continue
+			}
+			if dirs[p[:i]] {
+				// its parents are in already
+				break
+			}
+			dirs[p[:i]] = true
+		}
+	}
+	return dirs
+}
+
+// HandleCheckIgnoreCommand prints which of the given paths are ignored,
+// and with -v the pattern responsible.
+func HandleCheckIgnoreCommand() error {
+	verbose, nonMatching, noIndex := false, false, false
+	var paths []string
+	for _, arg := range os.Args[2:] {
+		switch arg {
+		case "-v", "--verbose":
+			verbose = true
+		case "-n", "--non-matching":
+			nonMatching = true
+		case "--no-index":
+			noIndex = true
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no path specified")
+	}
+	if nonMatching && !verbose {
+		return fmt.Errorf("--non-matching is only valid with --verbose")
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	gitRoot, ok, err := CheckGitFolderExists(cwd)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("outside git repository")
+	}
+	matcher, err := newIgnoreMatcher(gitRoot)
+	if err != nil {
+		return err
+	}
+	tracked := make(map[string]bool)
+	if !noIndex {
+		lines, _, err := readIndex(gitRoot)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			tracked[line.Fullpath] = true
+		}
+	}
+
+	anyIgnored := false
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(gitRoot, abs)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("%s: '%s' is outside repository at '%s'", p, p, gitRoot)
+		}
+		rel = filepath.ToSlash(rel)
+		if tracked[rel] {
+			continue
+		}
+
+		isDir := strings.HasSuffix(p, "/")
+		if info, err := os.Lstat(abs); err == nil && info.IsDir() {
+			isDir = true
+		}
+		pattern, err := matcher.Ignored(rel, isDir)
+		if err != nil {
+			return err
+		}
+
+		ignored := pattern != nil && !pattern.Negate
+		anyIgnored = anyIgnored || ignored
+		switch {
+		case verbose && pattern != nil:
+			fmt.Printf("%s:%d:%s\t%s\n", pattern.Source, pattern.Line, pattern.Text, p)
+		case verbose && nonMatching:
+			fmt.Printf("::\t%s\n", p)
+		case ignored:
+			fmt.Println(p)
+		}
+	}
+	if !anyIgnored {
+		return ERROR_SILENT_EXIT
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package snapshots
+
+import (
+	"os"
+	"time"
+
+	"github.com/bibektamang7/own-git/index"
+)
+
+func indexFilePath(gitRoot string) string {
+	return gitRoot + ROOTDIR + "index"
+}
+
+// readIndex loads the index of the repository at gitRoot. The returned
+// index carries the file's version and timestamp; its entries are
+// converted to lines.
+func readIndex(gitRoot string) ([]IndexLine, *index.Index, error) {
+	idx, err := index.ReadFile(indexFilePath(gitRoot))
+	if err != nil {
+		return nil, nil, err
+	}
+	lines := make([]IndexLine, 0, len(idx.Entries))
+	for _, e := range idx.Entries {
+		lines = append(lines, IndexLine{
+			Fullpath: e.Path,
+			BlobHash: e.Hash,
+			FileMode: e.Mode,
+			Stat:     e.Stat,
+			Stage:    e.Stage,
+
+			AssumeValid:  e.AssumeValid,
+			SkipWorktree: e.SkipWorktree,
+			IntentToAdd:  e.IntentToAdd,
+		})
+	}
+	return lines, idx, nil
+}
+
+// statClean reports whether the stat data cached in line proves that
+// the file described by info is unchanged since it was staged. Racily
+// clean entries never qualify: their content has to be compared.
+func (line *IndexLine) statClean(info os.FileInfo, timestamp time.Time) bool {
+	return line.FileMode == getGitMode(info.Mode()) &&
+		line.Stat.Matches(index.StatFromFileInfo(info)) &&
+		!line.Stat.IsRacy(timestamp)
+}
+
+// writeIndexFile stores lines as a git index in the given version.
+// Like git it smudges racily clean entries, those modified in the
+// second the index is written, by zeroing their size: once a later
+// write makes the index newer than the file, the stat data would
+// otherwise still match after an edit within that second.
+func writeIndexFile(path string, version uint32, lines []IndexLine) error {
+	idx := index.New()
+	if version != 0 {
+		idx.Version = version
+	}
+	now := time.Now().Truncate(time.Second)
+	idx.Entries = make([]index.Entry, 0, len(lines))
+	for _, line := range lines {
+		stat := line.Stat
+		if stat.IsRacy(now) {
+			stat.Size = 0
+		}
+		idx.Entries = append(idx.Entries, index.Entry{
+			Stat:  stat,
+			Mode:  line.FileMode,
+			Hash:  line.BlobHash,
+			Stage: line.Stage,
+			Path:  line.Fullpath,
+
+			AssumeValid:  line.AssumeValid,
+			SkipWorktree: line.SkipWorktree,
+			IntentToAdd:  line.IntentToAdd,
+		})
+	}
+	return index.WriteFile(path, idx)
+}
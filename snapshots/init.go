@@ -33,6 +33,10 @@ var FOLDERS = []string{
 
 var ERROR_CHECK_FOLDER_EXISTS = fmt.Errorf("failed on checking existing folder")
 
+// ERROR_SILENT_EXIT is returned by commands that already reported their
+// outcome and only need to exit with status 1, like cat-file -e.
+var ERROR_SILENT_EXIT = fmt.Errorf("exit status 1")
+
 func CheckGitFolderExists(path string) (string, bool, error) {
 	if path == "" {
 		return "", false, ERROR_CHECK_FOLDER_EXISTS
@@ -74,6 +78,11 @@ func InitializeFoldersAndFiles(path string) error {
 			return err
 		}
 		defer fi.Close()
+		if file == "HEAD" {
+			if _, err := fi.WriteString(SYMREF_PREFIX + BRANCH_PREFIX + DEFAULT_BRANCH + "\n"); err != nil {
+				return err
+			}
+		}
 		if file == "config" {
 			fINI := ini.NewFileINI()
 			for _, config := range DEFAULTCONFIGS {
@@ -5,95 +5,220 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/bibektamang7/own-git/diff"
 )
 
 var ERROR_OUTSIDE_GIT = fmt.Errorf("outside git repository")
 
 type GitLog struct {
-	HeadCommitHash string
-	IsOneline      bool
+	Store          ObjectStore
+	pretty         prettyOptions
+	decorate       bool         // show decorations after the commit hash
+	decorations    *decorations // nil when nothing asks for them
+	graph          *commitGraph // nil without --graph
+	patch          bool         // -p
+	stat           bool         // --stat
+	numstat        bool         // --numstat
+	diffOpts       diffOptions  // the paths and algorithm of the diff
+	firstParent    bool         // merges get a diff against their first parent
+	pickaxe        *pickaxe     // -S or -G; nil shows every commit
+	out            io.Writer
+	shown          int
+	missingNewline bool // the last commit did not end in a newline
 }
 
-func (gl *GitLog) logCommit(gitBasePath, commitHash string) error {
-	commitFilePath := filepath.Join(gitBasePath, ROOTDIR, "objects", commitHash[:2], commitHash[2:])
-	fi, err := os.Open(commitFilePath)
-	if err != nil {
-		return err
+// decoration returns the ref names shown for hash. %d and %D show
+// them even with --no-decorate.
+func (gl *GitLog) decoration(hash string) string {
+	userFormat := gl.pretty.format == PRETTY_FORMAT || gl.pretty.format == PRETTY_TFORMAT
+	if !gl.decorate && !userFormat {
+		return ""
 	}
-	defer fi.Close()
-
-	var commitLines []string
-
-	reader := bufio.NewReader(fi)
+	return gl.decorations.format(hash)
+}
 
-	for {
-		line, err := reader.ReadString('\n')
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
+// logCommit writes one commit, after the graph lines leading to it.
+// Builtin formats other than oneline leave a blank line between
+// commits; "format:" puts a newline between them and "tformat:" after
+// each. With -S or -G, commits whose diff the pickaxe leaves empty are
+// not shown at all, though the graph has moved past them.
+func (gl *GitLog) logCommit(c *RevCommit) error {
+	if gl.graph != nil {
+		gl.graph.update(c)
+	}
+	var pairs []filePair
+	if gl.patch || gl.stat || gl.numstat || gl.pickaxe != nil {
+		var err error
+		if pairs, err = gl.commitPairs(c); err != nil {
 			return err
 		}
-		if line == "\n" {
-			continue
+		if gl.pickaxe != nil {
+			if pairs, err = gl.pickaxe.filter(gl.Store, pairs, gl.diffOpts); err != nil {
+				return err
+			}
+			if len(pairs) == 0 {
+				return nil
+			}
 		}
-		commitLines = append(commitLines, line)
 	}
 
-	hasParent := false
-	authorIdx := 1
-
-	if strings.HasPrefix(commitLines[1], "parent") {
-		authorIdx = 2
-		hasParent = true
-	}
-	if gl.IsOneline {
-		fmt.Printf("%s", commitHash[:7])
-		if commitHash == gl.HeadCommitHash {
-			fmt.Printf(" (HEAD -> main) ")
+	terminated := gl.pretty.format == PRETTY_ONELINE || gl.pretty.format == PRETTY_TFORMAT
+	if gl.shown > 0 && !terminated {
+		// keep the lanes going through the blank line
+		if !gl.missingNewline {
+			gl.graph.showPadding(gl.out)
 		}
-		fmt.Println(commitLines[len(commitLines)-1])
-	} else {
-		line := strings.TrimPrefix(commitLines[authorIdx], "author ")
-		lt := strings.Index(line, "<")
-		gt := strings.Index(line, ">")
+		io.WriteString(gl.out, "\n")
+	}
+	gl.shown++
 
-		if lt == -1 || gt == -1 || gt < lt {
-			return fmt.Errorf("malformed commit file")
+	gl.graph.showCommit(gl.out)
+	entry := gl.pretty.show(c, gl.decoration(c.Hash))
+	gl.missingNewline = !strings.HasSuffix(entry, "\n")
+	gl.graph.showMessage(gl.out, entry)
+	if terminated && !gl.emptyFormat() {
+		if !gl.missingNewline {
+			gl.graph.showPadding(gl.out)
 		}
-		name := strings.TrimSpace(line[:lt])
-		email := line[lt+1 : gt]
-
-		rest := strings.TrimSpace(line[gt+1:])
-		parts := strings.Split(rest, " ")
+		io.WriteString(gl.out, "\n")
+	}
+	if gl.patch || gl.stat || gl.numstat {
+		return gl.logDiff(pairs)
+	}
+	return nil
+}
 
-		timestamp := parts[0]
-		timezone := parts[1]
+// emptyFormat reports whether commits show nothing of their own, as
+// with --format="".
+func (gl *GitLog) emptyFormat() bool {
+	return gl.pretty.format == PRETTY_TFORMAT && gl.pretty.userFormat == ""
+}
 
-		fmt.Printf("commit %s\n", commitHash)
-		if !hasParent {
-			fmt.Printf("Author: %s %s\n", name, email)
-			fmt.Println("Date:  ", timestamp, timezone)
-			fmt.Println(commitLines[3])
-			return nil
+// commitPairs lists what c changed within the log's paths, against its
+// first parent or, for a root commit, against nothing. Merges change
+// nothing unless the log follows first parents only. Like git, --graph
+// diffs against the parents it drew.
+func (gl *GitLog) commitPairs(c *RevCommit) ([]filePair, error) {
+	parents := c.shownParents()
+	if len(parents) > 1 && !gl.firstParent {
+		return nil, nil
+	}
+	old := make(diffSide)
+	if len(parents) > 0 {
+		side, err := treeSide(gl.Store, parents[0])
+		if err != nil {
+			return nil, err
 		}
+		old = side
+	}
+	cur, err := treeSide(gl.Store, c.tree)
+	if err != nil {
+		return nil, err
+	}
+	return diffPairs(filterSide(old, gl.diffOpts.paths), filterSide(cur, gl.diffOpts.paths)), nil
+}
 
-		fmt.Printf("Author: %s %s\n", name, email)
-		fmt.Println("Date:  ", timestamp, timezone)
-		fmt.Println(commitLines[4])
+// logDiff writes the --numstat, --stat and -p output for the pairs of
+// a commit.
+func (gl *GitLog) logDiff(pairs []filePair) error {
+	if len(pairs) == 0 {
+		return nil
+	}
 
+	var b strings.Builder
+	// a blank line after the message, or "---" between the message
+	// and a stat followed by a patch
+	if gl.pretty.format != PRETTY_ONELINE && !gl.emptyFormat() {
+		if gl.stat && gl.patch {
+			b.WriteString("---")
+		}
+		b.WriteString("\n")
+	}
+	if gl.stat || gl.numstat {
+		stats := make([]fileStat, len(pairs))
+		for i, pair := range pairs {
+			var err error
+			if stats[i], err = statFilePair(gl.Store, pair, gl.diffOpts); err != nil {
+				return err
+			}
+		}
+		if gl.numstat {
+			writeNumstat(&b, stats)
+		}
+		if gl.stat {
+			width := statWidth()
+			if gl.graph != nil {
+				width -= gl.graph.width
+			}
+			writeStat(&b, stats, width)
+		}
+		if gl.patch {
+			b.WriteString("\n")
+		}
+	}
+	if gl.patch {
+		for _, pair := range pairs {
+			if err := writeFilePair(&b, gl.Store, pair, gl.diffOpts); err != nil {
+				return err
+			}
+		}
 	}
 
-	if !hasParent {
-		return nil
+	// every line of the diff goes after the graph's lanes
+	for _, line := range strings.SplitAfter(b.String(), "\n") {
+		if line != "" {
+			gl.graph.showPadding(gl.out)
+			io.WriteString(gl.out, line)
+		}
 	}
-	// TODO: "\n" at the end of hash
-	parentParts := strings.Split(commitLines[1], " ")
+	return nil
+}
+
+// parseMaxCount reads the value of -n, --max-count or -<n>.
+func parseMaxCount(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("'%s': not an integer", value)
+	}
+	return n, nil
+}
 
-	return gl.logCommit(gitBasePath, parentParts[1])
+// addRevision pushes or hides the commits named by a revision
+// argument: "rev", "^rev" or "a..b".
+func addRevision(gitRoot string, w *RevWalk, arg string) error {
+	if from, to, ok := splitRange(arg); ok {
+		if err := addRevision(gitRoot, w, "^"+from); err != nil {
+			return err
+		}
+		return addRevision(gitRoot, w, to)
+	}
+	name, hide := strings.CutPrefix(arg, "^")
+	hash, err := resolveCommitish(gitRoot, w.store, name)
+	if err != nil {
+		return err
+	}
+	if hide {
+		return w.Hide(hash)
+	}
+	return w.Push(hash)
+}
 
+// pushHEAD starts the walk at HEAD, for a log without revisions.
+func pushHEAD(gitRoot string, w *RevWalk) error {
+	hash, err := GetPreviousCommitHash(gitRoot)
+	if err == io.EOF {
+		branch, _, _ := CurrentBranch(gitRoot)
+		return fmt.Errorf("your current branch '%s' does not have any commits yet", branch)
+	}
+	if err != nil {
+		return err
+	}
+	return w.Push(hash)
 }
 
 func HandleLog() error {
@@ -109,21 +234,300 @@ func HandleLog() error {
 		return ERROR_OUTSIDE_GIT
 	}
 
-	commitHash, err := GetPreviousCommitHash(filePath)
+	cfg, err := LoadConfig(filePath)
 	if err != nil {
 		return err
 	}
-	onelineArg := os.Args[2]
-	isOnlineArg := false
-	if onelineArg == "--oneline" {
-		isOnlineArg = true
+	decorate := DECORATE_AUTO
+	if value := cfg.Get("log.decorate"); value != "" {
+		if decorate, err = parseDecorate(value); err != nil {
+			return err
+		}
 	}
-	gitLog := &GitLog{
-		IsOneline:      isOnlineArg,
-		HeadCommitHash: commitHash,
+	filter := &decorationFilter{}
+	store := NewObjectStore(filePath)
+	walk := NewRevWalk(store)
+	diffOpts := diffOptions{context: DEFAULT_DIFF_CONTEXT}
+	if name := cfg.Get("diff.algorithm"); name != "" {
+		if diffOpts.lines.Algorithm, err = diff.ParseAlgorithm(name); err != nil {
+			return fmt.Errorf("unknown value for config 'diff.algorithm': %s", name)
+		}
+	}
+	patch, stat, numstat := false, false, false
+	grep := grepOptions{patternType: PATTERN_BASIC}
+	var pickaxeNeedle string
+	pickaxeGrep, pickaxeRegex, pickaxeSet := false, false, false
+	now := time.Now()
+
+	pretty := defaultPrettyOptions()
+	graph := false
+	var revs, paths []string
+	args := os.Args[2:]
+	// with an explicit "--" everything before it is a revision
+	dashed := slices.Contains(args, "--")
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			paths = append(paths, args[i+1:]...)
+			i = len(args)
+		case arg == "-p" || arg == "-u" || arg == "--patch":
+			patch = true
+		case arg == "--stat":
+			stat = true
+		case arg == "--numstat":
+			numstat = true
+		case isOption(arg, "--author"):
+			value, err := optionValue(args, &i)
+			if err != nil {
+				return err
+			}
+			grep.authors = append(grep.authors, value)
+		case isOption(arg, "--committer"):
+			value, err := optionValue(args, &i)
+			if err != nil {
+				return err
+			}
+			grep.committers = append(grep.committers, value)
+		case isOption(arg, "--grep"):
+			value, err := optionValue(args, &i)
+			if err != nil {
+				return err
+			}
+			grep.messages = append(grep.messages, value)
+		case isOption(arg, "--since") || isOption(arg, "--after"):
+			value, err := optionValue(args, &i)
+			if err != nil {
+				return err
+			}
+			if walk.Since, err = approxidate(value, now); err != nil {
+				return err
+			}
+		case isOption(arg, "--until") || isOption(arg, "--before"):
+			value, err := optionValue(args, &i)
+			if err != nil {
+				return err
+			}
+			if walk.Until, err = approxidate(value, now); err != nil {
+				return err
+			}
+		case arg == "-i" || arg == "--regexp-ignore-case":
+			grep.ignoreCase = true
+		case arg == "-E" || arg == "--extended-regexp":
+			grep.patternType = PATTERN_EXTENDED
+		case arg == "-F" || arg == "--fixed-strings":
+			grep.patternType = PATTERN_FIXED
+		case arg == "--basic-regexp":
+			grep.patternType = PATTERN_BASIC
+		case arg == "--all-match":
+			grep.allMatch = true
+		case arg == "--invert-grep":
+			grep.invert = true
+		case strings.HasPrefix(arg, "-S") || strings.HasPrefix(arg, "-G"):
+			if pickaxeSet && pickaxeGrep != (arg[1] == 'G') {
+				return fmt.Errorf("-G and -S are mutually exclusive")
+			}
+			pickaxeNeedle, pickaxeGrep, pickaxeSet = arg[2:], arg[1] == 'G', true
+			if arg[2:] == "" {
+				if i+1 >= len(args) {
+					return fmt.Errorf("option '%s' requires a value", arg)
+				}
+				i++
+				pickaxeNeedle = args[i]
+			}
+		case arg == "--pickaxe-regex":
+			pickaxeRegex = true
+		case arg == "--oneline":
+			pretty.format, pretty.abbrev = PRETTY_ONELINE, true
+		case arg == "--pretty":
+			pretty.format = PRETTY_MEDIUM
+		case strings.HasPrefix(arg, "--pretty="):
+			if err := pretty.parsePretty(strings.TrimPrefix(arg, "--pretty=")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(arg, "--format="):
+			if err := pretty.parsePretty(strings.TrimPrefix(arg, "--format=")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(arg, "--date="):
+			if pretty.dateMode, err = parseDateMode(strings.TrimPrefix(arg, "--date=")); err != nil {
+				return err
+			}
+		case arg == "--decorate":
+			decorate = DECORATE_SHORT
+		case strings.HasPrefix(arg, "--decorate="):
+			if decorate, err = parseDecorate(strings.TrimPrefix(arg, "--decorate=")); err != nil {
+				return err
+			}
+		case arg == "--no-decorate":
+			decorate = DECORATE_NO
+		case strings.HasPrefix(arg, "--decorate-refs="):
+			filter.Include(strings.TrimPrefix(arg, "--decorate-refs="))
+		case strings.HasPrefix(arg, "--decorate-refs-exclude="):
+			filter.Exclude(strings.TrimPrefix(arg, "--decorate-refs-exclude="))
+		case arg == "--abbrev-commit":
+			pretty.abbrev = true
+		case arg == "--no-abbrev-commit":
+			pretty.abbrev = false
+		case arg == "--topo-order":
+			walk.TopoOrder, walk.DateOrder = true, false
+		case arg == "--date-order":
+			walk.TopoOrder, walk.DateOrder = false, true
+		case arg == "--graph":
+			graph = true
+		case arg == "--first-parent":
+			walk.FirstParent = true
+		case arg == "-n" && i+1 < len(args):
+			i++
+			if walk.MaxCount, err = parseMaxCount(args[i]); err != nil {
+				return err
+			}
+		case strings.HasPrefix(arg, "--max-count="):
+			if walk.MaxCount, err = parseMaxCount(strings.TrimPrefix(arg, "--max-count=")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(arg, "-n"):
+			if walk.MaxCount, err = parseMaxCount(arg[2:]); err != nil {
+				return err
+			}
+		case len(arg) > 1 && arg[0] == '-' && isDigits(arg[1:]):
+			walk.MaxCount, _ = strconv.Atoi(arg[1:])
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return fmt.Errorf("unrecognized argument: %s", arg)
+		case len(paths) == 0 && (dashed || isRevisionArg(filePath, store, arg)):
+			revs = append(revs, arg)
+		default:
+			if _, err := os.Lstat(arg); err != nil {
+				return fmt.Errorf("ambiguous argument '%s': unknown revision or path not in the working tree", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if diffOpts.paths, err = repoPaths(filePath, paths); err != nil {
+		return err
 	}
-	if err := gitLog.logCommit(filePath, commitHash); err != nil {
+	walk.Paths = diffOpts.paths
+
+	match, err := grep.compile()
+	if err != nil {
 		return err
 	}
+	if match != nil {
+		walk.Match = match.matches
+	}
+	var pick *pickaxe
+	if pickaxeSet {
+		if pick, err = newPickaxe(pickaxeNeedle, pickaxeGrep, pickaxeRegex, grep.ignoreCase); err != nil {
+			return err
+		}
+	}
+
+	positive := false
+	for _, rev := range revs {
+		if err := addRevision(filePath, walk, rev); err != nil {
+			return err
+		}
+		if !strings.HasPrefix(rev, "^") {
+			positive = true
+		}
+	}
+	if !positive {
+		if err := pushHEAD(filePath, walk); err != nil {
+			return err
+		}
+	}
+
+	// the graph needs parents after their children, and parents
+	// that skip the commits the paths leave out
+	if graph && !walk.DateOrder {
+		walk.TopoOrder = true
+	}
+	walk.RewriteParents = graph
+
+	if decorate == DECORATE_AUTO {
+		decorate = DECORATE_NO
+		if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			decorate = DECORATE_SHORT
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	gitLog := &GitLog{
+		Store:       store,
+		pretty:      pretty,
+		decorate:    decorate != DECORATE_NO,
+		patch:       patch,
+		stat:        stat,
+		numstat:     numstat,
+		diffOpts:    diffOpts,
+		firstParent: walk.FirstParent,
+		pickaxe:     pick,
+		out:         out,
+	}
+	if gitLog.decorate || pretty.format == PRETTY_FORMAT || pretty.format == PRETTY_TFORMAT {
+		gitLog.decorations, err = loadDecorations(filePath, store, filter, decorate == DECORATE_FULL)
+		if err != nil {
+			return err
+		}
+	}
+	if graph {
+		gitLog.graph = newCommitGraph(walk)
+	}
+	// -n counts the commits shown, not those the pickaxe dropped, so
+	// with a pickaxe the limit is kept here rather than by the walk
+	limit := walk.MaxCount
+	if pick != nil {
+		walk.MaxCount = -1
+	}
+	for limit < 0 || gitLog.shown < limit {
+		c, err := walk.Next()
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			return nil
+		}
+		if err := gitLog.logCommit(c); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// isRevisionArg reports whether arg names commits rather than a path.
+func isRevisionArg(gitRoot string, store ObjectStore, arg string) bool {
+	if _, _, ok := splitRange(arg); ok {
+		return isCommitRange(gitRoot, store, arg)
+	}
+	_, err := resolveCommitish(gitRoot, store, strings.TrimPrefix(arg, "^"))
+	return err == nil
+}
+
+// isOption reports whether arg is the long option name, given with
+// its value as "--name=value" or followed by it.
+func isOption(arg, name string) bool {
+	return arg == name || strings.HasPrefix(arg, name+"=")
+}
+
+// optionValue returns the value of the long option at args[*i],
+// moving past the next argument when the value is given there.
+func optionValue(args []string, i *int) (string, error) {
+	if _, value, ok := strings.Cut(args[*i], "="); ok {
+		return value, nil
+	}
+	if *i+1 >= len(args) {
+		return "", fmt.Errorf("option '%s' requires a value", args[*i])
+	}
+	*i++
+	return args[*i], nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,23 @@
+package snapshots
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushHEAD(t *testing.T) {
+	root := newStatusRepo(t)
+	store := NewObjectStore(root)
+	w := NewRevWalk(store)
+	err := pushHEAD(root, w)
+	assert.EqualError(t, err, "your current branch 'main' does not have any commits yet")
+
+	hashes := make(map[string]string)
+	writeTestCommit(t, store, hashes, "root", 1)
+	writeTestCommit(t, store, hashes, "a", 2, "root")
+	assert.NoError(t, writeRef(root, BRANCH_PREFIX+"main", hashes["a"]))
+	w = NewRevWalk(store)
+	assert.NoError(t, pushHEAD(root, w))
+	assert.Equal(t, []string{"a", "root"}, walkNames(t, w, hashes))
+}
@@ -0,0 +1,374 @@
+package snapshots
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bibektamang7/own-git/diff"
+)
+
+// pattern syntaxes of --grep, --author and --committer
+const (
+	PATTERN_BASIC    = "basic" // POSIX basic regular expressions, git's default
+	PATTERN_EXTENDED = "extended"
+	PATTERN_FIXED    = "fixed"
+)
+
+// grepOptions collects the commit matching options of log until they
+// are all known, since -i, -E and -F apply to patterns given before
+// them too.
+type grepOptions struct {
+	authors     []string
+	committers  []string
+	messages    []string
+	patternType string
+	ignoreCase  bool
+	allMatch    bool // every --grep must match, not just one
+	invert      bool // show commits whose message does not match
+}
+
+// commitFilter picks the commits log shows by author, committer and
+// message.
+type commitFilter struct {
+	authors    []*regexp.Regexp
+	committers []*regexp.Regexp
+	messages   []*regexp.Regexp
+	allMatch   bool
+	invert     bool
+}
+
+// compile builds the filter, or returns nil when there is nothing to
+// filter on.
+func (o grepOptions) compile() (*commitFilter, error) {
+	if len(o.authors)+len(o.committers)+len(o.messages) == 0 {
+		return nil, nil
+	}
+	f := &commitFilter{allMatch: o.allMatch, invert: o.invert}
+	for _, group := range []struct {
+		patterns []string
+		out      *[]*regexp.Regexp
+	}{{o.authors, &f.authors}, {o.committers, &f.committers}, {o.messages, &f.messages}} {
+		for _, pattern := range group.patterns {
+			re, err := compilePattern(pattern, o.patternType, o.ignoreCase)
+			if err != nil {
+				return nil, err
+			}
+			*group.out = append(*group.out, re)
+		}
+	}
+	return f, nil
+}
+
+// matchesAny reports whether one of the patterns matches one of the
+// lines.
+func matchesAny(patterns []*regexp.Regexp, lines []string) bool {
+	for _, re := range patterns {
+		if matchesLine(re, lines) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesLine(re *regexp.Regexp, lines []string) bool {
+	for _, line := range lines {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether c passes the filter. Several --author or
+// --committer patterns need only one of them to match, like several
+// --grep patterns without --all-match. --invert-grep keeps the commits
+// whose message matches none of the --grep patterns, with or without
+// --all-match, and leaves --author and --committer alone.
+func (f *commitFilter) matches(c *RevCommit) bool {
+	author := []string{fmt.Sprintf("%s <%s>", c.author.Name, c.author.Email)}
+	if len(f.authors) > 0 && !matchesAny(f.authors, author) {
+		return false
+	}
+	committer := []string{fmt.Sprintf("%s <%s>", c.commiter.Name, c.commiter.Email)}
+	if len(f.committers) > 0 && !matchesAny(f.committers, committer) {
+		return false
+	}
+	if len(f.messages) == 0 {
+		return true
+	}
+
+	lines := strings.Split(c.message, "\n")
+	matched := matchesAny(f.messages, lines)
+	if f.invert {
+		return !matched
+	}
+	if f.allMatch {
+		for _, re := range f.messages {
+			if !matchesLine(re, lines) {
+				matched = false
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// compilePattern compiles a pattern of the given syntax.
+func compilePattern(pattern, patternType string, ignoreCase bool) (*regexp.Regexp, error) {
+	expr := pattern
+	switch patternType {
+	case PATTERN_FIXED:
+		expr = regexp.QuoteMeta(pattern)
+	case PATTERN_EXTENDED:
+		expr = translateRegexp(pattern, false)
+	default:
+		expr = translateRegexp(pattern, true)
+	}
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression '%s': %w", pattern, err)
+	}
+	return re, nil
+}
+
+// translateRegexp rewrites a POSIX regular expression in Go's syntax.
+// Basic ones need \( \) \{ \} \| \+ \? for what extended ones write
+// without the backslash. In both, a backslash inside brackets is an
+// ordinary character and \< \> match at word boundaries.
+func translateRegexp(pattern string, basic bool) string {
+	var b strings.Builder
+	atStart := true // where '*' is an ordinary character and '^' an anchor
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		start := atStart
+		atStart = false
+		switch {
+		case c == '[':
+			end := bracketEnd(pattern, i)
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			b.WriteByte('[')
+			for _, ch := range []byte(pattern[i+1 : end]) {
+				if ch == '\\' {
+					b.WriteString(`\\`)
+				} else {
+					b.WriteByte(ch)
+				}
+			}
+			b.WriteByte(']')
+			i = end
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			next := pattern[i]
+			switch {
+			case next == '<' || next == '>':
+				b.WriteString(`\b`)
+			case basic && strings.IndexByte("(){}|+?", next) >= 0:
+				b.WriteByte(next)
+				atStart = next == '(' || next == '|'
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(next)
+			}
+		case basic && strings.IndexByte("(){}|+?", c) >= 0:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '*' && start:
+			b.WriteString(`\*`)
+		case c == '^':
+			if basic && !start {
+				b.WriteString(`\^`)
+			} else {
+				b.WriteByte('^')
+			}
+			atStart = start
+		case c == '$' && basic && !atEnd(pattern, i):
+			b.WriteString(`\$`)
+		default:
+			b.WriteByte(c)
+			atStart = !basic && (c == '(' || c == '|')
+		}
+	}
+	return b.String()
+}
+
+// bracketEnd finds the ']' closing the bracket expression at i, where
+// a leading ']' and classes such as [:alpha:] do not count.
+func bracketEnd(pattern string, i int) int {
+	j := i + 1
+	if j < len(pattern) && pattern[j] == '^' {
+		j++
+	}
+	if j < len(pattern) && pattern[j] == ']' {
+		j++
+	}
+	for ; j < len(pattern); j++ {
+		switch {
+		case pattern[j] == ']':
+			return j
+		case pattern[j] == '[' && j+1 < len(pattern) && strings.IndexByte(":.=", pattern[j+1]) >= 0:
+			end := strings.Index(pattern[j+2:], string(pattern[j+1])+"]")
+			if end < 0 {
+				return -1
+			}
+			j += end + 3
+		}
+	}
+	return -1
+}
+
+// atEnd reports whether the '$' at i ends a basic regular expression
+// or one of its groups or alternatives.
+func atEnd(pattern string, i int) bool {
+	rest := pattern[i+1:]
+	return rest == "" || strings.HasPrefix(rest, `\)`) || strings.HasPrefix(rest, `\|`)
+}
+
+// pickaxe keeps the file pairs of a diff that add or remove a string
+// (-S) or change lines matching a regular expression (-G).
+type pickaxe struct {
+	re   *regexp.Regexp
+	grep bool // -G
+}
+
+// newPickaxe compiles the needle of -S, a fixed string unless regex
+// is set, or the extended regular expression of -G.
+func newPickaxe(needle string, grep, regex, ignoreCase bool) (*pickaxe, error) {
+	expr := regexp.QuoteMeta(needle)
+	if grep || regex {
+		expr = translateRegexp(needle, false)
+	}
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	if grep {
+		expr = "(?m)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %s: %w", needle, err)
+	}
+	return &pickaxe{re: re, grep: grep}, nil
+}
+
+// filter returns the pairs the pickaxe picks.
+func (p *pickaxe) filter(store ObjectStore, pairs []filePair, opts diffOptions) ([]filePair, error) {
+	var picked []filePair
+	for _, pair := range pairs {
+		if pair.old != nil && pair.new != nil && pair.old.hash == pair.new.hash {
+			continue
+		}
+		a, err := readDiffContent(store, pair.old)
+		if err != nil {
+			return nil, err
+		}
+		b, err := readDiffContent(store, pair.new)
+		if err != nil {
+			return nil, err
+		}
+		if p.matches(a, b, pair, opts) {
+			picked = append(picked, pair)
+		}
+	}
+	return picked, nil
+}
+
+// matches looks at one file pair. -S compares how often the needle
+// occurs on each side; -G looks for it in the added and removed lines,
+// or anywhere in a file added or deleted, skipping binary files.
+func (p *pickaxe) matches(a, b []byte, pair filePair, opts diffOptions) bool {
+	if !p.grep {
+		count := func(data []byte, exists bool) int {
+			if !exists {
+				return 0
+			}
+			return len(p.re.FindAllIndex(data, -1))
+		}
+		return count(a, pair.old != nil) != count(b, pair.new != nil)
+	}
+
+	if diff.IsBinary(a) || diff.IsBinary(b) {
+		return false
+	}
+	if pair.old == nil {
+		return p.re.Match(b)
+	}
+	if pair.new == nil {
+		return p.re.Match(a)
+	}
+	oldLines, newLines := diff.SplitLines(a), diff.SplitLines(b)
+	for _, edit := range diff.Lines(oldLines, newLines, opts.lines) {
+		var line string
+		switch edit.Op {
+		case diff.Delete:
+			line = oldLines[edit.A]
+		case diff.Insert:
+			line = newLines[edit.B]
+		default:
+			continue
+		}
+		if p.re.MatchString(strings.TrimSuffix(line, "\n")) {
+			return true
+		}
+	}
+	return false
+}
+
+// relativeUnits are the units approxidate counts back in.
+var relativeUnits = map[string]func(t time.Time, n int) time.Time{
+	"second": func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Second) },
+	"minute": func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Minute) },
+	"hour":   func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Hour) },
+	"day":    func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * 24 * time.Hour) },
+	"week":   func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * 7 * 24 * time.Hour) },
+	"month":  func(t time.Time, n int) time.Time { return t.AddDate(0, -n, 0) },
+	"year":   func(t time.Time, n int) time.Time { return t.AddDate(-n, 0, 0) },
+}
+
+// approxidate reads the dates of --since and --until: anything
+// parseGitDate knows, a day that keeps the time of now, as git does,
+// "now", "yesterday", or a relative date such as "2 weeks ago" or
+// "3.days".
+func approxidate(value string, now time.Time) (time.Time, error) {
+	if t, err := parseGitDate(value); err == nil {
+		if _, err := time.Parse("2006-01-02", strings.TrimSpace(value)); err == nil {
+			t = time.Date(t.Year(), t.Month(), t.Day(), now.Hour(), now.Minute(), now.Second(), 0, t.Location())
+		}
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "Jan 2 2006", "Jan 2, 2006", "2 Jan 2006"} {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(value), time.Local); err == nil {
+			if !strings.Contains(layout, "15") {
+				t = time.Date(t.Year(), t.Month(), t.Day(), now.Hour(), now.Minute(), now.Second(), 0, t.Location())
+			}
+			return t, nil
+		}
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return r == ' ' || r == '.' || r == '\t'
+	})
+	if len(words) > 0 && words[len(words)-1] == "ago" {
+		words = words[:len(words)-1]
+	}
+	switch {
+	case len(words) == 1 && words[0] == "now":
+		return now, nil
+	case len(words) == 1 && words[0] == "yesterday":
+		return relativeUnits["day"](now, 1), nil
+	case len(words) == 2:
+		n, err := strconv.Atoi(words[0])
+		if shift, ok := relativeUnits[strings.TrimSuffix(words[1], "s")]; ok && err == nil {
+			return shift(now, n), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date format: %s", value)
+}
@@ -0,0 +1,157 @@
+package snapshots
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompilePattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, patternType string
+		text                 string
+		want                 bool
+	}{
+		{"a+b", PATTERN_BASIC, "a+b", true},
+		{"a+b", PATTERN_BASIC, "aab", false},
+		{`a\+b`, PATTERN_BASIC, "aab", true},
+		{"a+b", PATTERN_EXTENDED, "aab", true},
+		{"(x)", PATTERN_BASIC, "(x)", true},
+		{`\(x\|y\)z`, PATTERN_BASIC, "yz", true},
+		{"*star", PATTERN_BASIC, "*star", true},
+		{"a^b$c", PATTERN_BASIC, "a^b$c", true},
+		{"^fix$", PATTERN_BASIC, "fix", true},
+		{`[\]x`, PATTERN_BASIC, `\x`, true},
+		{"[[:digit:]]", PATTERN_BASIC, "7", true},
+		{`\<fix\>`, PATTERN_BASIC, "prefix", false},
+		{"x*y", PATTERN_FIXED, "xxy", false},
+		{"x*y", PATTERN_FIXED, "x*y", true},
+	} {
+		re, err := compilePattern(tc.pattern, tc.patternType, false)
+		assert.NoError(t, err, tc.pattern)
+		assert.Equal(t, tc.want, re.MatchString(tc.text), "%s on %s", tc.pattern, tc.text)
+	}
+
+	re, err := compilePattern("FIX", PATTERN_BASIC, true)
+	assert.NoError(t, err)
+	assert.True(t, re.MatchString("a fix"))
+
+	_, err = compilePattern(`\(open`, PATTERN_BASIC, false)
+	assert.Error(t, err)
+}
+
+func TestCommitFilter(t *testing.T) {
+	commit := func(author, committer, message string) *RevCommit {
+		return &RevCommit{Commit: &Commit{
+			author:   Signature{Name: author, Email: "a@example.com"},
+			commiter: Signature{Name: committer, Email: "c@example.com"},
+			message:  message,
+		}}
+	}
+	fix := commit("Alice", "Bob", "Fix the config\n\nSets timeout=30\n")
+	docs := commit("Bob", "Bob", "Write docs\n")
+
+	for _, tc := range []struct {
+		opts      grepOptions
+		fix, docs bool
+	}{
+		{grepOptions{authors: []string{"Alice"}}, true, false},
+		{grepOptions{authors: []string{"Carol", "Bob"}}, false, true},
+		{grepOptions{authors: []string{"^Bob <a@example"}}, false, true},
+		{grepOptions{committers: []string{"Bob"}}, true, true},
+		{grepOptions{messages: []string{"timeout"}}, true, false},
+		{grepOptions{messages: []string{"fix"}}, false, false},
+		{grepOptions{messages: []string{"fix"}, ignoreCase: true}, true, false},
+		{grepOptions{messages: []string{"Fix", "docs"}}, true, true},
+		{grepOptions{messages: []string{"Fix", "docs"}, allMatch: true}, false, false},
+		{grepOptions{messages: []string{"Fix", "timeout"}, allMatch: true}, true, false},
+		{grepOptions{messages: []string{"Fix"}, invert: true}, false, true},
+		{grepOptions{messages: []string{"Fix", "docs"}, allMatch: true, invert: true}, false, false},
+		{grepOptions{messages: []string{"Fix"}, authors: []string{"Bob"}, invert: true}, false, true},
+		{grepOptions{messages: []string{"Fix"}, authors: []string{"Alice"}, invert: true}, false, false},
+	} {
+		tc.opts.patternType = PATTERN_BASIC
+		f, err := tc.opts.compile()
+		assert.NoError(t, err)
+		assert.Equal(t, tc.fix, f.matches(fix), "%+v", tc.opts)
+		assert.Equal(t, tc.docs, f.matches(docs), "%+v", tc.opts)
+	}
+
+	f, err := grepOptions{}.compile()
+	assert.NoError(t, err)
+	assert.Nil(t, f)
+}
+
+func TestPickaxe(t *testing.T) {
+	store := NewMemoryStore()
+	entry := func(content string) *diffEntry {
+		hash, err := store.Write(Blob, []byte(content))
+		assert.NoError(t, err)
+		return &diffEntry{mode: 0100644, hash: hash}
+	}
+	pairs := []filePair{
+		{oldPath: "moved", newPath: "moved", old: entry("call()\na\nb\n"), new: entry("a\nb\ncall()\n")},
+		{oldPath: "added", newPath: "added", old: entry("a\n"), new: entry("a\ncall()\n")},
+		{oldPath: "new", newPath: "new", new: entry("call(x)\n")},
+		{oldPath: "other", newPath: "other", old: entry("x\n"), new: entry("y\n")},
+	}
+	paths := func(pairs []filePair) []string {
+		var names []string
+		for _, pair := range pairs {
+			names = append(names, pair.path())
+		}
+		return names
+	}
+
+	// -S counts occurrences, so moving a line is no change
+	p, err := newPickaxe("call()", false, false, false)
+	assert.NoError(t, err)
+	picked, err := p.filter(store, pairs, diffOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"added"}, paths(picked))
+
+	p, err = newPickaxe(`call\(x?\)`, false, true, false)
+	assert.NoError(t, err)
+	picked, err = p.filter(store, pairs, diffOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"added", "new"}, paths(picked))
+
+	// -G looks at the changed lines
+	p, err = newPickaxe("^call", true, false, false)
+	assert.NoError(t, err)
+	picked, err = p.filter(store, pairs, diffOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"moved", "added", "new"}, paths(picked))
+
+	p, err = newPickaxe("Y", true, false, true)
+	assert.NoError(t, err)
+	picked, err = p.filter(store, pairs, diffOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"other"}, paths(picked))
+}
+
+func TestApproxidate(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 4, 5, 0, time.Local)
+	for _, tc := range []struct {
+		value string
+		want  time.Time
+	}{
+		{"now", now},
+		{"yesterday", now.Add(-24 * time.Hour)},
+		{"2 weeks ago", now.Add(-14 * 24 * time.Hour)},
+		{"3.days.ago", now.Add(-3 * 24 * time.Hour)},
+		{"1 hour", now.Add(-time.Hour)},
+		{"1 month ago", time.Date(2024, 2, 10, 15, 4, 5, 0, time.Local)},
+		{"2023-12-25", time.Date(2023, 12, 25, 15, 4, 5, 0, time.Local)},
+		{"2023-12-25 10:00", time.Date(2023, 12, 25, 10, 0, 0, 0, time.Local)},
+		{"@1700000000", time.Unix(1700000000, 0)},
+	} {
+		got, err := approxidate(tc.value, now)
+		assert.NoError(t, err, tc.value)
+		assert.True(t, tc.want.Equal(got), "%s: %v", tc.value, got)
+	}
+
+	_, err := approxidate("someday", now)
+	assert.Error(t, err)
+}
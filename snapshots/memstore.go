@@ -0,0 +1,84 @@
+package snapshots
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+type memObject struct {
+	objType ContentType
+	content []byte
+}
+
+// MemoryStore keeps objects in a map. It is meant for tests and for
+// commands that want to stage objects before touching the disk.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]memObject
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		objects: make(map[string]memObject),
+	}
+}
+
+func (m *MemoryStore) Has(hash string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.objects[hash]
+	return ok
+}
+
+func (m *MemoryStore) Read(hash string) (ContentType, []byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.objects[hash]
+	if !ok {
+		return "", nil, ERROR_OBJECT_NOT_FOUND
+	}
+	return obj.objType, bytes.Clone(obj.content), nil
+}
+
+func (m *MemoryStore) Stream(hash string) (ContentType, int64, io.ReadCloser, error) {
+	objType, content, err := m.Read(hash)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	return objType, int64(len(content)), io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (m *MemoryStore) Write(objType ContentType, content []byte) (string, error) {
+	hash := hashObject(objType, content)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.objects[hash]; !ok {
+		m.objects[hash] = memObject{objType: objType, content: bytes.Clone(content)}
+	}
+	return hash, nil
+}
+
+func (m *MemoryStore) WriteStream(objType ContentType, size int64, r io.Reader) (string, error) {
+	content, err := io.ReadAll(io.LimitReader(r, size+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(content)) != size {
+		return "", ERROR_SIZE_MISMATCH
+	}
+	return m.Write(objType, content)
+}
+
+func (m *MemoryStore) findByPrefix(prefix string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var hashes []string
+	for hash := range m.objects {
+		if strings.HasPrefix(hash, prefix) {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes, nil
+}
@@ -0,0 +1,880 @@
+package snapshots
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bibektamang7/own-git/diff"
+)
+
+// files kept next to HEAD while a merge is in progress
+const (
+	MERGE_HEAD = "MERGE_HEAD" // the commit being merged
+	MERGE_MSG  = "MERGE_MSG"  // the message of the merge commit
+	MERGE_MODE = "MERGE_MODE" // "no-ff" when the merge was asked not to fast-forward
+	ORIG_HEAD  = "ORIG_HEAD"  // HEAD before the merge, which --abort goes back to
+)
+
+var (
+	ERROR_MERGE_IN_PROGRESS   = fmt.Errorf("you have not concluded your merge (MERGE_HEAD exists)")
+	ERROR_NO_MERGE            = fmt.Errorf("there is no merge in progress (MERGE_HEAD missing)")
+	ERROR_UNMERGED_FILES      = fmt.Errorf("merging is not possible because you have unmerged files")
+	ERROR_NOT_FAST_FORWARD    = fmt.Errorf("not possible to fast-forward, aborting")
+	ERROR_MERGE_LOCAL_CHANGES = fmt.Errorf("your local changes would be overwritten by merge")
+)
+
+// flags mergeBases paints commits with, as in git's commit-reach.c
+const (
+	paintOne    = 1 << iota // reachable from the first side
+	paintTwo                // reachable from the second side
+	paintStale              // reachable from a common ancestor found
+	paintResult             // a common ancestor found
+)
+
+// mergeBases returns the best common ancestors of the commits in ones
+// and those in twos, newest first: the commits reachable from both
+// that are not ancestors of another such commit. Like git, it paints
+// both sides down in committer date order until only commits below
+// the ancestors found are left.
+func mergeBases(store ObjectStore, ones, twos []string) ([]string, error) {
+	for _, one := range ones {
+		if slices.Contains(twos, one) {
+			return []string{one}, nil
+		}
+	}
+
+	walk := NewRevWalk(store)
+	flags := make(map[*RevCommit]int)
+	var queue []*RevCommit
+	push := func(c *RevCommit) {
+		i := sort.Search(len(queue), func(i int) bool {
+			return queue[i].Date() < c.Date()
+		})
+		queue = slices.Insert(queue, i, c)
+	}
+	for _, side := range []struct {
+		hashes []string
+		flag   int
+	}{{ones, paintOne}, {twos, paintTwo}} {
+		for _, hash := range side.hashes {
+			c, err := walk.lookup(hash)
+			if err != nil {
+				return nil, err
+			}
+			flags[c] |= side.flag
+			push(c)
+		}
+	}
+
+	var found []*RevCommit
+	for slices.ContainsFunc(queue, func(c *RevCommit) bool { return flags[c]&paintStale == 0 }) {
+		c := queue[0]
+		queue = queue[1:]
+		f := flags[c] & (paintOne | paintTwo | paintStale)
+		if f == paintOne|paintTwo {
+			if flags[c]&paintResult == 0 {
+				flags[c] |= paintResult
+				found = append(found, c)
+			}
+			// whatever lies below is a worse common ancestor
+			f |= paintStale
+		}
+		for _, p := range c.Parents {
+			if flags[p]&f == f {
+				continue
+			}
+			if _, err := walk.lookup(p.Hash); err != nil {
+				return nil, err
+			}
+			flags[p] |= f
+			push(p)
+		}
+	}
+
+	var candidates []*RevCommit
+	for _, c := range found {
+		if flags[c]&paintStale == 0 {
+			candidates = append(candidates, c)
+		}
+	}
+	var bases []*RevCommit
+	for i, c := range candidates {
+		redundant := false
+		for j, other := range candidates {
+			if i == j {
+				continue
+			}
+			below, err := isAncestor(store, c.Hash, other.Hash)
+			if err != nil {
+				return nil, err
+			}
+			if below {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			bases = append(bases, c)
+		}
+	}
+	sort.SliceStable(bases, func(i, j int) bool {
+		return bases[i].Date() > bases[j].Date()
+	})
+
+	hashes := make([]string, len(bases))
+	for i, c := range bases {
+		hashes[i] = c.Hash
+	}
+	return hashes, nil
+}
+
+// mergeSide is one side of a merge: the commits it stands for, several
+// when it is a merge of merge bases, and its files.
+type mergeSide struct {
+	commits []string
+	files   diffSide
+}
+
+// mergedPath is how one path of a merge turned out.
+type mergedPath struct {
+	result     *diffEntry    // nil when the path is gone
+	stages     [3]*diffEntry // the base, ours and theirs
+	conflict   bool
+	reason     string // the kind of conflict the message names
+	automerged bool   // the lines of both sides were merged
+}
+
+// treeMerge is the outcome of merging two sides.
+type treeMerge struct {
+	files     diffSide                 // the result, conflicted paths as left in the working tree
+	conflicts map[string][3]*diffEntry // the base, ours and theirs of conflicted paths
+	messages  map[string][]string      // what happened, by path
+}
+
+// report lists the messages of the merge in path order.
+func (m *treeMerge) report() []string {
+	paths := make([]string, 0, len(m.messages))
+	for p := range m.messages {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var lines []string
+	for _, p := range paths {
+		lines = append(lines, m.messages[p]...)
+	}
+	return lines
+}
+
+// conflictPaths lists the conflicted paths, sorted.
+func (m *treeMerge) conflictPaths() []string {
+	paths := make([]string, 0, len(m.conflicts))
+	for p := range m.conflicts {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func sideEntry(side diffSide, p string) *diffEntry {
+	entry, ok := side[p]
+	if !ok {
+		return nil
+	}
+	return &entry
+}
+
+func sameEntry(a, b *diffEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.hash == b.hash && a.mode == b.mode
+}
+
+// mergeContent merges a file both sides changed, the way git's ort
+// strategy does: modes first, then the lines of regular files. It
+// returns the merged file, whether it merged cleanly and whether the
+// lines were merged. Binary files and symlinks that differ conflict,
+// keeping ours, or the base in a virtual merge.
+func mergeContent(store ObjectStore, p string, o, a, b *diffEntry, opts diff.MergeOptions, virtual bool) (diffEntry, bool, bool, error) {
+	clean := true
+	merged := diffEntry{mode: a.mode}
+	baseHash := ""
+	if o != nil {
+		baseHash = o.hash
+	}
+	switch {
+	case a.mode == b.mode || (o != nil && a.mode == o.mode):
+		merged.mode = b.mode
+	default:
+		clean = o != nil && b.mode == o.mode
+	}
+
+	switch {
+	case a.hash == b.hash || a.hash == baseHash:
+		merged.hash = b.hash
+		return merged, clean, false, nil
+	case b.hash == baseHash:
+		merged.hash = a.hash
+		return merged, clean, false, nil
+	case a.mode == 0120000 || b.mode == 0120000:
+		merged.hash = a.hash
+		if virtual && o != nil {
+			merged.hash = o.hash
+		}
+		return merged, false, false, nil
+	}
+
+	var contents [3][]byte
+	binary := false
+	for i, entry := range []*diffEntry{o, a, b} {
+		data, err := readDiffContent(store, entry)
+		if err != nil {
+			return merged, false, false, err
+		}
+		contents[i] = data
+		binary = binary || diff.IsBinary(data)
+	}
+	if binary {
+		if virtual {
+			hash, err := store.Write(Blob, contents[0])
+			merged.hash = hash
+			return merged, clean, true, err
+		}
+		fmt.Fprintf(os.Stderr, "warning: Cannot merge binary files: %s (%s vs. %s)\n", p, opts.Ours, opts.Theirs)
+		merged.hash = a.hash
+		return merged, false, true, nil
+	}
+
+	lines, conflicts := diff.Merge(diff.SplitLines(contents[0]), diff.SplitLines(contents[1]), diff.SplitLines(contents[2]), opts)
+	hash, err := store.Write(Blob, []byte(strings.Join(lines, "")))
+	merged.hash = hash
+	return merged, clean && conflicts == 0, true, err
+}
+
+// mergeFiles merges ours and theirs path by path against base. A path
+// only one side changed takes that side; a file both changed has its
+// lines merged; a file one side changed and the other deleted is kept,
+// conflicted. A file where the result has a directory moves aside to
+// "path~side". In a virtual merge, of merge bases, conflicts keep the
+// base version instead.
+func mergeFiles(store ObjectStore, base, ours, theirs diffSide, opts diff.MergeOptions, virtual bool) (*treeMerge, error) {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, side := range []diffSide{base, ours, theirs} {
+		for p := range side {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	results := make(map[string]*mergedPath, len(paths))
+	for _, p := range paths {
+		o, a, b := sideEntry(base, p), sideEntry(ours, p), sideEntry(theirs, p)
+		m := &mergedPath{stages: [3]*diffEntry{o, a, b}}
+		switch {
+		case sameEntry(a, b):
+			m.result = a
+		case sameEntry(o, a):
+			m.result = b
+		case sameEntry(o, b):
+			m.result = a
+		case a != nil && b != nil:
+			entry, clean, automerged, err := mergeContent(store, p, o, a, b, opts, virtual)
+			if err != nil {
+				return nil, err
+			}
+			m.result, m.automerged = &entry, automerged
+			if !clean {
+				m.conflict, m.reason = true, "content"
+				if o == nil {
+					m.reason = "add/add"
+				}
+			}
+		default:
+			m.conflict, m.reason = true, "modify/delete"
+			m.result = a
+			if a == nil {
+				m.result = b
+			}
+			if virtual {
+				m.result = o
+			}
+		}
+		results[p] = m
+	}
+
+	tm := &treeMerge{
+		files:     make(diffSide),
+		conflicts: make(map[string][3]*diffEntry),
+		messages:  make(map[string][]string),
+	}
+	dirs := make(map[string]bool)
+	for p, m := range results {
+		if m.result == nil {
+			continue
+		}
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	for _, p := range paths {
+		m := results[p]
+		name := p
+		if m.result != nil && dirs[p] {
+			side := opts.Ours
+			if m.stages[1] == nil {
+				side = opts.Theirs
+			}
+			name = p + "~" + strings.ReplaceAll(side, "/", "_")
+			for i := 0; seen[name]; i++ {
+				name = fmt.Sprintf("%s~%s_%d", p, strings.ReplaceAll(side, "/", "_"), i)
+			}
+			m.conflict = true
+			tm.messages[name] = append(tm.messages[name], fmt.Sprintf(
+				"CONFLICT (file/directory): directory in the way of %s from %s; moving it to %s instead.", p, side, name))
+		}
+
+		if m.result != nil {
+			tm.files[name] = *m.result
+		}
+		if m.conflict {
+			tm.conflicts[name] = m.stages
+		}
+		if m.automerged {
+			tm.messages[name] = append(tm.messages[name], "Auto-merging "+name)
+		}
+		switch m.reason {
+		case "content", "add/add":
+			tm.messages[name] = append(tm.messages[name], fmt.Sprintf("CONFLICT (%s): Merge conflict in %s", m.reason, name))
+		case "modify/delete":
+			modified, deleted := opts.Ours, opts.Theirs
+			if m.stages[1] == nil {
+				modified, deleted = opts.Theirs, opts.Ours
+			}
+			tm.messages[name] = append(tm.messages[name], fmt.Sprintf(
+				"CONFLICT (modify/delete): %s deleted in %s and modified in %s.  Version %s of %s left in tree.",
+				name, deleted, modified, modified, name))
+		}
+	}
+	return tm, nil
+}
+
+// merger merges commits the way git's ort strategy does, merging their
+// merge bases into a virtual one first when there are several.
+type merger struct {
+	store ObjectStore
+	opts  diff.MergeOptions // labels ours and theirs at the top level
+}
+
+func (m *merger) side(hash string) (mergeSide, error) {
+	files, err := treeSide(m.store, hash)
+	return mergeSide{commits: []string{hash}, files: files}, err
+}
+
+func (m *merger) merge(ours, theirs mergeSide, depth int) (*treeMerge, error) {
+	bases, err := mergeBases(m.store, ours.commits, theirs.commits)
+	if err != nil {
+		return nil, err
+	}
+	opts := m.opts
+	if depth > 0 {
+		opts.Ours, opts.Theirs = "Temporary merge branch 1", "Temporary merge branch 2"
+		opts.MarkerSize = diff.MARKER_SIZE + 2*depth
+	}
+
+	base := mergeSide{files: make(diffSide)}
+	opts.Base = "empty tree"
+	if len(bases) > 0 {
+		// merge the merge bases, oldest first
+		slices.Reverse(bases)
+		if base, err = m.side(bases[0]); err != nil {
+			return nil, err
+		}
+		opts.Base = shortHash(bases[0])
+		for _, hash := range bases[1:] {
+			next, err := m.side(hash)
+			if err != nil {
+				return nil, err
+			}
+			merged, err := m.merge(base, next, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			base = mergeSide{commits: append(slices.Clip(base.commits), hash), files: merged.files}
+			opts.Base = "merged common ancestors"
+		}
+	}
+	return mergeFiles(m.store, base.files, ours.files, theirs.files, opts, depth > 0)
+}
+
+// mergeCommits merges the trees of the commits ours and theirs.
+func mergeCommits(store ObjectStore, ours, theirs string, opts diff.MergeOptions) (*treeMerge, error) {
+	m := &merger{store: store, opts: opts}
+	a, err := m.side(ours)
+	if err != nil {
+		return nil, err
+	}
+	b, err := m.side(theirs)
+	if err != nil {
+		return nil, err
+	}
+	return m.merge(a, b, 0)
+}
+
+// sideTreePaths turns a list of files into the TreePaths checkouts
+// work with.
+func sideTreePaths(side diffSide) TreePaths {
+	tp := NewTreePaths()
+	for p, entry := range side {
+		tp.TreePaths[p] = entry.hash
+		tp.FileModes[p] = entry.mode
+	}
+	return tp
+}
+
+// writeMergeStat writes the diffstat of what a merge brought in,
+// followed by the files it created, deleted, renamed or changed the
+// mode of.
+func writeMergeStat(w io.Writer, store ObjectStore, from, to diffSide) error {
+	pairs := diffPairs(from, to)
+	if len(pairs) == 0 {
+		return nil
+	}
+	stats := make([]fileStat, 0, len(pairs))
+	for _, pair := range pairs {
+		stat, err := statFilePair(store, pair, diffOptions{})
+		if err != nil {
+			return err
+		}
+		stats = append(stats, stat)
+	}
+	writeStat(w, stats, statWidth())
+
+	for _, pair := range pairs {
+		switch {
+		case pair.old == nil:
+			fmt.Fprintf(w, " create mode %06o %s\n", pair.new.mode, quotePath(pair.newPath))
+		case pair.new == nil:
+			fmt.Fprintf(w, " delete mode %06o %s\n", pair.old.mode, quotePath(pair.oldPath))
+		case pair.oldPath != pair.newPath:
+			fmt.Fprintf(w, " rename %s (100%%)\n", renameName(pair.oldPath, pair.newPath))
+		case pair.old.mode != pair.new.mode:
+			fmt.Fprintf(w, " mode change %06o => %06o %s\n", pair.old.mode, pair.new.mode, quotePath(pair.newPath))
+		}
+	}
+	return nil
+}
+
+// mergeMessage is the default message for merging rev into the
+// current branch: "Merge branch 'topic'", with " into <branch>"
+// unless the branch is main or master.
+func mergeMessage(gitRoot, rev string) string {
+	kind := "commit"
+	for _, ref := range []struct{ prefix, kind string }{
+		{TAG_PREFIX, "tag"},
+		{BRANCH_PREFIX, "branch"},
+		{"refs/remotes/", "remote-tracking branch"},
+	} {
+		if _, err := readRef(gitRoot, ref.prefix+rev); err == nil {
+			kind = ref.kind
+			break
+		}
+	}
+	msg := fmt.Sprintf("Merge %s '%s'", kind, rev)
+
+	branch, onBranch, err := CurrentBranch(gitRoot)
+	switch {
+	case err != nil || !onBranch:
+		msg += " into HEAD"
+	case branch != "main" && branch != "master":
+		msg += " into " + branch
+	}
+	return msg
+}
+
+// readMergeMessage returns MERGE_MSG without its comment lines.
+func readMergeMessage(gitRoot string) (string, error) {
+	data, err := os.ReadFile(refPath(gitRoot, MERGE_MSG))
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// mergeInProgress reports whether MERGE_HEAD exists.
+func mergeInProgress(gitRoot string) bool {
+	_, err := os.Stat(refPath(gitRoot, MERGE_HEAD))
+	return err == nil
+}
+
+// clearMergeState forgets the merge in progress, once it is committed
+// or aborted.
+func clearMergeState(gitRoot string) error {
+	for _, name := range []string{MERGE_HEAD, MERGE_MSG, MERGE_MODE} {
+		if err := os.Remove(refPath(gitRoot, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// fastForward moves the working tree, the index and the current branch
+// from head to theirs, which contains it, keeping head in ORIG_HEAD.
+func fastForward(gitRoot string, store ObjectStore, staged *Staged, head, theirs string) error {
+	fmt.Printf("Updating %s..%s\n", shortHash(head), shortHash(theirs))
+	current, err := ParseCommit(store, head)
+	if err != nil {
+		return err
+	}
+	next, err := ParseCommit(store, theirs)
+	if err != nil {
+		return err
+	}
+	blockers, err := checkoutConflicts(gitRoot, staged, current, next)
+	if err != nil {
+		return err
+	}
+	if err := blockers.err(ERROR_MERGE_LOCAL_CHANGES, "merge", "merge"); err != nil {
+		return err
+	}
+	if err := writeRef(gitRoot, ORIG_HEAD, head); err != nil {
+		return err
+	}
+
+	fmt.Println("Fast-forward")
+	if err := updateWorktree(gitRoot, store, staged, current, next); err != nil {
+		return err
+	}
+	if err := staged.writeIndex(gitRoot + ROOTDIR); err != nil {
+		return err
+	}
+	if err := updateHEAD(gitRoot, theirs); err != nil {
+		return err
+	}
+	from, err := treeSide(store, head)
+	if err != nil {
+		return err
+	}
+	to, err := treeSide(store, theirs)
+	if err != nil {
+		return err
+	}
+	return writeMergeStat(os.Stdout, store, from, to)
+}
+
+// threeWayMerge merges theirs into head in the working tree and the
+// index. A clean merge is committed with both as parents; conflicts
+// are left in the working tree, with their stages in the index, and
+// MERGE_HEAD and MERGE_MSG wait for the commit that resolves them.
+// ORIG_HEAD keeps head once the local changes are known not to be in
+// the way. It reports whether the merge was clean.
+func threeWayMerge(gitRoot string, store ObjectStore, cfg *Config, staged *Staged, head, theirs, rev, message string, noFF bool) (bool, error) {
+	current, err := ParseCommit(store, head)
+	if err != nil {
+		return false, err
+	}
+	indexMap, _ := splitIndex(staged.IndexLines)
+	if changes := compareHeadToIndex(current, indexMap); len(changes) > 0 {
+		paths := make([]string, 0, len(changes))
+		for p := range changes {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		return false, localChangesError(ERROR_MERGE_LOCAL_CHANGES, paths, "merge")
+	}
+
+	opts := diff.MergeOptions{
+		// like ort: histogram diffs, no indent heuristic
+		Options: diff.Options{Algorithm: diff.HISTOGRAM},
+		Style:   cfg.Get("merge.conflictStyle"),
+		Ours:    "HEAD",
+		Theirs:  rev,
+	}
+	result, err := mergeCommits(store, head, theirs, opts)
+	if err != nil {
+		return false, err
+	}
+	next := sideTreePaths(result.files)
+	blockers, err := checkoutConflicts(gitRoot, staged, current, next)
+	if err != nil {
+		return false, err
+	}
+	if err := blockers.err(ERROR_MERGE_LOCAL_CHANGES, "merge", "merge"); err != nil {
+		return false, err
+	}
+	// from here on the merge changes HEAD, or leaves one to abort
+	if err := writeRef(gitRoot, ORIG_HEAD, head); err != nil {
+		return false, err
+	}
+
+	for _, line := range result.report() {
+		fmt.Println(line)
+	}
+	if err := updateWorktree(gitRoot, store, staged, current, next); err != nil {
+		return false, err
+	}
+
+	if len(result.conflicts) > 0 {
+		lines := staged.IndexLines[:0]
+		for _, line := range staged.IndexLines {
+			if _, ok := result.conflicts[line.Fullpath]; !ok {
+				lines = append(lines, line)
+			}
+		}
+		for _, p := range result.conflictPaths() {
+			for i, entry := range result.conflicts[p] {
+				if entry != nil {
+					lines = append(lines, IndexLine{Fullpath: p, BlobHash: entry.hash, FileMode: entry.mode, Stage: i + 1})
+				}
+			}
+		}
+		staged.IndexLines = lines
+		staged.rebuildIndexMap()
+		if err := staged.writeIndex(gitRoot + ROOTDIR); err != nil {
+			return false, err
+		}
+
+		var msg strings.Builder
+		msg.WriteString(message + "\n\n# Conflicts:\n")
+		for _, p := range result.conflictPaths() {
+			fmt.Fprintf(&msg, "#\t%s\n", p)
+		}
+		mode := ""
+		if noFF {
+			mode = "no-ff"
+		}
+		for _, file := range []struct{ name, content string }{
+			{MERGE_HEAD, theirs + "\n"},
+			{MERGE_MODE, mode},
+			{MERGE_MSG, msg.String()},
+		} {
+			if err := os.WriteFile(refPath(gitRoot, file.name), []byte(file.content), 0644); err != nil {
+				return false, err
+			}
+		}
+		fmt.Println("Automatic merge failed; fix conflicts and then commit the result.")
+		return false, nil
+	}
+
+	if err := staged.writeIndex(gitRoot + ROOTDIR); err != nil {
+		return false, err
+	}
+	treeHash, err := buildTreesFromIndex(store, staged.IndexLines)
+	if err != nil {
+		return false, err
+	}
+	author, committer, err := commitIdentities(cfg, "", "")
+	if err != nil {
+		return false, err
+	}
+	commitHash, err := writeCommit(store, &Commit{
+		tree:     treeHash,
+		parents:  []string{head, theirs},
+		author:   author,
+		commiter: committer,
+		message:  message,
+	})
+	if err != nil {
+		return false, err
+	}
+	if err := updateHEAD(gitRoot, commitHash); err != nil {
+		return false, err
+	}
+	fmt.Println("Merge made by the 'ort' strategy.")
+	from, err := treeSide(store, head)
+	if err != nil {
+		return false, err
+	}
+	return true, writeMergeStat(os.Stdout, store, from, result.files)
+}
+
+// abortMerge puts HEAD, the index and the files the merge changed back
+// as they were at ORIG_HEAD, keeping other local changes, and forgets
+// the merge.
+func abortMerge(gitRoot string, store ObjectStore) error {
+	if !mergeInProgress(gitRoot) {
+		return ERROR_NO_MERGE
+	}
+	orig, err := readRef(gitRoot, ORIG_HEAD)
+	if err != nil {
+		return fmt.Errorf("cannot abort the merge: %w", err)
+	}
+	target, err := ParseCommit(store, orig)
+	if err != nil {
+		return err
+	}
+
+	staged := NewStaged()
+	staged.baseRoot = gitRoot
+	if err := staged.parseIndexFile(); err != nil {
+		return err
+	}
+	// the index as the merge left it; conflicted paths match nothing
+	// so they are always rewritten
+	current := NewTreePaths()
+	for _, line := range staged.IndexLines {
+		if line.Stage == 0 {
+			current.TreePaths[line.Fullpath] = line.BlobHash
+			current.FileModes[line.Fullpath] = line.FileMode
+		} else {
+			current.TreePaths[line.Fullpath] = ""
+		}
+	}
+	if err := updateWorktree(gitRoot, store, staged, current, target); err != nil {
+		return err
+	}
+	if err := staged.writeIndex(gitRoot + ROOTDIR); err != nil {
+		return err
+	}
+	if err := updateHEAD(gitRoot, orig); err != nil {
+		return err
+	}
+	return clearMergeState(gitRoot)
+}
+
+// commitMerge commits the resolved merge with the message waiting in
+// MERGE_MSG, as git merge --continue does.
+func commitMerge(gitRoot string, cfg *Config) error {
+	if !mergeInProgress(gitRoot) {
+		return ERROR_NO_MERGE
+	}
+	message, err := readMergeMessage(gitRoot)
+	if err != nil {
+		return err
+	}
+	author, committer, err := commitIdentities(cfg, "", "")
+	if err != nil {
+		return err
+	}
+	return compareAndFindStagedFiles(gitRoot, &Commit{author: author, commiter: committer, message: message})
+}
+
+func HandleMergeCommand() error {
+	var rev, message string
+	abort, resume, noFF, ffOnly := false, false, false, false
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--abort":
+			abort = true
+		case arg == "--continue":
+			resume = true
+		case arg == "--no-ff":
+			noFF, ffOnly = true, false
+		case arg == "--ff-only":
+			ffOnly, noFF = true, false
+		case arg == "--ff":
+			noFF, ffOnly = false, false
+		case arg == "-m" || isOption(arg, "--message"):
+			value, err := optionValue(args, &i)
+			if err != nil {
+				return err
+			}
+			message = value
+		case strings.HasPrefix(arg, "-m"):
+			message = arg[2:]
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("unknown option: %s", arg)
+		case rev == "":
+			rev = arg
+		default:
+			return fmt.Errorf("merging more than one commit at once is not supported")
+		}
+	}
+
+	path, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	gitRoot, ok, err := CheckGitFolderExists(path)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("outside of Git repository")
+	}
+	store := NewObjectStore(gitRoot)
+	cfg, err := LoadConfig(gitRoot)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case abort:
+		return abortMerge(gitRoot, store)
+	case resume:
+		return commitMerge(gitRoot, cfg)
+	case rev == "":
+		return fmt.Errorf("no commit given to merge")
+	case mergeInProgress(gitRoot):
+		return ERROR_MERGE_IN_PROGRESS
+	}
+
+	staged := NewStaged()
+	staged.baseRoot = gitRoot
+	if err := staged.parseIndexFile(); err != nil {
+		return err
+	}
+	if _, unmerged := splitIndex(staged.IndexLines); len(unmerged) > 0 {
+		return ERROR_UNMERGED_FILES
+	}
+	theirs, err := resolveCommitish(gitRoot, store, rev)
+	if err != nil {
+		return fmt.Errorf("%s - not something we can merge", rev)
+	}
+	head, err := resolveHEAD(gitRoot)
+	if errors.Is(err, io.EOF) {
+		// nothing to merge into: the branch starts at theirs
+		ref, _, err := readHEAD(gitRoot)
+		if err != nil {
+			return err
+		}
+		return checkoutCommit(gitRoot, store, checkoutTarget{commitHash: theirs, branchRef: ref, writeBranch: true})
+	}
+	if err != nil {
+		return err
+	}
+
+	bases, err := mergeBases(store, []string{head}, []string{theirs})
+	if err != nil {
+		return err
+	}
+	if slices.Contains(bases, theirs) {
+		fmt.Println("Already up to date.")
+		return nil
+	}
+	if len(bases) == 1 && bases[0] == head && !noFF {
+		return fastForward(gitRoot, store, staged, head, theirs)
+	}
+	if ffOnly {
+		return ERROR_NOT_FAST_FORWARD
+	}
+
+	if message == "" {
+		message = mergeMessage(gitRoot, rev)
+	}
+	clean, err := threeWayMerge(gitRoot, store, cfg, staged, head, theirs, rev, message, noFF)
+	if err != nil {
+		return err
+	}
+	if !clean {
+		return ERROR_SILENT_EXIT
+	}
+	return nil
+}
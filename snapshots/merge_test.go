@@ -0,0 +1,257 @@
+package snapshots
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bibektamang7/own-git/diff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeBases(t *testing.T) {
+	store := NewMemoryStore()
+	hashes := writeHistory(t, store)
+	// a criss-cross: x and y both merge a2 and b2
+	writeTestCommit(t, store, hashes, "x", 7, "a2", "b2")
+	writeTestCommit(t, store, hashes, "y", 8, "b2", "a2")
+
+	for _, tc := range []struct {
+		a, b string
+		want []string
+	}{
+		{"a2", "b2", []string{"root"}},
+		{"a1", "a2", []string{"a1"}},
+		{"m", "b1", []string{"b1"}},
+		{"a2", "a2", []string{"a2"}},
+		{"x", "y", []string{"a2", "b2"}},
+		{"x", "m", []string{"a2", "b2"}},
+	} {
+		bases, err := mergeBases(store, []string{hashes[tc.a]}, []string{hashes[tc.b]})
+		assert.NoError(t, err)
+		var want []string
+		for _, name := range tc.want {
+			want = append(want, hashes[name])
+		}
+		assert.Equal(t, want, bases, tc.a+" "+tc.b)
+	}
+}
+
+func TestMergeFiles(t *testing.T) {
+	store := NewMemoryStore()
+	blob := func(content string) diffEntry {
+		hash, err := store.Write(Blob, []byte(content))
+		assert.NoError(t, err)
+		return diffEntry{mode: 0100644, hash: hash}
+	}
+	base := diffSide{
+		"clean":   blob("a\nb\nc\nd\ne\n"),
+		"content": blob("a\nb\nc\n"),
+		"gone":    blob("old\n"),
+		"md":      blob("x\n"),
+		"dir":     blob("file\n"),
+	}
+	ours := diffSide{
+		"clean":   blob("A\nb\nc\nd\ne\n"),
+		"content": blob("a\nours\nc\n"),
+		"md":      blob("x2\n"),
+		"dir":     blob("file2\n"),
+		"both":    blob("one\n"),
+	}
+	theirs := diffSide{
+		"clean":   blob("a\nb\nc\nd\nE\n"),
+		"content": blob("a\ntheirs\nc\n"),
+		"gone":    blob("old\n"),
+		"dir/sub": blob("sub\n"),
+		"both":    blob("two\n"),
+	}
+
+	opts := diff.MergeOptions{Ours: "HEAD", Theirs: "topic"}
+	result, err := mergeFiles(store, base, ours, theirs, opts, false)
+	assert.NoError(t, err)
+
+	read := func(p string) string {
+		content, err := readDiffContent(store, sideEntry(result.files, p))
+		assert.NoError(t, err)
+		return string(content)
+	}
+	assert.Equal(t, "A\nb\nc\nd\nE\n", read("clean"))
+	assert.Equal(t, "a\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> topic\nc\n", read("content"))
+	assert.Equal(t, "<<<<<<< HEAD\none\n=======\ntwo\n>>>>>>> topic\n", read("both"))
+	assert.Equal(t, "x2\n", read("md"))
+	assert.Equal(t, "sub\n", read("dir/sub"))
+	assert.NotContains(t, result.files, "gone")
+	assert.NotContains(t, result.files, "dir")
+	assert.Equal(t, "file2\n", read("dir~HEAD"))
+
+	assert.Equal(t, []string{"both", "content", "dir~HEAD", "md"}, result.conflictPaths())
+	md := result.conflicts["md"]
+	assert.Equal(t, base["md"].hash, md[0].hash)
+	assert.Equal(t, ours["md"].hash, md[1].hash)
+	assert.Nil(t, md[2])
+
+	assert.Equal(t, []string{
+		"Auto-merging both",
+		"CONFLICT (add/add): Merge conflict in both",
+		"Auto-merging clean",
+		"Auto-merging content",
+		"CONFLICT (content): Merge conflict in content",
+		"CONFLICT (file/directory): directory in the way of dir from HEAD; moving it to dir~HEAD instead.",
+		"CONFLICT (modify/delete): dir~HEAD deleted in topic and modified in HEAD.  Version HEAD of dir~HEAD left in tree.",
+		"CONFLICT (modify/delete): md deleted in topic and modified in HEAD.  Version HEAD of md left in tree.",
+	}, result.report())
+
+	// merging merge bases keeps the base of what conflicts
+	result, err = mergeFiles(store, base, ours, theirs, opts, true)
+	assert.NoError(t, err)
+	assert.Equal(t, base["md"], result.files["md"])
+}
+
+// newMergeRepo checks out main at ours. ours and theirs both change the
+// middle line of f; theirs also changes g and adds h. ahead builds on
+// ours.
+func newMergeRepo(t *testing.T) (string, ObjectStore, *Config, map[string]string) {
+	root := newStatusRepo(t)
+	config := "[user]\n\tname = A\n\temail = a@example.com\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(root, ROOTDIR, "config"), []byte(config), 0644))
+	cfg, err := LoadConfig(root)
+	assert.NoError(t, err)
+
+	store := NewObjectStore(root)
+	hashes := make(map[string]string)
+	writeFilesCommit(t, store, hashes, "base", 1, map[string]string{"f": "a\nb\nc\n", "g": "g\n"})
+	writeFilesCommit(t, store, hashes, "ours", 2, map[string]string{"f": "a\nours\nc\n", "g": "g\n"}, "base")
+	writeFilesCommit(t, store, hashes, "theirs", 3, map[string]string{"f": "a\ntheirs\nc\n", "g": "g2\n", "h": "new\n"}, "base")
+	writeFilesCommit(t, store, hashes, "ahead", 4, map[string]string{"f": "a\nours\nc\nd\n", "g": "g\n"}, "ours")
+	assert.NoError(t, checkoutCommit(root, store, checkoutTarget{commitHash: hashes["ours"], branchRef: BRANCH_PREFIX + "main"}))
+	assert.NoError(t, writeRef(root, BRANCH_PREFIX+"main", hashes["ours"]))
+	return root, store, cfg, hashes
+}
+
+func loadStaged(t *testing.T, root string) *Staged {
+	staged := NewStaged()
+	staged.baseRoot = root
+	assert.NoError(t, staged.parseIndexFile())
+	return staged
+}
+
+func readWorktree(t *testing.T, root, rel string) string {
+	content, err := os.ReadFile(filepath.Join(root, rel))
+	assert.NoError(t, err)
+	return string(content)
+}
+
+// conflictedMerge merges theirs into ours, which conflicts in f.
+func conflictedMerge(t *testing.T, root string, store ObjectStore, cfg *Config, hashes map[string]string) {
+	clean, err := threeWayMerge(root, store, cfg, loadStaged(t, root), hashes["ours"], hashes["theirs"], "topic", "Merge branch 'topic'", false)
+	assert.NoError(t, err)
+	assert.False(t, clean)
+}
+
+func TestThreeWayMergeConflictAndCommit(t *testing.T) {
+	root, store, cfg, hashes := newMergeRepo(t)
+	conflictedMerge(t, root, store, cfg, hashes)
+
+	blob := func(content string) string { return hashObject(Blob, []byte(content)) }
+	lines, _, err := readIndex(root)
+	assert.NoError(t, err)
+	var got []IndexLine
+	for _, line := range lines {
+		got = append(got, IndexLine{Fullpath: line.Fullpath, BlobHash: line.BlobHash, Stage: line.Stage})
+	}
+	assert.Equal(t, []IndexLine{
+		{Fullpath: "f", BlobHash: blob("a\nb\nc\n"), Stage: 1},
+		{Fullpath: "f", BlobHash: blob("a\nours\nc\n"), Stage: 2},
+		{Fullpath: "f", BlobHash: blob("a\ntheirs\nc\n"), Stage: 3},
+		{Fullpath: "g", BlobHash: blob("g2\n")},
+		{Fullpath: "h", BlobHash: blob("new\n")},
+	}, got)
+	assert.Equal(t, "a\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> topic\nc\n", readWorktree(t, root, "f"))
+	assert.Equal(t, "g2\n", readWorktree(t, root, "g"))
+
+	assert.True(t, mergeInProgress(root))
+	mergeHead, err := readRef(root, MERGE_HEAD)
+	assert.NoError(t, err)
+	assert.Equal(t, hashes["theirs"], mergeHead)
+	orig, err := readRef(root, ORIG_HEAD)
+	assert.NoError(t, err)
+	assert.Equal(t, hashes["ours"], orig)
+	message, err := readMergeMessage(root)
+	assert.NoError(t, err)
+	assert.Equal(t, "Merge branch 'topic'", message)
+	assert.Equal(t, "Merge branch 'topic'\n\n# Conflicts:\n#\tf\n", readWorktree(t, root, ROOTDIR+MERGE_MSG))
+
+	// resolving f and committing makes a merge commit
+	assert.Error(t, compareAndFindStagedFiles(root, &Commit{message: message}))
+	resolved := []byte("a\nboth\nc\n")
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "f"), resolved, 0644))
+	hash, err := store.Write(Blob, resolved)
+	assert.NoError(t, err)
+	info, err := os.Lstat(filepath.Join(root, "f"))
+	assert.NoError(t, err)
+	staged := loadStaged(t, root)
+	staged.setIndexLine(newIndexLineFromInfo("f", hash, info))
+	assert.NoError(t, staged.writeIndex(root+ROOTDIR))
+
+	sig := Signature{Name: "A", Email: "a@example.com", When: time.Unix(5, 0).UTC()}
+	assert.NoError(t, compareAndFindStagedFiles(root, &Commit{author: sig, commiter: sig, message: message}))
+	head, err := resolveHEAD(root)
+	assert.NoError(t, err)
+	commit, err := readCommit(store, head)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{hashes["ours"], hashes["theirs"]}, commit.parents)
+	assert.False(t, mergeInProgress(root))
+	_, err = os.Stat(filepath.Join(root, ROOTDIR, MERGE_MSG))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAbortMerge(t *testing.T) {
+	root, store, cfg, hashes := newMergeRepo(t)
+	conflictedMerge(t, root, store, cfg, hashes)
+
+	assert.NoError(t, abortMerge(root, store))
+	head, err := resolveHEAD(root)
+	assert.NoError(t, err)
+	assert.Equal(t, hashes["ours"], head)
+	assert.Equal(t, "a\nours\nc\n", readWorktree(t, root, "f"))
+	assert.Equal(t, "g\n", readWorktree(t, root, "g"))
+	_, err = os.Stat(filepath.Join(root, "h"))
+	assert.True(t, os.IsNotExist(err))
+
+	lines, _, err := readIndex(root)
+	assert.NoError(t, err)
+	ours, err := ParseCommit(store, hashes["ours"])
+	assert.NoError(t, err)
+	assert.Len(t, lines, len(ours.TreePaths))
+	for _, line := range lines {
+		assert.Equal(t, 0, line.Stage)
+		assert.Equal(t, ours.TreePaths[line.Fullpath], line.BlobHash, line.Fullpath)
+	}
+	assert.False(t, mergeInProgress(root))
+	assert.ErrorIs(t, abortMerge(root, store), ERROR_NO_MERGE)
+}
+
+func TestFastForward(t *testing.T) {
+	root, store, _, hashes := newMergeRepo(t)
+
+	// a local change in the way stops the merge before ORIG_HEAD is written
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "f"), []byte("local\n"), 0644))
+	err := fastForward(root, store, loadStaged(t, root), hashes["ours"], hashes["ahead"])
+	assert.ErrorContains(t, err, ERROR_MERGE_LOCAL_CHANGES.Error())
+	_, err = readRef(root, ORIG_HEAD)
+	assert.ErrorIs(t, err, ERROR_REF_NOT_FOUND)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "f"), []byte("a\nours\nc\n"), 0644))
+	assert.NoError(t, fastForward(root, store, loadStaged(t, root), hashes["ours"], hashes["ahead"]))
+	head, err := readRef(root, BRANCH_PREFIX+"main")
+	assert.NoError(t, err)
+	assert.Equal(t, hashes["ahead"], head)
+	orig, err := readRef(root, ORIG_HEAD)
+	assert.NoError(t, err)
+	assert.Equal(t, hashes["ours"], orig)
+	assert.Equal(t, "a\nours\nc\nd\n", readWorktree(t, root, "f"))
+	lines, _, err := readIndex(root)
+	assert.NoError(t, err)
+	assert.Equal(t, hashObject(Blob, []byte("a\nours\nc\nd\n")), lines[0].BlobHash)
+}
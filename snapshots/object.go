@@ -0,0 +1,111 @@
+package snapshots
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ERROR_MALFORMED_OBJECT = fmt.Errorf("malformed object header")
+
+// objectReader streams the payload of an inflated loose object
+// and closes both the zlib stream and the underlying file.
+type objectReader struct {
+	io.Reader
+	zr   io.ReadCloser
+	file *os.File
+}
+
+func (o *objectReader) Close() error {
+	o.zr.Close()
+	return o.file.Close()
+}
+
+// encodeObject prefixes content with the "<type> <len>\0" header,
+// which is what git hashes and stores for every object.
+func encodeObject(objType ContentType, content []byte) []byte {
+	header := fmt.Sprintf("%s %d\x00", objType, len(content))
+	buf := make([]byte, 0, len(header)+len(content))
+	buf = append(buf, header...)
+	return append(buf, content...)
+}
+
+func hashObject(objType ContentType, content []byte) string {
+	return hashBytes(encodeObject(objType, content))
+}
+
+// parseObjectHeader reads "<type> <len>\0" from an inflated object.
+func parseObjectHeader(r *bufio.Reader) (ContentType, int64, error) {
+	header, err := r.ReadString(0)
+	if err != nil {
+		return "", 0, ERROR_MALFORMED_OBJECT
+	}
+	parts := strings.SplitN(strings.TrimSuffix(header, "\x00"), " ", 2)
+	if len(parts) != 2 {
+		return "", 0, ERROR_MALFORMED_OBJECT
+	}
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, ERROR_MALFORMED_OBJECT
+	}
+	return ContentType(parts[0]), size, nil
+}
+
+// openObject inflates the loose object at path and returns its type,
+// payload size and a reader positioned right after the header.
+func openObject(path string) (ContentType, int64, io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		f.Close()
+		return "", 0, nil, err
+	}
+	reader := bufio.NewReader(zr)
+	objType, size, err := parseObjectHeader(reader)
+	if err != nil {
+		zr.Close()
+		f.Close()
+		return "", 0, nil, err
+	}
+	return objType, size, &objectReader{
+		Reader: io.LimitReader(reader, size),
+		zr:     zr,
+		file:   f,
+	}, nil
+}
+
+func readObject(path string) (ContentType, []byte, error) {
+	objType, size, r, err := openObject(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+
+	content := make([]byte, size)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return "", nil, err
+	}
+	return objType, content, nil
+}
+
+// compressObject deflates the full object (header included)
+// the same way git writes loose objects.
+func compressObject(objType ContentType, content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(encodeObject(objType, content)); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
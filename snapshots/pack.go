@@ -0,0 +1,540 @@
+package snapshots
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// pack object types as stored in the 3-bit type field of each entry
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+// packHeaderSize is the length of "PACK", the version and the object count.
+const packHeaderSize = 12
+
+// maxDeltaDepth bounds delta chains, the longest git writes is 4095.
+// A longer chain can only be a cycle in a corrupt pack.
+const maxDeltaDepth = 4095
+
+var (
+	ERROR_MALFORMED_PACK  = fmt.Errorf("malformed pack file")
+	ERROR_MALFORMED_IDX   = fmt.Errorf("malformed pack index")
+	ERROR_MALFORMED_DELTA = fmt.Errorf("malformed delta")
+	ERROR_READ_ONLY_STORE = fmt.Errorf("object store is read only")
+)
+
+var packTypeNames = map[int]ContentType{
+	packCommit: CommitType,
+	packTree:   Tree,
+	packBlob:   Blob,
+	packTag:    TagType,
+}
+
+// packIndex is the parsed content of a version 2 .idx file.
+type packIndex struct {
+	fanout       [256]uint32
+	hashes       []byte // 20 bytes per object, sorted
+	offsets      []uint64
+	packChecksum []byte // trailer of the pack the index describes
+}
+
+func (pi *packIndex) count() int {
+	return len(pi.offsets)
+}
+
+func (pi *packIndex) hashAt(i int) string {
+	return hex.EncodeToString(pi.hashes[i*20 : i*20+20])
+}
+
+// lookup binary searches the fanout bucket of hash.
+func (pi *packIndex) lookup(hash string) (uint64, bool) {
+	raw, err := hex.DecodeString(hash)
+	if err != nil || len(raw) != 20 {
+		return 0, false
+	}
+	lo := 0
+	if raw[0] > 0 {
+		lo = int(pi.fanout[raw[0]-1])
+	}
+	hi := int(pi.fanout[raw[0]])
+	i := lo + sort.Search(hi-lo, func(k int) bool {
+		return bytes.Compare(pi.hashes[(lo+k)*20:(lo+k)*20+20], raw) >= 0
+	})
+	if i < hi && bytes.Equal(pi.hashes[i*20:i*20+20], raw) {
+		return pi.offsets[i], true
+	}
+	return 0, false
+}
+
+func readPackIndex(r io.Reader) (*packIndex, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], []byte{0xff, 't', 'O', 'c'}) {
+		return nil, ERROR_MALFORMED_IDX
+	}
+	if binary.BigEndian.Uint32(data[4:8]) != 2 {
+		return nil, fmt.Errorf("unsupported pack index version %d", binary.BigEndian.Uint32(data[4:8]))
+	}
+
+	pi := &packIndex{}
+	pos := 8
+	for i := 0; i < 256; i++ {
+		pi.fanout[i] = binary.BigEndian.Uint32(data[pos:])
+		pos += 4
+		// lookup trusts the buckets, so they have to grow monotonically
+		if i > 0 && pi.fanout[i] < pi.fanout[i-1] {
+			return nil, ERROR_MALFORMED_IDX
+		}
+	}
+	n := int(pi.fanout[255])
+
+	// hashes, crc32 values and 4-byte offsets, then the trailer
+	if len(data) < pos+n*20+n*4+n*4+40 {
+		return nil, ERROR_MALFORMED_IDX
+	}
+	pi.hashes = data[pos : pos+n*20]
+	pos += n * 20
+	pos += n * 4 // crc32 is only needed when verifying or copying entries
+
+	smallOffsets := data[pos : pos+n*4]
+	pos += n * 4
+	large := data[pos : len(data)-40]
+	pi.packChecksum = data[len(data)-40 : len(data)-20]
+
+	pi.offsets = make([]uint64, n)
+	for i := 0; i < n; i++ {
+		off := binary.BigEndian.Uint32(smallOffsets[i*4:])
+		if off&0x80000000 == 0 {
+			pi.offsets[i] = uint64(off)
+			continue
+		}
+		li := int(off & 0x7fffffff)
+		if len(large) < li*8+8 {
+			return nil, ERROR_MALFORMED_IDX
+		}
+		pi.offsets[i] = binary.BigEndian.Uint64(large[li*8:])
+	}
+	return pi, nil
+}
+
+// PackFile is a .pack file together with its .idx.
+type PackFile struct {
+	path string
+	idx  *packIndex
+	file *os.File
+	size int64
+
+	mu    sync.Mutex
+	cache map[uint64]memObject // resolved delta bases by offset
+}
+
+func OpenPackFile(packPath string) (*PackFile, error) {
+	idxFile, err := os.Open(strings.TrimSuffix(packPath, ".pack") + ".idx")
+	if err != nil {
+		return nil, err
+	}
+	defer idxFile.Close()
+
+	idx, err := readPackIndex(idxFile)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(packPath)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, packHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !bytes.Equal(header[:4], []byte("PACK")) {
+		f.Close()
+		return nil, ERROR_MALFORMED_PACK
+	}
+	if v := binary.BigEndian.Uint32(header[4:8]); v != 2 && v != 3 {
+		f.Close()
+		return nil, fmt.Errorf("unsupported pack version %d", v)
+	}
+	if n := binary.BigEndian.Uint32(header[8:12]); int(n) != idx.count() {
+		f.Close()
+		return nil, fmt.Errorf("%s claims to have %d objects while the index indicates %d",
+			filepath.Base(packPath), n, idx.count())
+	}
+
+	// like git, only compare the trailers: hashing the whole pack is
+	// left to a full verification
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	trailer := make([]byte, 20)
+	if info.Size() < packHeaderSize+20 {
+		f.Close()
+		return nil, ERROR_MALFORMED_PACK
+	}
+	if _, err := f.ReadAt(trailer, info.Size()-20); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !bytes.Equal(trailer, idx.packChecksum) {
+		f.Close()
+		return nil, fmt.Errorf("%s does not match its index", filepath.Base(packPath))
+	}
+
+	return &PackFile{
+		path:  packPath,
+		idx:   idx,
+		file:  f,
+		size:  info.Size(),
+		cache: make(map[uint64]memObject),
+	}, nil
+}
+
+func (p *PackFile) Close() error {
+	return p.file.Close()
+}
+
+// readEntryHeader decodes the type and inflated size at offset and
+// returns a reader positioned right after the variable length header.
+func (p *PackFile) readEntryHeader(offset uint64) (int, int64, *bufio.Reader, error) {
+	r := bufio.NewReader(io.NewSectionReader(p.file, int64(offset), 1<<62))
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	objType := int(c>>4) & 0x7
+	size := int64(c & 0x0f)
+	shift := uint(4)
+	for c&0x80 != 0 {
+		if c, err = r.ReadByte(); err != nil {
+			return 0, 0, nil, err
+		}
+		size |= int64(c&0x7f) << shift
+		shift += 7
+	}
+	return objType, size, r, nil
+}
+
+// inflate decompresses an entry of the given size. The size comes from
+// the pack, so no more than the rest of the pack is allocated up front;
+// data that does not add up to the size makes the pack malformed.
+func inflate(r io.Reader, size, remaining int64) ([]byte, error) {
+	if size < 0 {
+		return nil, ERROR_MALFORMED_PACK
+	}
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	buf := bytes.NewBuffer(make([]byte, 0, max(min(size, remaining), 0)))
+	if _, err := buf.ReadFrom(io.LimitReader(zr, size+1)); err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) != size {
+		return nil, ERROR_MALFORMED_PACK
+	}
+	return buf.Bytes(), nil
+}
+
+// readAt returns the fully resolved object stored at offset,
+// following OFS_DELTA and REF_DELTA chains down to their base.
+// The content is the caller's to modify.
+func (p *PackFile) readAt(offset uint64) (ContentType, []byte, error) {
+	objType, content, err := p.resolveAt(offset, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	return objType, bytes.Clone(content), nil
+}
+
+// resolveAt is readAt without the copy: the content may be shared with
+// the delta base cache and must not be modified. depth counts the
+// deltas already followed to get here.
+func (p *PackFile) resolveAt(offset uint64, depth int) (ContentType, []byte, error) {
+	if depth > maxDeltaDepth {
+		return "", nil, ERROR_MALFORMED_PACK
+	}
+	p.mu.Lock()
+	cached, ok := p.cache[offset]
+	p.mu.Unlock()
+	if ok {
+		return cached.objType, cached.content, nil
+	}
+
+	objType, size, r, err := p.readEntryHeader(offset)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var baseType ContentType
+	var base []byte
+	switch objType {
+	case packCommit, packTree, packBlob, packTag:
+		data, err := inflate(r, size, p.size-int64(offset))
+		if err != nil {
+			return "", nil, err
+		}
+		return packTypeNames[objType], data, nil
+	case packOfsDelta:
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		rel := uint64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = r.ReadByte(); err != nil {
+				return "", nil, err
+			}
+			rel = ((rel + 1) << 7) | uint64(c&0x7f)
+		}
+		// the base comes earlier in the pack, after its header
+		if rel == 0 || offset < packHeaderSize+rel {
+			return "", nil, ERROR_MALFORMED_PACK
+		}
+		baseType, base, err = p.resolveAt(offset-rel, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+	case packRefDelta:
+		raw := make([]byte, 20)
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return "", nil, err
+		}
+		baseOffset, ok := p.idx.lookup(hex.EncodeToString(raw))
+		if !ok {
+			return "", nil, fmt.Errorf("delta base %x is not in %s", raw, filepath.Base(p.path))
+		}
+		if baseOffset == offset {
+			return "", nil, ERROR_MALFORMED_PACK
+		}
+		baseType, base, err = p.resolveAt(baseOffset, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+	default:
+		return "", nil, ERROR_MALFORMED_PACK
+	}
+
+	delta, err := inflate(r, size, p.size-int64(offset))
+	if err != nil {
+		return "", nil, err
+	}
+	content, err := applyDelta(base, delta)
+	if err != nil {
+		return "", nil, err
+	}
+
+	p.mu.Lock()
+	if len(p.cache) > 256 {
+		p.cache = make(map[uint64]memObject)
+	}
+	p.cache[offset] = memObject{objType: baseType, content: content}
+	p.mu.Unlock()
+	return baseType, content, nil
+}
+
+func readDeltaSize(delta []byte) (uint64, []byte) {
+	var size uint64
+	shift := uint(0)
+	for len(delta) > 0 {
+		c := delta[0]
+		delta = delta[1:]
+		size |= uint64(c&0x7f) << shift
+		shift += 7
+		if c&0x80 == 0 {
+			break
+		}
+	}
+	return size, delta
+}
+
+// applyDelta rebuilds the target of a git delta from its base.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	srcSize, delta := readDeltaSize(delta)
+	if srcSize != uint64(len(base)) {
+		return nil, ERROR_MALFORMED_DELTA
+	}
+	dstSize, delta := readDeltaSize(delta)
+
+	out := make([]byte, 0, dstSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+
+		if op&0x80 == 0 {
+			// insert the next op bytes literally
+			n := int(op)
+			if n == 0 || n > len(delta) {
+				return nil, ERROR_MALFORMED_DELTA
+			}
+			out = append(out, delta[:n]...)
+			delta = delta[n:]
+			continue
+		}
+
+		// copy from base: bits 0-3 select offset bytes, bits 4-6 size bytes
+		var offset, size uint32
+		for i := uint(0); i < 7; i++ {
+			if op&(1<<i) == 0 {
+				continue
+			}
+			if len(delta) == 0 {
+				return nil, ERROR_MALFORMED_DELTA
+			}
+			if i < 4 {
+				offset |= uint32(delta[0]) << (8 * i)
+			} else {
+				size |= uint32(delta[0]) << (8 * (i - 4))
+			}
+			delta = delta[1:]
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if uint64(offset)+uint64(size) > uint64(len(base)) {
+			return nil, ERROR_MALFORMED_DELTA
+		}
+		out = append(out, base[offset:offset+size]...)
+	}
+	if uint64(len(out)) != dstSize {
+		return nil, ERROR_MALFORMED_DELTA
+	}
+	return out, nil
+}
+
+// PackStore serves objects out of every pack in objects/pack.
+type PackStore struct {
+	packDir string
+
+	once  sync.Once
+	packs []*PackFile
+	err   error
+}
+
+func NewPackStore(gitRoot string) *PackStore {
+	return &PackStore{
+		packDir: filepath.Join(gitRoot, ROOTDIR, "objects", "pack"),
+	}
+}
+
+// load opens the packs lazily so commands that never
+// miss the loose store don't pay for reading indexes.
+func (ps *PackStore) load() error {
+	ps.once.Do(func() {
+		matches, err := filepath.Glob(filepath.Join(ps.packDir, "*.pack"))
+		if err != nil {
+			ps.err = err
+			return
+		}
+		for _, m := range matches {
+			pack, err := OpenPackFile(m)
+			if err != nil {
+				if os.IsNotExist(err) {
+					// pack without an idx yet, e.g. mid-repack
+					continue
+				}
+				ps.err = err
+				return
+			}
+			ps.packs = append(ps.packs, pack)
+		}
+	})
+	return ps.err
+}
+
+func (ps *PackStore) find(hash string) (*PackFile, uint64, bool) {
+	if err := ps.load(); err != nil {
+		return nil, 0, false
+	}
+	for _, pack := range ps.packs {
+		if off, ok := pack.idx.lookup(hash); ok {
+			return pack, off, true
+		}
+	}
+	return nil, 0, false
+}
+
+func (ps *PackStore) Has(hash string) bool {
+	_, _, ok := ps.find(hash)
+	return ok
+}
+
+func (ps *PackStore) Read(hash string) (ContentType, []byte, error) {
+	if err := ps.load(); err != nil {
+		return "", nil, err
+	}
+	pack, off, ok := ps.find(hash)
+	if !ok {
+		return "", nil, ERROR_OBJECT_NOT_FOUND
+	}
+	return pack.readAt(off)
+}
+
+func (ps *PackStore) Stream(hash string) (ContentType, int64, io.ReadCloser, error) {
+	objType, content, err := ps.Read(hash)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	return objType, int64(len(content)), io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (ps *PackStore) Write(objType ContentType, content []byte) (string, error) {
+	return "", ERROR_READ_ONLY_STORE
+}
+
+func (ps *PackStore) WriteStream(objType ContentType, size int64, r io.Reader) (string, error) {
+	return "", ERROR_READ_ONLY_STORE
+}
+
+func (ps *PackStore) findByPrefix(prefix string) ([]string, error) {
+	if err := ps.load(); err != nil {
+		return nil, err
+	}
+	var hashes []string
+	for _, pack := range ps.packs {
+		n := pack.idx.count()
+		i := sort.Search(n, func(k int) bool {
+			return pack.idx.hashAt(k) >= prefix
+		})
+		for ; i < n; i++ {
+			hash := pack.idx.hashAt(i)
+			if !strings.HasPrefix(hash, prefix) {
+				break
+			}
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes, nil
+}
+
+// Close releases the pack file handles.
+func (ps *PackStore) Close() error {
+	for _, pack := range ps.packs {
+		pack.Close()
+	}
+	ps.packs = nil
+	ps.once = sync.Once{}
+	return nil
+}
@@ -0,0 +1,195 @@
+package snapshots
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyDelta(t *testing.T) {
+	base := []byte("hello world\n")
+	delta := []byte{
+		12, 14, // source and target sizes
+		0x80 | 0x10, 6, // copy 6 bytes from offset 0: "hello "
+		3, 'g', 'i', 't', // insert "git"
+		0x80 | 0x01 | 0x10, 5, 5, // copy 5 bytes from offset 5: " worl"
+	}
+	out, err := applyDelta(base, delta)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello git worl", string(out))
+}
+
+func TestApplyDeltaSourceSizeMismatch(t *testing.T) {
+	_, err := applyDelta([]byte("abc"), []byte{4, 1, 1, 'x'})
+	assert.ErrorIs(t, err, ERROR_MALFORMED_DELTA)
+}
+
+func TestWritePackRoundTrip(t *testing.T) {
+	store := NewMemoryStore()
+	var objects []*PackObject
+	content := []byte{}
+	for i := 0; i < 200; i++ {
+		content = append(content, []byte("line of text for delta compression\n")...)
+	}
+	for i := 0; i < 3; i++ {
+		content = append(content, byte('a'+i))
+		hash, _ := store.Write(Blob, content)
+		objects = append(objects, &PackObject{Hash: hash, Path: "file.txt"})
+	}
+
+	dir := t.TempDir()
+	_, err := WritePack(store, dir, objects, PackOptions{Window: 10, Depth: 50})
+	assert.NoError(t, err)
+
+	packs := &PackStore{packDir: dir}
+	defer packs.Close()
+	deltas := 0
+	for _, obj := range objects {
+		objType, got, err := packs.Read(obj.Hash)
+		assert.NoError(t, err)
+		assert.Equal(t, Blob, objType)
+		assert.Equal(t, obj.Hash, hashObject(Blob, got))
+		if obj.depth > 0 {
+			deltas++
+		}
+	}
+	assert.Equal(t, 2, deltas)
+}
+
+// testdata/deltas.pack was written by git pack-objects --thin and fixed
+// with git index-pack --fix-thin, so it holds an OFS_DELTA chained onto
+// a REF_DELTA.
+func TestReadGitPack(t *testing.T) {
+	pack, err := OpenPackFile(filepath.Join("testdata", "deltas.pack"))
+	assert.NoError(t, err)
+	defer pack.Close()
+
+	kinds := make(map[int]int)
+	assert.Equal(t, 7, pack.idx.count())
+	for i := 0; i < pack.idx.count(); i++ {
+		hash := pack.idx.hashAt(i)
+		offset, ok := pack.idx.lookup(hash)
+		assert.True(t, ok)
+		kind, _, _, err := pack.readEntryHeader(offset)
+		assert.NoError(t, err)
+		kinds[kind]++
+
+		objType, content, err := pack.readAt(offset)
+		assert.NoError(t, err)
+		assert.Equal(t, hash, hashObject(objType, content))
+	}
+	assert.Equal(t, 1, kinds[packOfsDelta])
+	assert.Equal(t, 1, kinds[packRefDelta])
+
+	// the cached delta result is not handed out
+	offset, _ := pack.idx.lookup("d18a0fca9c2d77b5cdc754fdbf4b9d5899a93732")
+	_, content, err := pack.readAt(offset)
+	assert.NoError(t, err)
+	content[0] = 'X'
+	_, again, err := pack.readAt(offset)
+	assert.NoError(t, err)
+	assert.Equal(t, byte('l'), again[0])
+}
+
+func TestReadPackIndexRejectsBadFanout(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "deltas.idx"))
+	assert.NoError(t, err)
+	// bucket 0x10 claims more objects than the buckets after it
+	binary.BigEndian.PutUint32(data[8+0x10*4:], 100)
+	_, err = readPackIndex(bytes.NewReader(data))
+	assert.ErrorIs(t, err, ERROR_MALFORMED_IDX)
+}
+
+// craftedEntry is a pack entry written as is, so tests can build packs
+// git would never produce.
+type craftedEntry struct {
+	hash    string
+	objType int
+	size    int64 // claimed in the entry header
+	prefix  []byte
+	data    []byte
+}
+
+func writeCraftedPack(t *testing.T, entries []craftedEntry) string {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	sink := &packSink{w: &buf, sum: sha1.New(), crc: crc32.NewIEEE()}
+	header := make([]byte, packHeaderSize)
+	copy(header, "PACK")
+	binary.BigEndian.PutUint32(header[4:], 2)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(entries)))
+	sink.Write(header)
+
+	var objects []*PackObject
+	for _, e := range entries {
+		objects = append(objects, &PackObject{Hash: e.hash, offset: sink.offset})
+		sink.Write(encodeEntryHeader(e.objType, e.size))
+		sink.Write(e.prefix)
+		zw := zlib.NewWriter(sink)
+		zw.Write(e.data)
+		assert.NoError(t, zw.Close())
+	}
+	checksum := sink.sum.Sum(nil)
+	buf.Write(checksum)
+
+	path := filepath.Join(dir, "crafted.pack")
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	assert.NoError(t, writePackIndex(filepath.Join(dir, "crafted.idx"), objects, checksum))
+	return path
+}
+
+func TestReadPackRejectsRefDeltaCycle(t *testing.T) {
+	a, b := strings.Repeat("aa", 20), strings.Repeat("bb", 20)
+	rawA, _ := hex.DecodeString(a)
+	rawB, _ := hex.DecodeString(b)
+	delta := []byte{1, 1, 0x80 | 0x10, 1}
+	pack, err := OpenPackFile(writeCraftedPack(t, []craftedEntry{
+		{hash: a, objType: packRefDelta, size: int64(len(delta)), prefix: rawB, data: delta},
+		{hash: b, objType: packRefDelta, size: int64(len(delta)), prefix: rawA, data: delta},
+	}))
+	assert.NoError(t, err)
+	defer pack.Close()
+
+	offset, _ := pack.idx.lookup(a)
+	_, _, err = pack.readAt(offset)
+	assert.ErrorIs(t, err, ERROR_MALFORMED_PACK)
+}
+
+func TestReadPackRejectsWrongSize(t *testing.T) {
+	blob := []byte("hello\n")
+	hash := hashObject(Blob, blob)
+	for _, size := range []int64{1 << 50, 3} {
+		pack, err := OpenPackFile(writeCraftedPack(t, []craftedEntry{
+			{hash: hash, objType: packBlob, size: size, data: blob},
+		}))
+		assert.NoError(t, err)
+
+		offset, _ := pack.idx.lookup(hash)
+		_, _, err = pack.readAt(offset)
+		assert.ErrorIs(t, err, ERROR_MALFORMED_PACK, size)
+		pack.Close()
+	}
+}
+
+func TestOpenPackFileChecksTrailer(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"deltas.pack", "deltas.idx"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		assert.NoError(t, err)
+		if name == "deltas.pack" {
+			data[len(data)-1] ^= 0xff
+		}
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+	}
+	_, err := OpenPackFile(filepath.Join(dir, "deltas.pack"))
+	assert.ErrorContains(t, err, "deltas.pack does not match its index")
+}
@@ -0,0 +1,293 @@
+package snapshots
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var packTypeCodes = map[ContentType]int{
+	CommitType: packCommit,
+	Tree:       packTree,
+	Blob:       packBlob,
+	TagType:    packTag,
+}
+
+// PackObject is an object queued for packing. Path is the name the
+// object was reached by, used to group similar blobs for deltas.
+type PackObject struct {
+	Hash string
+	Type ContentType
+	Size int64
+	Path string
+
+	offset uint64
+	crc    uint32
+	depth  int
+}
+
+// PackOptions controls delta search when writing a pack.
+type PackOptions struct {
+	Window int // number of preceding objects tried as delta bases
+	Depth  int // longest allowed delta chain
+}
+
+// namePathHash mirrors git's pack_name_hash: the last characters of
+// the path weigh the most, so files with the same suffix sort together.
+func namePathHash(path string) uint32 {
+	var h uint32
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == ' ' || c == '\t' || c == '\n' {
+			continue
+		}
+		h = (h >> 2) + (uint32(c) << 24)
+	}
+	return h
+}
+
+// sortForDeltas orders objects the way git's delta search expects:
+// by type, then path hash, then size descending so bigger objects
+// become bases for the smaller ones following them.
+func sortForDeltas(objects []*PackObject) {
+	sort.SliceStable(objects, func(i, j int) bool {
+		a, b := objects[i], objects[j]
+		if a.Type != b.Type {
+			return packTypeCodes[a.Type] < packTypeCodes[b.Type]
+		}
+		ha, hb := namePathHash(a.Path), namePathHash(b.Path)
+		if ha != hb {
+			return ha < hb
+		}
+		return a.Size > b.Size
+	})
+}
+
+type windowEntry struct {
+	obj     *PackObject
+	content []byte
+}
+
+// packSink writes pack bytes while tracking the running checksum,
+// the current offset and the crc32 of the entry being written.
+type packSink struct {
+	w      io.Writer
+	sum    hash.Hash
+	crc    hash.Hash32
+	offset uint64
+}
+
+func (s *packSink) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.sum.Write(p[:n])
+	s.crc.Write(p[:n])
+	s.offset += uint64(n)
+	return n, err
+}
+
+func encodeEntryHeader(objType int, size int64) []byte {
+	c := byte(objType<<4) | byte(size&0x0f)
+	size >>= 4
+	var out []byte
+	for size > 0 {
+		out = append(out, c|0x80)
+		c = byte(size & 0x7f)
+		size >>= 7
+	}
+	return append(out, c)
+}
+
+func encodeOfsDelta(rel uint64) []byte {
+	buf := []byte{byte(rel & 0x7f)}
+	for rel >>= 7; rel != 0; rel >>= 7 {
+		rel--
+		buf = append([]byte{byte(0x80 | rel&0x7f)}, buf...)
+	}
+	return buf
+}
+
+func (s *packSink) writeEntry(objType int, prefix, data []byte) error {
+	s.crc.Reset()
+	if _, err := s.Write(encodeEntryHeader(objType, int64(len(data)))); err != nil {
+		return err
+	}
+	if _, err := s.Write(prefix); err != nil {
+		return err
+	}
+	zw := zlib.NewWriter(s)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// WritePack packs objects from store into packDir, trying up to
+// opts.Window earlier objects of the same type as OFS_DELTA bases.
+// It returns the path of the new .pack; the matching .idx is
+// written next to it.
+func WritePack(store ObjectStore, packDir string, objects []*PackObject, opts PackOptions) (string, error) {
+	if err := os.MkdirAll(packDir, 0755); err != nil {
+		return "", err
+	}
+	sortForDeltas(objects)
+
+	tmpPack, err := os.CreateTemp(packDir, "tmp_pack_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPack.Name())
+
+	sink := &packSink{w: tmpPack, sum: sha1.New(), crc: crc32.NewIEEE()}
+	header := make([]byte, packHeaderSize)
+	copy(header, "PACK")
+	binary.BigEndian.PutUint32(header[4:], 2)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(objects)))
+	if _, err := sink.Write(header); err != nil {
+		tmpPack.Close()
+		return "", err
+	}
+
+	var window []windowEntry
+	for _, obj := range objects {
+		objType, content, err := store.Read(obj.Hash)
+		if err != nil {
+			tmpPack.Close()
+			return "", err
+		}
+		obj.Type = objType
+		obj.Size = int64(len(content))
+		obj.offset = sink.offset
+
+		// pick the smallest delta among bases of the same type; older
+		// entries are tried first so ties favour shorter chains
+		var bestDelta []byte
+		var bestBase *PackObject
+		maxSize := len(content)/2 - 20
+		for _, base := range window {
+			if base.obj.Type != obj.Type || base.obj.depth >= opts.Depth {
+				continue
+			}
+			limit := maxSize
+			if bestDelta != nil {
+				limit = len(bestDelta) - 1
+			}
+			if limit <= 0 {
+				break
+			}
+			if d := createDelta(base.content, content, limit); d != nil {
+				bestDelta, bestBase = d, base.obj
+			}
+		}
+
+		if bestDelta != nil {
+			obj.depth = bestBase.depth + 1
+			rel := encodeOfsDelta(obj.offset - bestBase.offset)
+			err = sink.writeEntry(packOfsDelta, rel, bestDelta)
+		} else {
+			err = sink.writeEntry(packTypeCodes[objType], nil, content)
+		}
+		if err != nil {
+			tmpPack.Close()
+			return "", err
+		}
+		obj.crc = sink.crc.Sum32()
+
+		if opts.Window > 0 {
+			window = append(window, windowEntry{obj: obj, content: content})
+			if len(window) > opts.Window {
+				window = window[1:]
+			}
+		}
+	}
+
+	checksum := sink.sum.Sum(nil)
+	if _, err := tmpPack.Write(checksum); err != nil {
+		tmpPack.Close()
+		return "", err
+	}
+	if err := tmpPack.Sync(); err != nil {
+		tmpPack.Close()
+		return "", err
+	}
+	if err := tmpPack.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmpPack.Name(), 0444); err != nil {
+		return "", err
+	}
+
+	base := filepath.Join(packDir, "pack-"+hex.EncodeToString(checksum))
+	if err := os.Rename(tmpPack.Name(), base+".pack"); err != nil {
+		return "", err
+	}
+	if err := writePackIndex(base+".idx", objects, checksum); err != nil {
+		return "", err
+	}
+	return base + ".pack", nil
+}
+
+// writePackIndex writes a version 2 .idx for the packed objects.
+func writePackIndex(path string, objects []*PackObject, packChecksum []byte) error {
+	sorted := make([]*PackObject, len(objects))
+	copy(sorted, objects)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Hash < sorted[j].Hash
+	})
+
+	var buf bytes.Buffer
+	buf.Write([]byte{0xff, 't', 'O', 'c'})
+	binary.Write(&buf, binary.BigEndian, uint32(2))
+
+	var fanout [256]uint32
+	for _, obj := range sorted {
+		raw, err := hex.DecodeString(obj.Hash[:2])
+		if err != nil {
+			return err
+		}
+		fanout[raw[0]]++
+	}
+	for i := 1; i < 256; i++ {
+		fanout[i] += fanout[i-1]
+	}
+	binary.Write(&buf, binary.BigEndian, fanout)
+
+	for _, obj := range sorted {
+		raw, err := hex.DecodeString(obj.Hash)
+		if err != nil {
+			return err
+		}
+		buf.Write(raw)
+	}
+	for _, obj := range sorted {
+		binary.Write(&buf, binary.BigEndian, obj.crc)
+	}
+	var large []uint64
+	for _, obj := range sorted {
+		if obj.offset < 0x80000000 {
+			binary.Write(&buf, binary.BigEndian, uint32(obj.offset))
+			continue
+		}
+		binary.Write(&buf, binary.BigEndian, uint32(0x80000000|len(large)))
+		large = append(large, obj.offset)
+	}
+	for _, off := range large {
+		binary.Write(&buf, binary.BigEndian, off)
+	}
+	buf.Write(packChecksum)
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0444); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
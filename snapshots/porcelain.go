@@ -0,0 +1,213 @@
+package snapshots
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// status output formats
+const (
+	STATUS_LONG        = "long"
+	STATUS_SHORT       = "short"
+	STATUS_PORCELAIN   = "v1"
+	STATUS_PORCELAIN_2 = "v2"
+)
+
+const zeroHash = "0000000000000000000000000000000000000000"
+
+// statusOptions are the flags shared by the status output formats.
+type statusOptions struct {
+	format      string
+	branch      bool   // print the branch header
+	nulTerm     bool   // -z: NUL terminated, unquoted paths
+	showIgnored bool   // list ignored files too
+	prefix      string // cwd relative to the repository root, for --short
+}
+
+// quotePath quotes a path the way git does (core.quotePath) when it
+// holds characters that would confuse a line based parser.
+func quotePath(p string) string {
+	needsQuote := false
+	for i := 0; i < len(p); i++ {
+		if c := p[i]; c < 0x20 || c == '"' || c == '\\' || c >= 0x7f {
+			needsQuote = true
+			break
+		}
+	}
+	if !needsQuote {
+		return p
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\v':
+			b.WriteString(`\v`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&b, `\%03o`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// statusWriter emits records terminated by newlines, or NULs with -z.
+type statusWriter struct {
+	w    *bufio.Writer
+	opts statusOptions
+}
+
+func (sw *statusWriter) path(p string) string {
+	if sw.opts.format == STATUS_SHORT && sw.opts.prefix != "" && sw.opts.prefix != "." {
+		if rel, err := filepath.Rel(sw.opts.prefix, p); err == nil {
+			p = filepath.ToSlash(rel)
+		}
+	}
+	if sw.opts.nulTerm {
+		return p
+	}
+	return quotePath(p)
+}
+
+func (sw *statusWriter) record(format string, args ...any) {
+	fmt.Fprintf(sw.w, format, args...)
+	if sw.opts.nulTerm {
+		sw.w.WriteByte(0)
+	} else {
+		sw.w.WriteByte('\n')
+	}
+}
+
+// printShortStatus writes the --short and --porcelain (v1) formats:
+// "XY path", or "XY orig -> path" for renames ("XY path\0orig" with -z).
+func printShortStatus(out io.Writer, s *Status, opts statusOptions) error {
+	sw := &statusWriter{w: bufio.NewWriter(out), opts: opts}
+	if opts.branch {
+		switch {
+		case s.HeadHash == "":
+			sw.record("## No commits yet on %s", s.Branch)
+		case s.Branch == "":
+			sw.record("## HEAD (no branch)")
+		default:
+			sw.record("## %s", s.Branch)
+		}
+	}
+	for _, fs := range s.Files {
+		xy := string([]byte{byte(fs.Staged), byte(fs.Unstaged)})
+		switch {
+		case fs.OrigPath == "":
+			sw.record("%s %s", xy, sw.path(fs.Path))
+		case opts.nulTerm:
+			sw.record("%s %s\x00%s", xy, sw.path(fs.Path), sw.path(fs.OrigPath))
+		default:
+			sw.record("%s %s -> %s", xy, sw.path(fs.OrigPath), sw.path(fs.Path))
+		}
+	}
+	for _, p := range s.Untracked {
+		sw.record("?? %s", sw.path(p))
+	}
+	if opts.showIgnored {
+		for _, p := range s.Ignored {
+			sw.record("!! %s", sw.path(p))
+		}
+	}
+	return sw.w.Flush()
+}
+
+func v2Hash(hash string) string {
+	if hash == "" {
+		return zeroHash
+	}
+	return hash
+}
+
+// v2Column is a status letter in porcelain v2, where "." stands for
+// unmodified.
+func v2Column(kind ChangeKind) byte {
+	if kind == Unmodified {
+		return '.'
+	}
+	return byte(kind)
+}
+
+// printPorcelainV2 writes git's --porcelain=v2 format.
+func printPorcelainV2(out io.Writer, s *Status, opts statusOptions) error {
+	sw := &statusWriter{w: bufio.NewWriter(out), opts: opts}
+	if opts.branch {
+		if s.HeadHash == "" {
+			sw.record("# branch.oid (initial)")
+		} else {
+			sw.record("# branch.oid %s", s.HeadHash)
+		}
+		if s.Branch == "" {
+			sw.record("# branch.head (detached)")
+		} else {
+			sw.record("# branch.head %s", s.Branch)
+		}
+	}
+
+	// changed entries come first, then unmerged ones, like git
+	const sub = "N..." // not a submodule
+	for _, fs := range s.Files {
+		xy := string([]byte{v2Column(fs.Staged), v2Column(fs.Unstaged)})
+		switch {
+		case fs.IsUnmerged():
+			continue
+		case fs.OrigPath != "":
+			sep := "\t"
+			if opts.nulTerm {
+				sep = "\x00"
+			}
+			sw.record("2 %s %s %06o %06o %06o %s %s %c%d %s%s%s", xy, sub,
+				fs.HeadMode, fs.IndexMode, fs.WorktreeMode,
+				v2Hash(fs.HeadHash), v2Hash(fs.IndexHash), fs.Staged, fs.Score,
+				sw.path(fs.Path), sep, sw.path(fs.OrigPath))
+		default:
+			sw.record("1 %s %s %06o %06o %06o %s %s %s", xy, sub,
+				fs.HeadMode, fs.IndexMode, fs.WorktreeMode,
+				v2Hash(fs.HeadHash), v2Hash(fs.IndexHash), sw.path(fs.Path))
+		}
+	}
+	for _, fs := range s.Files {
+		if !fs.IsUnmerged() {
+			continue
+		}
+		sw.record("u %c%c %s %06o %06o %06o %06o %s %s %s %s", v2Column(fs.Staged), v2Column(fs.Unstaged), sub,
+			fs.StageModes[0], fs.StageModes[1], fs.StageModes[2], fs.WorktreeMode,
+			v2Hash(fs.StageHashes[0]), v2Hash(fs.StageHashes[1]), v2Hash(fs.StageHashes[2]),
+			sw.path(fs.Path))
+	}
+	for _, p := range s.Untracked {
+		sw.record("? %s", sw.path(p))
+	}
+	if opts.showIgnored {
+		for _, p := range s.Ignored {
+			sw.record("! %s", sw.path(p))
+		}
+	}
+	return sw.w.Flush()
+}
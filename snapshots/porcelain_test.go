@@ -0,0 +1,44 @@
+package snapshots
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotePath(t *testing.T) {
+	assert.Equal(t, "plain/file.txt", quotePath("plain/file.txt"))
+	assert.Equal(t, `"we ird\"name"`, quotePath(`we ird"name`))
+	assert.Equal(t, `"tab\there"`, quotePath("tab\there"))
+	assert.Equal(t, `"caf\303\251"`, quotePath("café"))
+}
+
+func TestPorcelainFormats(t *testing.T) {
+	blob := "ba2906d0666cf726c7eaadd2cd3db615dedfdf3a"
+	s := &Status{
+		Branch:   "main",
+		HeadHash: "f190db4145c345eb94dba2946acd275ed125d947",
+		Files: []FileStatus{
+			{Path: "a", Staged: Modified, Unstaged: Unmodified, HeadMode: 0100644, IndexMode: 0100644, WorktreeMode: 0100644, HeadHash: blob, IndexHash: blob},
+			{Path: "new", OrigPath: "old", Staged: Renamed, Unstaged: Modified, Score: 100, HeadMode: 0100644, IndexMode: 0100644, WorktreeMode: 0100644, HeadHash: blob, IndexHash: blob},
+		},
+		Untracked: []string{"u"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, printShortStatus(&buf, s, statusOptions{format: STATUS_PORCELAIN}))
+	assert.Equal(t, "M  a\nRM old -> new\n?? u\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, printShortStatus(&buf, s, statusOptions{format: STATUS_PORCELAIN, nulTerm: true}))
+	assert.Equal(t, "M  a\x00RM new\x00old\x00?? u\x00", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, printPorcelainV2(&buf, s, statusOptions{format: STATUS_PORCELAIN_2, branch: true}))
+	assert.Equal(t, "# branch.oid f190db4145c345eb94dba2946acd275ed125d947\n"+
+		"# branch.head main\n"+
+		"1 M. N... 100644 100644 100644 "+blob+" "+blob+" a\n"+
+		"2 RM N... 100644 100644 100644 "+blob+" "+blob+" R100 new\told\n"+
+		"? u\n", buf.String())
+}
@@ -0,0 +1,379 @@
+package snapshots
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// log output formats, as named by --pretty
+const (
+	PRETTY_ONELINE = "oneline"
+	PRETTY_SHORT   = "short"
+	PRETTY_MEDIUM  = "medium"
+	PRETTY_FULL    = "full"
+	PRETTY_FULLER  = "fuller"
+	PRETTY_RAW     = "raw"
+	PRETTY_FORMAT  = "format"  // placeholders, newlines between commits
+	PRETTY_TFORMAT = "tformat" // placeholders, a newline after each commit
+)
+
+// date modes, as named by --date
+const (
+	DATE_DEFAULT  = "default"
+	DATE_ISO      = "iso"
+	DATE_RFC      = "rfc"
+	DATE_RELATIVE = "relative"
+	DATE_SHORT    = "short"
+	DATE_UNIX     = "unix"
+)
+
+// TAB_WIDTH is how far log expands tabs in medium, full and fuller messages.
+const TAB_WIDTH = 8
+
+// prettyOptions choose how log shows each commit.
+type prettyOptions struct {
+	format     string
+	userFormat string    // the placeholders of PRETTY_FORMAT and PRETTY_TFORMAT
+	abbrev     bool      // abbreviate the commit hash
+	dateMode   string    // one of the DATE_* modes
+	now        time.Time // what relative dates count back from
+}
+
+func defaultPrettyOptions() prettyOptions {
+	return prettyOptions{format: PRETTY_MEDIUM, dateMode: DATE_DEFAULT, now: time.Now()}
+}
+
+// parsePretty reads the value of --pretty or --format: a format name,
+// "format:<string>", "tformat:<string>" or a string with placeholders.
+// An empty value shows nothing for each commit.
+func (p *prettyOptions) parsePretty(value string) error {
+	switch value {
+	case PRETTY_ONELINE, PRETTY_SHORT, PRETTY_MEDIUM, PRETTY_FULL, PRETTY_FULLER, PRETTY_RAW:
+		p.format = value
+		return nil
+	}
+	if userFormat, ok := strings.CutPrefix(value, PRETTY_FORMAT+":"); ok {
+		p.format, p.userFormat = PRETTY_FORMAT, userFormat
+		return nil
+	}
+	if userFormat, ok := strings.CutPrefix(value, PRETTY_TFORMAT+":"); ok {
+		p.format, p.userFormat = PRETTY_TFORMAT, userFormat
+		return nil
+	}
+	if value == "" || strings.Contains(value, "%") {
+		p.format, p.userFormat = PRETTY_TFORMAT, value
+		return nil
+	}
+	return fmt.Errorf("invalid --pretty format: %s", value)
+}
+
+// parseDateMode reads the value of --date.
+func parseDateMode(value string) (string, error) {
+	switch value {
+	case DATE_DEFAULT, DATE_ISO, DATE_RFC, DATE_RELATIVE, DATE_SHORT, DATE_UNIX:
+		return value, nil
+	case "iso8601":
+		return DATE_ISO, nil
+	case "rfc2822":
+		return DATE_RFC, nil
+	}
+	return "", fmt.Errorf("unknown date format %s", value)
+}
+
+// formatDate shows when in its own timezone, like git's show_date.
+func formatDate(when time.Time, mode string, now time.Time) string {
+	switch mode {
+	case DATE_ISO:
+		return when.Format("2006-01-02 15:04:05 -0700")
+	case DATE_RFC:
+		return when.Format("Mon, 2 Jan 2006 15:04:05 -0700")
+	case DATE_RELATIVE:
+		return relativeDate(when, now)
+	case DATE_SHORT:
+		return when.Format("2006-01-02")
+	case DATE_UNIX:
+		return strconv.FormatInt(when.Unix(), 10)
+	}
+	return when.Format("Mon Jan 2 15:04:05 2006 -0700")
+}
+
+func plural(n int64, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// relativeDate rounds the age of when the way git does: seconds up to
+// 90 of them, then minutes, hours, days, weeks, months and years.
+func relativeDate(when, now time.Time) string {
+	if now.Before(when) {
+		return "in the future"
+	}
+	diff := now.Unix() - when.Unix()
+	if diff < 90 {
+		return plural(diff, "second") + " ago"
+	}
+	if diff = (diff + 30) / 60; diff < 90 {
+		return plural(diff, "minute") + " ago"
+	}
+	if diff = (diff + 30) / 60; diff < 36 {
+		return plural(diff, "hour") + " ago"
+	}
+	diff = (diff + 12) / 24 // days from here on
+	switch {
+	case diff < 14:
+		return plural(diff, "day") + " ago"
+	case diff < 70:
+		return plural((diff+3)/7, "week") + " ago"
+	case diff < 365:
+		return plural((diff+15)/30, "month") + " ago"
+	case diff < 1825:
+		months := (diff*12*2 + 365) / (365 * 2)
+		if months%12 == 0 {
+			return plural(months/12, "year") + " ago"
+		}
+		return plural(months/12, "year") + ", " + plural(months%12, "month") + " ago"
+	}
+	return plural((diff+183)/365, "year") + " ago"
+}
+
+func isBlankLine(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// messageParts splits a commit message into its subject, the first
+// paragraph joined into one line, and the body after it.
+func messageParts(message string) (string, string) {
+	lines := strings.SplitAfter(message, "\n")
+	i := 0
+	for i < len(lines) && isBlankLine(lines[i]) {
+		i++
+	}
+	var subject []string
+	for ; i < len(lines) && !isBlankLine(lines[i]); i++ {
+		subject = append(subject, strings.TrimRight(lines[i], " \t\r\n"))
+	}
+	for i < len(lines) && isBlankLine(lines[i]) {
+		i++
+	}
+	return strings.Join(subject, " "), strings.Join(lines[i:], "")
+}
+
+// expandTabs replaces the tabs of line with spaces up to the next
+// multiple of TAB_WIDTH.
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	column := 0
+	for _, r := range line {
+		if r == '\t' {
+			n := TAB_WIDTH - column%TAB_WIDTH
+			b.WriteString(strings.Repeat(" ", n))
+			column += n
+			continue
+		}
+		b.WriteRune(r)
+		column++
+	}
+	return b.String()
+}
+
+// writeMessage indents the message without its leading blank lines.
+// The short format stops after the first paragraph.
+func (p prettyOptions) writeMessage(b *strings.Builder, message string) {
+	started := false
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			if !started {
+				continue
+			}
+			if p.format == PRETTY_SHORT {
+				break
+			}
+		}
+		started = true
+		switch p.format {
+		case PRETTY_MEDIUM, PRETTY_FULL, PRETTY_FULLER:
+			line = expandTabs(line)
+		}
+		b.WriteString("    " + line + "\n")
+	}
+}
+
+func (p prettyOptions) commitHash(hash string) string {
+	if p.abbrev {
+		return hash[:7]
+	}
+	return hash
+}
+
+// show formats one commit in a builtin format, or expands the user
+// format. decoration lists the refs pointing at the commit.
+func (p prettyOptions) show(c *RevCommit, decoration string) string {
+	switch p.format {
+	case PRETTY_FORMAT, PRETTY_TFORMAT:
+		return p.expand(c, decoration)
+	case PRETTY_ONELINE:
+		subject, _ := messageParts(c.message)
+		if decoration != "" {
+			return fmt.Sprintf("%s (%s) %s", p.commitHash(c.Hash), decoration, subject)
+		}
+		return fmt.Sprintf("%s %s", p.commitHash(c.Hash), subject)
+	}
+
+	var b strings.Builder
+	b.WriteString("commit " + p.commitHash(c.Hash))
+	if decoration != "" {
+		fmt.Fprintf(&b, " (%s)", decoration)
+	}
+	b.WriteString("\n")
+	if p.format == PRETTY_RAW {
+		fmt.Fprintf(&b, "tree %s\n", c.tree)
+		for _, parent := range c.shownParents() {
+			fmt.Fprintf(&b, "parent %s\n", parent)
+		}
+		fmt.Fprintf(&b, "author %s\ncommitter %s\n", c.author, c.commiter)
+	} else {
+		if parents := c.shownParents(); len(parents) > 1 {
+			b.WriteString("Merge:")
+			for _, parent := range parents {
+				b.WriteString(" " + parent[:7])
+			}
+			b.WriteString("\n")
+		}
+		author := fmt.Sprintf("%s <%s>", c.author.Name, c.author.Email)
+		committer := fmt.Sprintf("%s <%s>", c.commiter.Name, c.commiter.Email)
+		switch p.format {
+		case PRETTY_SHORT:
+			fmt.Fprintf(&b, "Author: %s\n", author)
+		case PRETTY_MEDIUM:
+			fmt.Fprintf(&b, "Author: %s\n", author)
+			fmt.Fprintf(&b, "Date:   %s\n", formatDate(c.author.When, p.dateMode, p.now))
+		case PRETTY_FULL:
+			fmt.Fprintf(&b, "Author: %s\nCommit: %s\n", author, committer)
+		case PRETTY_FULLER:
+			fmt.Fprintf(&b, "Author:     %s\n", author)
+			fmt.Fprintf(&b, "AuthorDate: %s\n", formatDate(c.author.When, p.dateMode, p.now))
+			fmt.Fprintf(&b, "Commit:     %s\n", committer)
+			fmt.Fprintf(&b, "CommitDate: %s\n", formatDate(c.commiter.When, p.dateMode, p.now))
+		}
+	}
+	b.WriteString("\n")
+	p.writeMessage(&b, c.message)
+	return strings.TrimRight(b.String(), " \t\n") + "\n"
+}
+
+// expand fills in the placeholders of the user format. Unknown
+// placeholders are kept as they are, like git does.
+func (p prettyOptions) expand(c *RevCommit, decoration string) string {
+	var b strings.Builder
+	f := p.userFormat
+	for i := 0; i < len(f); i++ {
+		if f[i] != '%' {
+			b.WriteByte(f[i])
+			continue
+		}
+		text, n := p.placeholder(c, decoration, f[i+1:])
+		if n == 0 {
+			b.WriteByte('%')
+			continue
+		}
+		b.WriteString(text)
+		i += n
+	}
+	return b.String()
+}
+
+// placeholder expands the placeholder at the start of spec, returning
+// its text and length, or a length of 0 for an unknown placeholder.
+func (p prettyOptions) placeholder(c *RevCommit, decoration, spec string) (string, int) {
+	if spec == "" {
+		return "", 0
+	}
+	switch spec[0] {
+	case '%':
+		return "%", 1
+	case 'n':
+		return "\n", 1
+	case 'x':
+		if len(spec) >= 3 {
+			if v, err := strconv.ParseUint(spec[1:3], 16, 8); err == nil {
+				return string([]byte{byte(v)}), 3
+			}
+		}
+		return "", 0
+	case 'H':
+		return c.Hash, 1
+	case 'h':
+		return c.Hash[:7], 1
+	case 'T':
+		return c.tree, 1
+	case 't':
+		return c.tree[:7], 1
+	case 'P':
+		return strings.Join(c.shownParents(), " "), 1
+	case 'p':
+		parents := c.shownParents()
+		short := make([]string, len(parents))
+		for i, parent := range parents {
+			short[i] = parent[:7]
+		}
+		return strings.Join(short, " "), 1
+	case 's':
+		subject, _ := messageParts(c.message)
+		return subject, 1
+	case 'b':
+		_, body := messageParts(c.message)
+		return body, 1
+	case 'B':
+		return c.message, 1
+	case 'd':
+		if decoration == "" {
+			return "", 1
+		}
+		return " (" + decoration + ")", 1
+	case 'D':
+		return decoration, 1
+	case 'a', 'c':
+		if len(spec) < 2 {
+			return "", 0
+		}
+		sig := c.author
+		if spec[0] == 'c' {
+			sig = c.commiter
+		}
+		if text, ok := p.person(sig, spec[1]); ok {
+			return text, 2
+		}
+	}
+	return "", 0
+}
+
+// person expands the second letter of an author or committer placeholder.
+func (p prettyOptions) person(sig Signature, part byte) (string, bool) {
+	switch part {
+	case 'n':
+		return sig.Name, true
+	case 'e':
+		return sig.Email, true
+	case 'd':
+		return formatDate(sig.When, p.dateMode, p.now), true
+	case 'D':
+		return formatDate(sig.When, DATE_RFC, p.now), true
+	case 'i':
+		return formatDate(sig.When, DATE_ISO, p.now), true
+	case 'r':
+		return formatDate(sig.When, DATE_RELATIVE, p.now), true
+	case 's':
+		return formatDate(sig.When, DATE_SHORT, p.now), true
+	case 't':
+		return formatDate(sig.When, DATE_UNIX, p.now), true
+	}
+	return "", false
+}
@@ -0,0 +1,91 @@
+package snapshots
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatDate(t *testing.T) {
+	loc, err := parseTimezone("+0545")
+	assert.NoError(t, err)
+	when := time.Unix(1700000000, 0).In(loc)
+
+	for mode, want := range map[string]string{
+		DATE_DEFAULT: "Wed Nov 15 03:58:20 2023 +0545",
+		DATE_ISO:     "2023-11-15 03:58:20 +0545",
+		DATE_RFC:     "Wed, 15 Nov 2023 03:58:20 +0545",
+		DATE_SHORT:   "2023-11-15",
+		DATE_UNIX:    "1700000000",
+	} {
+		assert.Equal(t, want, formatDate(when, mode, time.Now()), mode)
+	}
+
+	_, err = parseDateMode("weekday")
+	assert.EqualError(t, err, "unknown date format weekday")
+}
+
+func TestRelativeDate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for ago, want := range map[int64]string{
+		1:            "1 second ago",
+		89:           "89 seconds ago",
+		90:           "2 minutes ago",
+		3 * 3600:     "3 hours ago",
+		36 * 3600:    "2 days ago",
+		20 * 86400:   "3 weeks ago",
+		100 * 86400:  "3 months ago",
+		400 * 86400:  "1 year, 1 month ago",
+		730 * 86400:  "2 years ago",
+		3000 * 86400: "8 years ago",
+		-5:           "in the future",
+	} {
+		assert.Equal(t, want, relativeDate(now.Add(-time.Duration(ago)*time.Second), now), ago)
+	}
+}
+
+func TestPrettyFormats(t *testing.T) {
+	sig := Signature{Name: "A U Thor", Email: "a@example.com", When: time.Unix(1700000000, 0).UTC()}
+	c := &RevCommit{
+		Hash: "0123456789abcdef0123456789abcdef01234567",
+		Commit: &Commit{
+			tree:     "89abcdef0123456789abcdef0123456789abcdef",
+			parents:  []string{"1111111111111111111111111111111111111111", "2222222222222222222222222222222222222222"},
+			author:   sig,
+			commiter: sig,
+			message:  "\nSubject\ncontinued\n\nBody\twith tab\n\n",
+		},
+	}
+
+	p := defaultPrettyOptions()
+	assert.Equal(t, "commit 0123456789abcdef0123456789abcdef01234567 (HEAD -> main)\n"+
+		"Merge: 1111111 2222222\n"+
+		"Author: A U Thor <a@example.com>\n"+
+		"Date:   Tue Nov 14 22:13:20 2023 +0000\n"+
+		"\n"+
+		"    Subject\n"+
+		"    continued\n"+
+		"    \n"+
+		"    Body    with tab\n", p.show(c, "HEAD -> main"))
+
+	assert.NoError(t, p.parsePretty("short"))
+	assert.Equal(t, "commit 0123456789abcdef0123456789abcdef01234567\n"+
+		"Merge: 1111111 2222222\n"+
+		"Author: A U Thor <a@example.com>\n"+
+		"\n"+
+		"    Subject\n"+
+		"    continued\n", p.show(c, ""))
+
+	p.abbrev = true
+	assert.NoError(t, p.parsePretty("oneline"))
+	assert.Equal(t, "0123456 Subject continued", p.show(c, ""))
+
+	p.dateMode = DATE_SHORT
+	assert.NoError(t, p.parsePretty("%h %an <%ae> %ad%d %s%n%b|%q%x41%%"))
+	assert.Equal(t, PRETTY_TFORMAT, p.format)
+	assert.Equal(t, "0123456 A U Thor <a@example.com> 2023-11-14 (tag) Subject continued\nBody\twith tab\n\n|%qA%",
+		p.show(c, "tag"))
+
+	assert.EqualError(t, p.parsePretty("nonsense"), "invalid --pretty format: nonsense")
+}
@@ -0,0 +1,309 @@
+package snapshots
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	SYMREF_PREFIX  string = "ref: "
+	BRANCH_PREFIX  string = "refs/heads/"
+	TAG_PREFIX     string = "refs/tags/"
+	DEFAULT_BRANCH string = "main"
+	PACKED_REFS    string = "packed-refs"
+)
+
+var (
+	ERROR_INVALID_REF_NAME = fmt.Errorf("invalid reference name")
+	ERROR_REF_NOT_FOUND    = fmt.Errorf("reference not found")
+)
+
+func refPath(gitRoot, name string) string {
+	return filepath.Join(gitRoot, ROOTDIR, filepath.FromSlash(name))
+}
+
+// readPackedRefs returns the refs listed in packed-refs, where git gc
+// and git pack-refs move loose refs to. Loose refs take precedence.
+func readPackedRefs(gitRoot string) (map[string]string, error) {
+	refs := make(map[string]string)
+	data, err := os.ReadFile(refPath(gitRoot, PACKED_REFS))
+	if os.IsNotExist(err) {
+		return refs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// skip the header, and the "^hash" lines peeling annotated tags
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		hash, name, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("malformed %s line: %q", PACKED_REFS, line)
+		}
+		refs[strings.TrimSpace(name)] = hash
+	}
+	return refs, nil
+}
+
+// deletePackedRef drops name, with its peeled line, from packed-refs.
+// It reports whether name was there.
+func deletePackedRef(gitRoot, name string) (bool, error) {
+	path := refPath(gitRoot, PACKED_REFS)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var kept []string
+	found, dropping := false, false
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if dropping && strings.HasPrefix(line, "^") {
+			continue
+		}
+		dropping = false
+		if _, ref, ok := strings.Cut(strings.TrimSpace(line), " "); ok && line[0] != '#' && ref == name {
+			found, dropping = true, true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if !found {
+		return false, nil
+	}
+	lock := path + ".lock"
+	if err := os.WriteFile(lock, []byte(strings.Join(kept, "")), 0644); err != nil {
+		return false, err
+	}
+	return true, os.Rename(lock, path)
+}
+
+// readRef returns the hash stored in a ref such as refs/heads/main,
+// following symbolic refs. Refs without a file are looked up in
+// packed-refs.
+func readRef(gitRoot, name string) (string, error) {
+	for depth := 0; depth < 5; depth++ {
+		data, err := os.ReadFile(refPath(gitRoot, name))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+			packed, err := readPackedRefs(gitRoot)
+			if err != nil {
+				return "", err
+			}
+			if hash, ok := packed[name]; ok {
+				return hash, nil
+			}
+			return "", ERROR_REF_NOT_FOUND
+		}
+		value := strings.TrimSpace(string(data))
+		target, ok := strings.CutPrefix(value, SYMREF_PREFIX)
+		if !ok {
+			if value == "" {
+				return "", ERROR_REF_NOT_FOUND
+			}
+			return value, nil
+		}
+		name = strings.TrimSpace(target)
+	}
+	return "", fmt.Errorf("symbolic ref loop at %s", name)
+}
+
+// writeRef points name at hash, going through a lock file like the index.
+func writeRef(gitRoot, name, hash string) error {
+	path := refPath(gitRoot, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	lock := path + ".lock"
+	if err := os.WriteFile(lock, []byte(hash+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(lock, path)
+}
+
+func deleteRef(gitRoot, name string) error {
+	packed, err := deletePackedRef(gitRoot, name)
+	if err != nil {
+		return err
+	}
+	path := refPath(gitRoot, name)
+	if err := os.Remove(path); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if !packed {
+			return ERROR_REF_NOT_FOUND
+		}
+		return nil
+	}
+	// drop empty parent folders left by names like feature/x
+	heads := refPath(gitRoot, BRANCH_PREFIX)
+	for dir := filepath.Dir(path); strings.HasPrefix(dir, heads) && dir != filepath.Clean(heads); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// namedRef is a ref and the object it resolves to.
+type namedRef struct {
+	name string
+	hash string
+}
+
+// listRefs returns every ref under prefix (such as "refs/" or
+// BRANCH_PREFIX), loose or packed, sorted by name.
+func listRefs(gitRoot, prefix string) ([]namedRef, error) {
+	packed, err := readPackedRefs(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+	// names maps each ref to whether it has a loose file
+	names := make(map[string]bool)
+	for name := range packed {
+		if strings.HasPrefix(name, prefix) {
+			names[name] = false
+		}
+	}
+
+	refsDir := refPath(gitRoot, "refs")
+	err = filepath.WalkDir(refsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(refsDir, path)
+		if err != nil {
+			return err
+		}
+		if name := "refs/" + filepath.ToSlash(rel); strings.HasPrefix(name, prefix) {
+			names[name] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]namedRef, 0, len(names))
+	for name, loose := range names {
+		if !loose {
+			refs = append(refs, namedRef{name: name, hash: packed[name]})
+			continue
+		}
+		hash, err := readRef(gitRoot, name)
+		if err == ERROR_REF_NOT_FOUND {
+			continue // a symbolic ref to a missing branch
+		}
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, namedRef{name: name, hash: hash})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].name < refs[j].name })
+	return refs, nil
+}
+
+// readHEAD returns the ref HEAD points at ("" when detached)
+// and the commit it resolves to ("" on an unborn branch).
+func readHEAD(gitRoot string) (string, string, error) {
+	data, err := os.ReadFile(refPath(gitRoot, "HEAD"))
+	if err != nil {
+		return "", "", err
+	}
+	value := strings.TrimSpace(string(data))
+	ref, ok := strings.CutPrefix(value, SYMREF_PREFIX)
+	if !ok {
+		return "", value, nil
+	}
+	ref = strings.TrimSpace(ref)
+	hash, err := readRef(gitRoot, ref)
+	if err == ERROR_REF_NOT_FOUND {
+		return ref, "", nil
+	}
+	return ref, hash, err
+}
+
+// setHEAD makes HEAD a symbolic ref to the given branch ref.
+func setHEAD(gitRoot, ref string) error {
+	return os.WriteFile(refPath(gitRoot, "HEAD"), []byte(SYMREF_PREFIX+ref+"\n"), 0644)
+}
+
+// detachHEAD stores a raw commit hash in HEAD.
+func detachHEAD(gitRoot, hash string) error {
+	return os.WriteFile(refPath(gitRoot, "HEAD"), []byte(hash+"\n"), 0644)
+}
+
+// CurrentBranch returns the checked out branch name,
+// or false when HEAD is detached.
+func CurrentBranch(gitRoot string) (string, bool, error) {
+	ref, _, err := readHEAD(gitRoot)
+	if err != nil {
+		return "", false, err
+	}
+	if ref == "" {
+		return "", false, nil
+	}
+	return strings.TrimPrefix(ref, BRANCH_PREFIX), true, nil
+}
+
+// headDescription is the "On branch x" / "HEAD detached at y" line.
+func headDescription(gitRoot string) (string, error) {
+	ref, hash, err := readHEAD(gitRoot)
+	if err != nil {
+		return "", err
+	}
+	if ref == "" {
+		if len(hash) > 7 {
+			hash = hash[:7]
+		}
+		return "HEAD detached at " + hash, nil
+	}
+	return "On branch " + strings.TrimPrefix(ref, BRANCH_PREFIX), nil
+}
+
+// resolveHEAD returns the commit HEAD points at, or io.EOF when
+// the current branch has no commits yet.
+func resolveHEAD(gitRoot string) (string, error) {
+	_, hash, err := readHEAD(gitRoot)
+	if err != nil {
+		return "", err
+	}
+	if hash == "" {
+		return "", io.EOF
+	}
+	return hash, nil
+}
+
+// checkRefName applies the main rules of git check-ref-format.
+func checkRefName(name string) error {
+	if name == "" || name == "HEAD" || strings.HasPrefix(name, "-") ||
+		strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".") || strings.HasSuffix(name, ".lock") ||
+		strings.Contains(name, "..") || strings.Contains(name, "//") ||
+		strings.Contains(name, "@{") || strings.ContainsAny(name, " ~^:?*[\\\t\n") {
+		return fmt.Errorf("%w: '%s'", ERROR_INVALID_REF_NAME, name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return fmt.Errorf("%w: '%s'", ERROR_INVALID_REF_NAME, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,395 @@
+package snapshots
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var (
+	ERROR_AMBIGUOUS_REVISION = fmt.Errorf("ambiguous revision")
+	ERROR_UNKNOWN_REVISION   = fmt.Errorf("unknown revision or path not in the working tree")
+)
+
+var specialHeads = []string{"HEAD", "ORIG_HEAD", "MERGE_HEAD", "FETCH_HEAD", "CHERRY_PICK_HEAD"}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// resolveRefName looks a name up the way git does: special heads
+// first, then refs/<name>, refs/tags, refs/heads and refs/remotes.
+func resolveRefName(gitRoot, name string) (string, error) {
+	for _, head := range specialHeads {
+		if name != head {
+			continue
+		}
+		if name == "HEAD" {
+			return resolveHEAD(gitRoot)
+		}
+		return readRef(gitRoot, name)
+	}
+	candidates := []string{
+		"refs/" + name,
+		TAG_PREFIX + name,
+		BRANCH_PREFIX + name,
+		"refs/remotes/" + name,
+		"refs/remotes/" + name + "/HEAD",
+	}
+	if strings.HasPrefix(name, "refs/") {
+		candidates = append([]string{name}, candidates...)
+	}
+	for _, ref := range candidates {
+		hash, err := readRef(gitRoot, ref)
+		if err == nil {
+			return hash, nil
+		}
+		if err != ERROR_REF_NOT_FOUND {
+			return "", err
+		}
+	}
+	return "", ERROR_REF_NOT_FOUND
+}
+
+// resolveName turns the base of a revision (before any ~, ^ or :)
+// into an object hash.
+func resolveName(gitRoot string, store ObjectStore, name string) (string, error) {
+	if len(name) == 40 && isHex(name) {
+		return name, nil
+	}
+	hash, err := resolveRefName(gitRoot, name)
+	if err == nil {
+		return hash, nil
+	}
+	if err != ERROR_REF_NOT_FOUND {
+		if name == "HEAD" {
+			return "", fmt.Errorf("%w: '%s'", ERROR_UNKNOWN_REVISION, name)
+		}
+		return "", err
+	}
+
+	if len(name) >= 4 && isHex(name) {
+		matches, err := findObjects(store, name)
+		if err != nil {
+			return "", err
+		}
+		if len(matches) == 1 {
+			return matches[0], nil
+		}
+		if len(matches) > 1 {
+			return "", fmt.Errorf("%w: short object ID %s is ambiguous", ERROR_AMBIGUOUS_REVISION, name)
+		}
+	}
+	return "", fmt.Errorf("%w: '%s'", ERROR_UNKNOWN_REVISION, name)
+}
+
+// peel follows tags (and commits, for trees) until it reaches an
+// object of type want. An empty want peels tags only.
+func peel(store ObjectStore, hash string, want ContentType) (string, error) {
+	for {
+		objType, content, err := store.Read(hash)
+		if err != nil {
+			return "", err
+		}
+		if objType == want || (want == "" && objType != TagType) {
+			return hash, nil
+		}
+		switch objType {
+		case TagType:
+			target := ""
+			for _, line := range strings.Split(string(content), "\n") {
+				if value, ok := strings.CutPrefix(line, "object "); ok {
+					target = value
+					break
+				}
+			}
+			if target == "" {
+				return "", fmt.Errorf("malformed tag %s", hash)
+			}
+			hash = target
+		case CommitType:
+			if want != Tree {
+				return "", fmt.Errorf("%s is a commit, not a %s", hash, want)
+			}
+			commit, err := parseCommit(content)
+			if err != nil {
+				return "", err
+			}
+			hash = commit.tree
+		default:
+			return "", fmt.Errorf("%s is a %s, not a %s", hash, objType, want)
+		}
+	}
+}
+
+// lookupPath walks treeHash down to the entry at p.
+func lookupPath(store ObjectStore, treeHash, p string) (string, error) {
+	hash := treeHash
+	for _, part := range strings.Split(path.Clean(p), "/") {
+		if part == "." || part == "" {
+			continue
+		}
+		entries, err := readTree(store, hash)
+		if err != nil {
+			return "", fmt.Errorf("path '%s' does not exist", p)
+		}
+		found := false
+		for _, e := range entries {
+			if e.Name == part {
+				hash, found = e.Hash, true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("path '%s' does not exist", p)
+		}
+	}
+	return hash, nil
+}
+
+// nthAncestor applies rev~n, following first parents only.
+func nthAncestor(store ObjectStore, hash string, n int) (string, error) {
+	for ; n > 0; n-- {
+		commitHash, err := peel(store, hash, CommitType)
+		if err != nil {
+			return "", err
+		}
+		commit, err := readCommit(store, commitHash)
+		if err != nil {
+			return "", err
+		}
+		if len(commit.parents) == 0 {
+			return "", fmt.Errorf("%w: %s has no parent", ERROR_UNKNOWN_REVISION, commitHash[:7])
+		}
+		hash = commit.parents[0]
+	}
+	return hash, nil
+}
+
+// nthParent applies rev^n; rev^0 is the commit itself.
+func nthParent(store ObjectStore, hash string, n int) (string, error) {
+	commitHash, err := peel(store, hash, CommitType)
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return commitHash, nil
+	}
+	commit, err := readCommit(store, commitHash)
+	if err != nil {
+		return "", err
+	}
+	if n > len(commit.parents) {
+		return "", fmt.Errorf("%w: %s has no parent %d", ERROR_UNKNOWN_REVISION, commitHash[:7], n)
+	}
+	return commit.parents[n-1], nil
+}
+
+// readSuffixNumber parses the optional number following ~ or ^.
+func readSuffixNumber(s string) (int, string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == 0 {
+		return 1, s
+	}
+	n, _ := strconv.Atoi(s[:i])
+	return n, s[i:]
+}
+
+// ResolveRevision evaluates expressions like HEAD~2, main^2,
+// v1.0^{tree}, abc123:src/main.go or :path (the index entry).
+func ResolveRevision(gitRoot string, store ObjectStore, expr string) (string, error) {
+	if expr == "" {
+		return "", fmt.Errorf("%w: empty revision", ERROR_UNKNOWN_REVISION)
+	}
+
+	rev, filePath, hasPath := strings.Cut(expr, ":")
+	if hasPath && rev == "" {
+		staged := NewStaged()
+		staged.baseRoot = gitRoot
+		if err := staged.parseIndexFile(); err != nil {
+			return "", err
+		}
+		idx, ok := staged.indexMap[path.Clean(filePath)]
+		if !ok {
+			return "", fmt.Errorf("path '%s' is not in the index", filePath)
+		}
+		return staged.IndexLines[idx].BlobHash, nil
+	}
+
+	end := strings.IndexAny(rev, "~^")
+	if end == -1 {
+		end = len(rev)
+	}
+	hash, err := resolveName(gitRoot, store, rev[:end])
+	if err != nil {
+		return "", err
+	}
+
+	rest := rev[end:]
+	for rest != "" {
+		op := rest[0]
+		rest = rest[1:]
+		if op == '^' && strings.HasPrefix(rest, "{") {
+			close := strings.Index(rest, "}")
+			if close == -1 {
+				return "", fmt.Errorf("%w: '%s'", ERROR_UNKNOWN_REVISION, expr)
+			}
+			want := ContentType(rest[1:close])
+			rest = rest[close+1:]
+			switch want {
+			case "", CommitType, Tree, Blob, TagType:
+			case "object":
+				want = ""
+			default:
+				return "", fmt.Errorf("%w: '%s'", ERROR_UNKNOWN_REVISION, expr)
+			}
+			if hash, err = peel(store, hash, want); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		n, remaining := readSuffixNumber(rest)
+		rest = remaining
+		if op == '~' {
+			hash, err = nthAncestor(store, hash, n)
+		} else {
+			hash, err = nthParent(store, hash, n)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if hasPath {
+		treeHash, err := peel(store, hash, Tree)
+		if err != nil {
+			return "", err
+		}
+		return lookupPath(store, treeHash, filePath)
+	}
+	return hash, nil
+}
+
+// resolveCommitish resolves a revision and peels it to a commit.
+func resolveCommitish(gitRoot string, store ObjectStore, name string) (string, error) {
+	hash, err := ResolveRevision(gitRoot, store, name)
+	if err != nil {
+		return "", err
+	}
+	return peel(store, hash, CommitType)
+}
+
+// splitRange splits a "from..to" argument into its ends. An empty end
+// stands for HEAD.
+func splitRange(arg string) (string, string, bool) {
+	from, to, ok := strings.Cut(arg, "..")
+	if !ok || strings.HasPrefix(to, ".") {
+		return "", "", false
+	}
+	if from == "" {
+		from = "HEAD"
+	}
+	if to == "" {
+		to = "HEAD"
+	}
+	return from, to, true
+}
+
+// isCommitRange reports whether arg is a "from..to" range whose ends
+// both name commits, rather than a path such as "../file".
+func isCommitRange(gitRoot string, store ObjectStore, arg string) bool {
+	from, to, ok := splitRange(arg)
+	if !ok {
+		return false
+	}
+	if _, err := resolveCommitish(gitRoot, store, from); err != nil {
+		return false
+	}
+	_, err := resolveCommitish(gitRoot, store, to)
+	return err == nil
+}
+
+func HandleRevParseCommand() error {
+	path, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	gitRoot, ok, err := CheckGitFolderExists(path)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ERROR_OUTSIDE_GIT
+	}
+	store := NewObjectStore(gitRoot)
+
+	short := 0
+	abbrevRef := false
+	verify := false
+	var revs []string
+	for _, arg := range os.Args[2:] {
+		switch {
+		case arg == "--short":
+			short = 7
+		case strings.HasPrefix(arg, "--short="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--short="))
+			if err != nil || n < 4 || n > 40 {
+				return fmt.Errorf("invalid --short value: %s", arg)
+			}
+			short = n
+		case arg == "--abbrev-ref":
+			abbrevRef = true
+		case arg == "--verify":
+			verify = true
+		case arg == "--show-toplevel":
+			fmt.Println(gitRoot)
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("unknown option: %s", arg)
+		default:
+			revs = append(revs, arg)
+		}
+	}
+	if verify && len(revs) != 1 {
+		return fmt.Errorf("needed a single revision")
+	}
+
+	for _, rev := range revs {
+		if abbrevRef && rev == "HEAD" {
+			branch, ok, err := CurrentBranch(gitRoot)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				branch = "HEAD"
+			}
+			fmt.Println(branch)
+			continue
+		}
+		if abbrevRef {
+			if _, err := readRef(gitRoot, BRANCH_PREFIX+rev); err == nil {
+				fmt.Println(rev)
+				continue
+			}
+		}
+		hash, err := ResolveRevision(gitRoot, store, rev)
+		if err != nil {
+			return err
+		}
+		if short > 0 {
+			hash = hash[:short]
+		}
+		fmt.Println(hash)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package snapshots
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveRevisionAbbreviatedHash(t *testing.T) {
+	gitRoot := t.TempDir()
+	store := NewMemoryStore()
+
+	// write blobs until two share a 4 character prefix
+	byPrefix := make(map[string]string)
+	var ambiguous string
+	for i := 0; ambiguous == ""; i++ {
+		hash, _ := store.Write(Blob, []byte(fmt.Sprintf("blob %d\n", i)))
+		if _, ok := byPrefix[hash[:4]]; ok {
+			ambiguous = hash[:4]
+		}
+		byPrefix[hash[:4]] = hash
+	}
+
+	_, err := ResolveRevision(gitRoot, store, ambiguous)
+	assert.ErrorIs(t, err, ERROR_AMBIGUOUS_REVISION)
+
+	hash, _ := store.Write(Blob, []byte("unique\n"))
+	got, err := ResolveRevision(gitRoot, store, hash[:10])
+	assert.NoError(t, err)
+	assert.Equal(t, hash, got)
+
+	_, err = ResolveRevision(gitRoot, store, "nothing")
+	assert.ErrorIs(t, err, ERROR_UNKNOWN_REVISION)
+}
+
+func TestResolveRevisionAncestry(t *testing.T) {
+	gitRoot := t.TempDir()
+	store := NewMemoryStore()
+	blob, _ := store.Write(Blob, []byte("content\n"))
+	tree, _ := writeTreeObject(store, []CommitTree{{fileMode: "100644", contentType: Blob, Name: "f", Hash: blob}})
+
+	first, _ := writeCommit(store, &Commit{tree: tree, message: "first"})
+	second, _ := writeCommit(store, &Commit{tree: tree, parents: []string{first}, message: "second"})
+
+	got, err := ResolveRevision(gitRoot, store, second+"~1")
+	assert.NoError(t, err)
+	assert.Equal(t, first, got)
+
+	got, err = ResolveRevision(gitRoot, store, second+"^{tree}")
+	assert.NoError(t, err)
+	assert.Equal(t, tree, got)
+
+	got, err = ResolveRevision(gitRoot, store, second+":f")
+	assert.NoError(t, err)
+	assert.Equal(t, blob, got)
+
+	_, err = ResolveRevision(gitRoot, store, first+"^")
+	assert.ErrorIs(t, err, ERROR_UNKNOWN_REVISION)
+
+	tag, _ := store.Write(TagType, []byte("object "+second+"\ntype commit\ntag v1\n\nfirst release\n"))
+	got, err = ResolveRevision(gitRoot, store, tag+"^{tag}")
+	assert.NoError(t, err)
+	assert.Equal(t, tag, got)
+	got, err = ResolveRevision(gitRoot, store, tag+"^{}")
+	assert.NoError(t, err)
+	assert.Equal(t, second, got)
+	_, err = ResolveRevision(gitRoot, store, second+"^{tag}")
+	assert.Error(t, err)
+}
+
+func TestIsRevisionArg(t *testing.T) {
+	gitRoot := newStatusRepo(t)
+	store := NewMemoryStore()
+	hashes := make(map[string]string)
+	writeTestCommit(t, store, hashes, "first", 1)
+	assert.NoError(t, writeRef(gitRoot, BRANCH_PREFIX+DEFAULT_BRANCH, hashes["first"]))
+
+	for arg, want := range map[string]bool{
+		DEFAULT_BRANCH:                  true,
+		"^" + DEFAULT_BRANCH:            true,
+		DEFAULT_BRANCH + "..":           true,
+		".." + DEFAULT_BRANCH:           true,
+		"../other.c":                    false,
+		"src/../other.c":                false,
+		DEFAULT_BRANCH + "..nope":       false,
+		hashes["first"][:7] + "..HEAD~": false,
+	} {
+		assert.Equal(t, want, isRevisionArg(gitRoot, store, arg), arg)
+	}
+}
@@ -0,0 +1,555 @@
+package snapshots
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// WALK_SLOP is how many uninteresting commits a limited walk looks
+// at after the last interesting one, to cope with clock skew.
+const WALK_SLOP = 5
+
+// RevCommit is a commit met during a revision walk.
+type RevCommit struct {
+	Hash string
+	*Commit
+	Parents []*RevCommit // set once the commit is parsed
+
+	parsed        bool
+	seen          bool // queued for the walk
+	added         bool // parents queued
+	uninteresting bool // reachable from a hidden commit
+	bottom        bool // hidden by name, as in ^rev or rev..
+	treesame      bool // no change to the walk's paths
+	rewritten     bool // Parents skip commits the walk leaves out
+}
+
+// shownParents are the parents log prints: the rewritten ones for
+// --graph with paths, otherwise the commit's own.
+func (c *RevCommit) shownParents() []string {
+	if !c.rewritten {
+		return c.parents
+	}
+	hashes := make([]string, len(c.Parents))
+	for i, p := range c.Parents {
+		hashes[i] = p.Hash
+	}
+	return hashes
+}
+
+// Date is the committer time the walk orders commits by.
+func (c *RevCommit) Date() int64 {
+	return c.commiter.When.Unix()
+}
+
+// RevWalk lists the commits reachable from the pushed commits but not
+// from the hidden ones, newest committer date first, like git rev-list.
+type RevWalk struct {
+	store   ObjectStore
+	commits map[string]*RevCommit
+
+	TopoOrder   bool // parents only after all their children, lines kept together
+	DateOrder   bool // parents only after all their children, newest first otherwise
+	FirstParent bool // follow only the first parent of merges
+	MaxCount    int  // stop after this many commits; negative for no limit
+
+	// Paths limits the walk to commits changing them, simplifying
+	// history the way git does: a merge with a parent that has the
+	// same content at Paths is followed down that parent only.
+	Paths []string
+	// RewriteParents makes the parents of shown commits skip the
+	// commits Paths leaves out, so the graph can connect them.
+	RewriteParents bool
+
+	// Since ends each line of history at its first commit older than
+	// it, and Until skips the commits newer than it. Both go by the
+	// committer date and are unset when zero.
+	Since time.Time
+	Until time.Time
+	// Match, if set, picks the commits shown, as --author and --grep
+	// do. The walk still goes through the others.
+	Match func(c *RevCommit) bool
+
+	list     []*RevCommit // pending commits, newest first
+	limited  bool
+	prepared bool
+	count    int
+	trees    map[string]diffSide // tree hash to its files within Paths
+}
+
+func NewRevWalk(store ObjectStore) *RevWalk {
+	return &RevWalk{
+		store:    store,
+		commits:  make(map[string]*RevCommit),
+		MaxCount: -1,
+		trees:    make(map[string]diffSide),
+	}
+}
+
+// lookup returns the commit for hash, parsing it on first use.
+func (w *RevWalk) lookup(hash string) (*RevCommit, error) {
+	c, ok := w.commits[hash]
+	if !ok {
+		c = &RevCommit{Hash: hash}
+		w.commits[hash] = c
+	}
+	if c.parsed {
+		return c, nil
+	}
+	commit, err := readCommit(w.store, hash)
+	if err != nil {
+		return nil, err
+	}
+	c.Commit = commit
+	c.Parents = make([]*RevCommit, len(commit.parents))
+	for i, parent := range commit.parents {
+		p, ok := w.commits[parent]
+		if !ok {
+			p = &RevCommit{Hash: parent}
+			w.commits[parent] = p
+		}
+		c.Parents[i] = p
+	}
+	c.parsed = true
+	return c, nil
+}
+
+// Push starts the walk at the commit hash.
+func (w *RevWalk) Push(hash string) error {
+	return w.start(hash, false)
+}
+
+// Hide leaves out every commit reachable from hash, as ^hash does.
+func (w *RevWalk) Hide(hash string) error {
+	w.limited = true
+	return w.start(hash, true)
+}
+
+func (w *RevWalk) start(hash string, hide bool) error {
+	c, err := w.lookup(hash)
+	if err != nil {
+		return err
+	}
+	if hide {
+		c.uninteresting, c.bottom = true, true
+		markUninteresting(c)
+	}
+	if !c.seen {
+		c.seen = true
+		w.list = append(w.list, c)
+	}
+	return nil
+}
+
+// insertByDate queues c after every pending commit at least as new.
+func (w *RevWalk) insertByDate(c *RevCommit) {
+	i := sort.Search(len(w.list), func(i int) bool {
+		return w.list[i].Date() < c.Date()
+	})
+	w.list = append(w.list, nil)
+	copy(w.list[i+1:], w.list[i:])
+	w.list[i] = c
+}
+
+func (w *RevWalk) pop() *RevCommit {
+	if len(w.list) == 0 {
+		return nil
+	}
+	c := w.list[0]
+	w.list = w.list[1:]
+	return c
+}
+
+// interesting reports whether the walk shows c once it gets to it.
+// Commits that leave Paths alone are skipped, except for merges the
+// rewritten parents need to tie two lines of history together.
+func (w *RevWalk) interesting(c *RevCommit) bool {
+	if c.uninteresting {
+		return false
+	}
+	if w.tooNew(c) {
+		return false
+	}
+	if w.Match != nil && !w.Match(c) {
+		return false
+	}
+	if len(w.Paths) > 0 && c.treesame {
+		if !w.RewriteParents {
+			return false
+		}
+		n := 0
+		for _, p := range c.Parents {
+			if relevant(p) {
+				n++
+			}
+		}
+		return n >= 2
+	}
+	return true
+}
+
+// tooOld reports whether c is older than Since.
+func (w *RevWalk) tooOld(c *RevCommit) bool {
+	return !w.Since.IsZero() && c.Date() < w.Since.Unix()
+}
+
+// tooNew reports whether c is newer than Until.
+func (w *RevWalk) tooNew(c *RevCommit) bool {
+	return !w.Until.IsZero() && c.Date() > w.Until.Unix()
+}
+
+// relevant reports whether c counts when simplifying history: shown
+// commits do, and so do the commits hidden by name, where the
+// interesting history ends.
+func relevant(c *RevCommit) bool {
+	return !c.uninteresting || c.bottom
+}
+
+// pathFiles lists the files of a tree within Paths.
+func (w *RevWalk) pathFiles(treeHash string) (diffSide, error) {
+	if side, ok := w.trees[treeHash]; ok {
+		return side, nil
+	}
+	side, err := treeSide(w.store, treeHash)
+	if err != nil {
+		return nil, err
+	}
+	side = filterSide(side, w.Paths)
+	w.trees[treeHash] = side
+	return side, nil
+}
+
+// sameFiles reports whether two sets of files are identical.
+func sameFiles(a, b diffSide) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p, entry := range a {
+		if other, ok := b[p]; !ok || other.hash != entry.hash || other.mode != entry.mode {
+			return false
+		}
+	}
+	return true
+}
+
+// simplify marks c treesame when it changes nothing within Paths. A
+// merge with an interesting parent that has the same files is reduced
+// to that parent, so the walk leaves the other sides alone.
+func (w *RevWalk) simplify(c *RevCommit) error {
+	files, err := w.pathFiles(c.tree)
+	if err != nil {
+		return err
+	}
+	if len(c.Parents) == 0 {
+		c.treesame = len(files) == 0
+		return nil
+	}
+
+	relevantParents := 0
+	relevantChange, irrelevantChange := false, false
+	for i, parent := range c.Parents {
+		// with --first-parent, a side branch bringing in the whole
+		// change must not divert the walk
+		if i == 1 && w.FirstParent {
+			break
+		}
+		if relevant(parent) {
+			relevantParents++
+		}
+		p, err := w.lookup(parent.Hash)
+		if err != nil {
+			return err
+		}
+		parentFiles, err := w.pathFiles(p.tree)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !sameFiles(parentFiles, files) && !relevant(p):
+			irrelevantChange = true
+		case !sameFiles(parentFiles, files):
+			relevantChange = true
+		case relevant(p):
+			c.Parents = []*RevCommit{p}
+			c.treesame = true
+			return nil
+		}
+	}
+	// changes from hidden parents only count when there is no other
+	c.treesame = !relevantChange && (relevantParents > 0 || !irrelevantChange)
+	return nil
+}
+
+// onlyRelevantParent returns the parent a treesame commit stands for:
+// its first parent, or its only relevant one. It returns nil when
+// there is no single such parent.
+func (w *RevWalk) onlyRelevantParent(c *RevCommit) *RevCommit {
+	if w.FirstParent || len(c.Parents) == 1 {
+		return c.Parents[0]
+	}
+	var only *RevCommit
+	for _, p := range c.Parents {
+		if !relevant(p) {
+			continue
+		}
+		if only != nil {
+			return nil
+		}
+		only = p
+	}
+	return only
+}
+
+// rewriteParents replaces each parent of c by its nearest ancestor the
+// walk shows, dropping parents with none, as git does for --graph.
+func (w *RevWalk) rewriteParents(c *RevCommit) error {
+	var parents []*RevCommit
+	for _, p := range c.Parents {
+		for {
+			if !w.limited {
+				if err := w.processParents(p); err != nil {
+					return err
+				}
+			}
+			if p.uninteresting || !p.treesame {
+				break
+			}
+			if len(p.Parents) == 0 {
+				p = nil
+				break
+			}
+			next := w.onlyRelevantParent(p)
+			if next == nil {
+				break
+			}
+			p = next
+		}
+		if p != nil && !slices.Contains(parents, p) {
+			parents = append(parents, p)
+		}
+	}
+	c.Parents, c.rewritten = parents, true
+	return nil
+}
+
+// markUninteresting hides the known ancestry of c.
+func markUninteresting(c *RevCommit) {
+	pending := append([]*RevCommit(nil), c.Parents...)
+	for len(pending) > 0 {
+		p := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if p.uninteresting {
+			continue
+		}
+		p.uninteresting = true
+		pending = append(pending, p.Parents...)
+	}
+}
+
+// processParents queues the parents of c that were not queued yet.
+// Hidden commits pass that on to all their parents.
+func (w *RevWalk) processParents(c *RevCommit) error {
+	if c.added {
+		return nil
+	}
+	c.added = true
+	if c.uninteresting {
+		for _, parent := range c.Parents {
+			parent.uninteresting = true
+			p, err := w.lookup(parent.Hash)
+			if err != nil {
+				return err
+			}
+			markUninteresting(p)
+			if !p.seen {
+				p.seen = true
+				w.insertByDate(p)
+			}
+		}
+		return nil
+	}
+	if len(w.Paths) > 0 {
+		if err := w.simplify(c); err != nil {
+			return err
+		}
+	}
+	for _, parent := range c.Parents {
+		p, err := w.lookup(parent.Hash)
+		if err != nil {
+			return err
+		}
+		if !p.seen {
+			p.seen = true
+			w.insertByDate(p)
+		}
+		if w.FirstParent {
+			break
+		}
+	}
+	return nil
+}
+
+// stillInteresting decides whether a limited walk must go on, given
+// the date of the newest commit kept so far.
+func (w *RevWalk) stillInteresting(date int64, slop int) int {
+	if len(w.list) == 0 {
+		return 0
+	}
+	if date <= w.list[0].Date() {
+		return WALK_SLOP
+	}
+	for _, c := range w.list {
+		if !c.uninteresting {
+			return WALK_SLOP
+		}
+	}
+	return slop - 1
+}
+
+// limit walks everything up front, so commits that turn out to be
+// reachable from a hidden commit are dropped before anything is shown.
+func (w *RevWalk) limit() error {
+	var kept []*RevCommit
+	slop := WALK_SLOP
+	date := int64(1<<63 - 1)
+	for len(w.list) > 0 {
+		c := w.pop()
+		if w.tooOld(c) {
+			c.uninteresting = true
+		}
+		if err := w.processParents(c); err != nil {
+			return err
+		}
+		if c.uninteresting {
+			markUninteresting(c)
+			if slop = w.stillInteresting(date, slop); slop > 0 {
+				continue
+			}
+			break
+		}
+		if w.tooNew(c) {
+			continue
+		}
+		date = c.Date()
+		kept = append(kept, c)
+	}
+	w.list = kept
+	return nil
+}
+
+// sortTopo reorders the list so no parent comes before its children.
+// Tips keep their walk order and each line of history is finished
+// before the next one starts, as in git's --topo-order. With DateOrder
+// the newest commit whose children are all done goes next instead.
+func (w *RevWalk) sortTopo() {
+	indegree := make(map[*RevCommit]int, len(w.list))
+	for _, c := range w.list {
+		indegree[c] = 1
+	}
+	for _, c := range w.list {
+		for _, p := range c.Parents {
+			if indegree[p] > 0 {
+				indegree[p]++
+			}
+		}
+	}
+
+	// commits whose children are all sorted: a stack, or a queue
+	// ordered by date with DateOrder, ties going in the order the
+	// commits became ready
+	var stack []*RevCommit
+	ready := func(c *RevCommit) {
+		if !w.DateOrder {
+			stack = append(stack, c)
+			return
+		}
+		i := sort.Search(len(stack), func(i int) bool {
+			return stack[i].Date() >= c.Date()
+		})
+		stack = slices.Insert(stack, i, c)
+	}
+	for _, c := range w.list {
+		if indegree[c] == 1 {
+			ready(c)
+		}
+	}
+	if !w.DateOrder {
+		slices.Reverse(stack)
+	}
+
+	sorted := make([]*RevCommit, 0, len(w.list))
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, p := range c.Parents {
+			if indegree[p] == 0 {
+				continue
+			}
+			indegree[p]--
+			if indegree[p] == 1 {
+				ready(p)
+			}
+		}
+		indegree[c] = 0
+		sorted = append(sorted, c)
+	}
+	w.list = sorted
+}
+
+func (w *RevWalk) prepare() error {
+	w.prepared = true
+	sort.SliceStable(w.list, func(i, j int) bool {
+		return w.list[i].Date() > w.list[j].Date()
+	})
+	if w.TopoOrder || w.DateOrder {
+		w.limited = true
+	}
+	if !w.limited {
+		return nil
+	}
+	if err := w.limit(); err != nil {
+		return err
+	}
+	if w.TopoOrder || w.DateOrder {
+		w.sortTopo()
+	}
+	return nil
+}
+
+// Next returns the next commit of the walk, or nil when it is done.
+func (w *RevWalk) Next() (*RevCommit, error) {
+	if !w.prepared {
+		if err := w.prepare(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		if w.MaxCount >= 0 && w.count >= w.MaxCount {
+			return nil, nil
+		}
+		c := w.pop()
+		if c == nil {
+			return nil, nil
+		}
+		if !w.limited {
+			// the history behind a commit older than Since is left alone
+			if w.tooOld(c) {
+				continue
+			}
+			if err := w.processParents(c); err != nil {
+				return nil, err
+			}
+		}
+		if !w.interesting(c) {
+			continue
+		}
+		if len(w.Paths) > 0 && w.RewriteParents {
+			if err := w.rewriteParents(c); err != nil {
+				return nil, err
+			}
+		}
+		w.count++
+		return c, nil
+	}
+}
@@ -0,0 +1,197 @@
+package snapshots
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCommit writes a commit with an empty tree, named by its
+// message, and records its hash in hashes.
+func writeTestCommit(t *testing.T, store ObjectStore, hashes map[string]string, name string, date int64, parents ...string) {
+	tree, err := writeTreeObject(store, nil)
+	assert.NoError(t, err)
+	var parentHashes []string
+	for _, parent := range parents {
+		parentHashes = append(parentHashes, hashes[parent])
+	}
+	sig := Signature{Name: "A", Email: "a@example.com", When: time.Unix(date, 0).UTC()}
+	hash, err := writeCommit(store, &Commit{tree: tree, parents: parentHashes, author: sig, commiter: sig, message: name})
+	assert.NoError(t, err)
+	hashes[name] = hash
+}
+
+// writeHistory writes this graph, committer dates in brackets:
+//
+//	root(1) - a1(2) - a2(5) - m(6)
+//	      \                  /
+//	       b1(3) ----- b2(4)
+func writeHistory(t *testing.T, store ObjectStore) map[string]string {
+	hashes := make(map[string]string)
+	writeTestCommit(t, store, hashes, "root", 1)
+	writeTestCommit(t, store, hashes, "a1", 2, "root")
+	writeTestCommit(t, store, hashes, "b1", 3, "root")
+	writeTestCommit(t, store, hashes, "b2", 4, "b1")
+	writeTestCommit(t, store, hashes, "a2", 5, "a1")
+	writeTestCommit(t, store, hashes, "m", 6, "a2", "b2")
+	return hashes
+}
+
+func walkNames(t *testing.T, w *RevWalk, hashes map[string]string) []string {
+	names := make(map[string]string)
+	for name, hash := range hashes {
+		names[hash] = name
+	}
+	var got []string
+	for {
+		c, err := w.Next()
+		assert.NoError(t, err)
+		if c == nil {
+			return got
+		}
+		got = append(got, names[c.Hash])
+	}
+}
+
+func TestRevWalkOrdering(t *testing.T) {
+	store := NewMemoryStore()
+	hashes := writeHistory(t, store)
+
+	w := NewRevWalk(store)
+	assert.NoError(t, w.Push(hashes["m"]))
+	assert.Equal(t, []string{"m", "a2", "b2", "b1", "a1", "root"}, walkNames(t, w, hashes))
+
+	w = NewRevWalk(store)
+	w.TopoOrder = true
+	assert.NoError(t, w.Push(hashes["m"]))
+	assert.Equal(t, []string{"m", "b2", "b1", "a2", "a1", "root"}, walkNames(t, w, hashes))
+
+	w = NewRevWalk(store)
+	w.DateOrder = true
+	assert.NoError(t, w.Push(hashes["m"]))
+	assert.Equal(t, []string{"m", "a2", "b2", "b1", "a1", "root"}, walkNames(t, w, hashes))
+
+	w = NewRevWalk(store)
+	w.FirstParent = true
+	assert.NoError(t, w.Push(hashes["m"]))
+	assert.Equal(t, []string{"m", "a2", "a1", "root"}, walkNames(t, w, hashes))
+
+	w = NewRevWalk(store)
+	w.MaxCount = 2
+	assert.NoError(t, w.Push(hashes["m"]))
+	assert.Equal(t, []string{"m", "a2"}, walkNames(t, w, hashes))
+}
+
+func TestRevWalkHide(t *testing.T) {
+	store := NewMemoryStore()
+	hashes := writeHistory(t, store)
+
+	// a1..m
+	w := NewRevWalk(store)
+	assert.NoError(t, w.Hide(hashes["a1"]))
+	assert.NoError(t, w.Push(hashes["m"]))
+	assert.Equal(t, []string{"m", "a2", "b2", "b1"}, walkNames(t, w, hashes))
+
+	// b2 ^a2 only leaves the side branch
+	w = NewRevWalk(store)
+	assert.NoError(t, w.Push(hashes["b2"]))
+	assert.NoError(t, w.Hide(hashes["a2"]))
+	assert.Equal(t, []string{"b2", "b1"}, walkNames(t, w, hashes))
+
+	// m..a2 is empty
+	w = NewRevWalk(store)
+	assert.NoError(t, w.Hide(hashes["m"]))
+	assert.NoError(t, w.Push(hashes["a2"]))
+	assert.Empty(t, walkNames(t, w, hashes))
+}
+
+func TestRevWalkDates(t *testing.T) {
+	store := NewMemoryStore()
+	hashes := writeHistory(t, store)
+
+	// a1 ends its line; root is reached through b1 and ends it too
+	w := NewRevWalk(store)
+	w.Since = time.Unix(3, 0)
+	assert.NoError(t, w.Push(hashes["m"]))
+	assert.Equal(t, []string{"m", "a2", "b2", "b1"}, walkNames(t, w, hashes))
+
+	w = NewRevWalk(store)
+	w.TopoOrder = true
+	w.Since = time.Unix(3, 0)
+	assert.NoError(t, w.Push(hashes["m"]))
+	assert.Equal(t, []string{"m", "b2", "b1", "a2"}, walkNames(t, w, hashes))
+
+	w = NewRevWalk(store)
+	w.Until = time.Unix(4, 0)
+	assert.NoError(t, w.Push(hashes["m"]))
+	assert.Equal(t, []string{"b2", "b1", "a1", "root"}, walkNames(t, w, hashes))
+
+	w = NewRevWalk(store)
+	w.Match = func(c *RevCommit) bool { return c.message[0] == 'b' }
+	w.MaxCount = 1
+	assert.NoError(t, w.Push(hashes["m"]))
+	assert.Equal(t, []string{"b2"}, walkNames(t, w, hashes))
+}
+
+// writeFilesCommit writes a commit whose tree holds files, mapping
+// names to contents.
+func writeFilesCommit(t *testing.T, store ObjectStore, hashes map[string]string, name string, date int64, files map[string]string, parents ...string) {
+	var entries []CommitTree
+	for file, content := range files {
+		blob, err := store.Write(Blob, []byte(content))
+		assert.NoError(t, err)
+		entries = append(entries, CommitTree{fileMode: "100644", contentType: Blob, Name: file, Hash: blob})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	tree, err := writeTreeObject(store, entries)
+	assert.NoError(t, err)
+	var parentHashes []string
+	for _, parent := range parents {
+		parentHashes = append(parentHashes, hashes[parent])
+	}
+	sig := Signature{Name: "A", Email: "a@example.com", When: time.Unix(date, 0).UTC()}
+	hash, err := writeCommit(store, &Commit{tree: tree, parents: parentHashes, author: sig, commiter: sig, message: name})
+	assert.NoError(t, err)
+	hashes[name] = hash
+}
+
+func TestRevWalkPaths(t *testing.T) {
+	store := NewMemoryStore()
+	hashes := make(map[string]string)
+	writeFilesCommit(t, store, hashes, "root", 1, map[string]string{"f": "1\n"})
+	writeFilesCommit(t, store, hashes, "a1", 2, map[string]string{"f": "1\n", "g": "1\n"}, "root")
+	writeFilesCommit(t, store, hashes, "b1", 3, map[string]string{"f": "2\n"}, "root")
+	writeFilesCommit(t, store, hashes, "a2", 4, map[string]string{"f": "3\n", "g": "1\n"}, "a1")
+	// m takes f from b1, so the walk follows b1 alone
+	writeFilesCommit(t, store, hashes, "m", 5, map[string]string{"f": "2\n", "g": "1\n"}, "a2", "b1")
+
+	w := NewRevWalk(store)
+	w.Paths = []string{"f"}
+	assert.NoError(t, w.Push(hashes["m"]))
+	assert.Equal(t, []string{"b1", "root"}, walkNames(t, w, hashes))
+
+	w = NewRevWalk(store)
+	w.Paths = []string{"g"}
+	assert.NoError(t, w.Push(hashes["m"]))
+	assert.Equal(t, []string{"a1"}, walkNames(t, w, hashes))
+
+	// the first parent line changes f in a2
+	w = NewRevWalk(store)
+	w.Paths = []string{"f"}
+	w.FirstParent = true
+	assert.NoError(t, w.Push(hashes["m"]))
+	assert.Equal(t, []string{"m", "a2", "root"}, walkNames(t, w, hashes))
+
+	// rewritten parents skip a1, which leaves f alone
+	w = NewRevWalk(store)
+	w.Paths = []string{"f"}
+	w.RewriteParents = true
+	w.TopoOrder = true
+	assert.NoError(t, w.Push(hashes["a2"]))
+	c, err := w.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, hashes["a2"], c.Hash)
+	assert.Equal(t, []string{hashes["root"]}, c.shownParents())
+}
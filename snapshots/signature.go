@@ -0,0 +1,67 @@
+package snapshots
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature is the "Name <email> timestamp zone" part of
+// the author and committer lines of a commit.
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+func parseTimezone(zone string) (*time.Location, error) {
+	if len(zone) != 5 || (zone[0] != '+' && zone[0] != '-') {
+		return nil, fmt.Errorf("invalid timezone %q", zone)
+	}
+	hours, err := strconv.Atoi(zone[1:3])
+	if err != nil {
+		return nil, err
+	}
+	minutes, err := strconv.Atoi(zone[3:5])
+	if err != nil {
+		return nil, err
+	}
+	offset := hours*3600 + minutes*60
+	if zone[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone(zone, offset), nil
+}
+
+func parseSignature(line string) (Signature, error) {
+	lt := strings.Index(line, "<")
+	gt := strings.LastIndex(line, ">")
+	if lt == -1 || gt == -1 || gt < lt {
+		return Signature{}, ERROR_MALFORMED_COMMIT_FORMAT
+	}
+	sig := Signature{
+		Name:  strings.TrimSpace(line[:lt]),
+		Email: line[lt+1 : gt],
+	}
+
+	parts := strings.Fields(line[gt+1:])
+	if len(parts) != 2 {
+		return Signature{}, ERROR_MALFORMED_COMMIT_FORMAT
+	}
+	seconds, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Signature{}, ERROR_MALFORMED_COMMIT_FORMAT
+	}
+	loc, err := parseTimezone(parts[1])
+	if err != nil {
+		return Signature{}, ERROR_MALFORMED_COMMIT_FORMAT
+	}
+	sig.When = time.Unix(seconds, 0).In(loc)
+	return sig, nil
+}
+
+// String formats the signature the way it is stored in a commit.
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s> %d %s", s.Name, s.Email, s.When.Unix(), s.When.Format("-0700"))
+}
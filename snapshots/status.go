@@ -1,101 +1,202 @@
 package snapshots
 
 import (
-	"bufio"
 	"fmt"
-	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/bibektamang7/own-git/ignore"
+	"github.com/bibektamang7/own-git/index"
+)
+
+// ChangeKind is one column of a status entry, using the letters of
+// git's short format.
+type ChangeKind byte
+
+const (
+	Unmodified  ChangeKind = ' '
+	Added       ChangeKind = 'A'
+	Modified    ChangeKind = 'M'
+	Deleted     ChangeKind = 'D'
+	TypeChanged ChangeKind = 'T'
+	Renamed     ChangeKind = 'R'
+	Unmerged    ChangeKind = 'U'
 )
 
+// emptyBlobHash is never paired up as a rename: every empty file has it.
+const emptyBlobHash = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+
+// FileStatus is the state of one tracked path. Staged (X) compares HEAD
+// with the index and Unstaged (Y) compares the index with the working
+// tree. Unmerged paths use the XY pairs of git (UU, AA, DU, ...).
+type FileStatus struct {
+	Path     string
+	OrigPath string // rename source when Staged is Renamed
+	Staged   ChangeKind
+	Unstaged ChangeKind
+	Score    int // rename similarity in percent
+
+	HeadMode     uint32
+	IndexMode    uint32
+	WorktreeMode uint32
+	HeadHash     string
+	IndexHash    string
+
+	// conflict sides of an unmerged path: base, ours and theirs
+	StageModes  [3]uint32
+	StageHashes [3]string
+}
+
+func (f *FileStatus) IsUnmerged() bool {
+	return f.Staged == Unmerged || f.Unstaged == Unmerged ||
+		(f.Staged == Added && f.Unstaged == Added) ||
+		(f.Staged == Deleted && f.Unstaged == Deleted)
+}
+
 type Status struct {
-	IndexMap       map[string]IndexLine
+	Branch    string // current branch, "" when HEAD is detached
+	HeadHash  string // "" before the first commit
+	Merging   bool   // MERGE_HEAD exists
+	Files     []FileStatus
+	Untracked []string
+	Ignored   []string // ignored directories end with "/"
+
+	IndexMap       map[string]IndexLine // stage 0 entries
+	unmerged       map[string][]IndexLine
+	indexLines     []IndexLine
+	indexVersion   uint32
+	indexTimestamp time.Time
+	refreshed      bool // cached stat data changed and should be written back
+	worktree       map[string]ChangeKind
+	worktreeModes  map[string]uint32
 	seen           map[string]bool
 	baseRoot       string
-	UntractedFiles []string
-	ModifiedFiles  []string
-	StagedFiles    []string // git compares previous commit i.e HEAD
-	DeletedFiles   []string
+	excludes       *ignore.Matcher
 }
 
 func NewStatus() *Status {
 	return &Status{
-		UntractedFiles: []string{},
-		ModifiedFiles:  []string{},
-		StagedFiles:    []string{},
-		DeletedFiles:   []string{},
-		IndexMap:       make(map[string]IndexLine),
-		seen:           make(map[string]bool),
-		baseRoot:       "",
+		Files:         []FileStatus{},
+		Untracked:     []string{},
+		Ignored:       []string{},
+		IndexMap:      make(map[string]IndexLine),
+		unmerged:      make(map[string][]IndexLine),
+		worktree:      make(map[string]ChangeKind),
+		worktreeModes: make(map[string]uint32),
+		seen:          make(map[string]bool),
+		baseRoot:      "",
 	}
 }
 
+// splitIndex separates the stage 0 entries of an index, keyed by path,
+// from the entries of unmerged paths.
+func splitIndex(lines []IndexLine) (map[string]IndexLine, map[string][]IndexLine) {
+	merged := make(map[string]IndexLine, len(lines))
+	unmerged := make(map[string][]IndexLine)
+	for _, line := range lines {
+		if line.Stage == 0 {
+			merged[line.Fullpath] = line
+		} else {
+			unmerged[line.Fullpath] = append(unmerged[line.Fullpath], line)
+		}
+	}
+	return merged, unmerged
+}
+
 func (s *Status) parseIndexFile() error {
-	path := s.baseRoot + ROOTDIR + "index"
-	f, err := os.Open(path)
+	lines, idx, err := readIndex(s.baseRoot)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
 		return err
 	}
-	defer f.Close()
+	s.indexLines = lines
+	s.indexVersion = idx.Version
+	s.indexTimestamp = idx.Timestamp
+	s.IndexMap, s.unmerged = splitIndex(lines)
+	return nil
+}
 
-	reader := bufio.NewReader(f)
+// modeType strips the permission bits, leaving file, symlink or gitlink.
+func modeType(mode uint32) uint32 {
+	return mode & 0170000
+}
 
-	for {
-		line, err := reader.ReadString('\n')
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
+// worktreeChange compares the worktree file at path with its index
+// entry. Stat data decides when it can; otherwise the content is
+// hashed, and a file whose content turns out unchanged gets its
+// cached stat data refreshed.
+func (s *Status) worktreeChange(path string, info os.FileInfo, line IndexLine) (ChangeKind, error) {
+	if line.statClean(info, s.indexTimestamp) {
+		return Unmodified, nil
+	}
+	mode := getGitMode(info.Mode())
+	if modeType(mode) != modeType(line.FileMode) {
+		return TypeChanged, nil
+	}
+	if mode != line.FileMode {
+		return Modified, nil
+	}
+	hash, err := hashWorktreeFile(path, info)
+	if err != nil {
+		return Unmodified, err
+	}
+	if hash != line.BlobHash {
+		return Modified, nil
+	}
+	line.Stat = index.StatFromFileInfo(info)
+	s.IndexMap[line.Fullpath] = line
+	s.refreshed = true
+	return Unmodified, nil
+}
 
-		line = strings.TrimSpace(line)
-		parts := strings.SplitN(line, "\t", 5)
-		if len(parts) != 5 {
-			return fmt.Errorf("corrupt index line: %q", line)
+// writeRefreshedIndex stores the refreshed stat cache. Like git it is
+// best effort: status still succeeds when the index is locked.
+func (s *Status) writeRefreshedIndex() {
+	if !s.refreshed {
+		return
+	}
+	lines := make([]IndexLine, len(s.indexLines))
+	for i, line := range s.indexLines {
+		if line.Stage == 0 {
+			line = s.IndexMap[line.Fullpath]
 		}
+		lines[i] = line
+	}
+	if err := writeIndexFile(indexFilePath(s.baseRoot), s.indexVersion, lines); err != nil {
+		slog.Debug("could not refresh index", "err", err)
+	}
+}
 
-		mode, err := strconv.ParseUint(parts[2], 8, 32)
-		if err != nil {
-			return err
-		}
-		size, err := strconv.ParseInt(parts[3], 10, 64)
-		if err != nil {
-			return err
-		}
-		ts, err := strconv.ParseInt(parts[4], 10, 64)
+func (s *Status) visitWorkingDirFiles(repoRoot string) error {
+	dirs := trackedDirs(trackedDirs(nil, s.IndexMap), s.unmerged)
+	return filepath.WalkDir(repoRoot, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		idx := IndexLine{
-			Fullpath:   parts[0],
-			BlobHash:   parts[1],
-			FileMode:   uint32(mode),
-			FileSize:   size,
-			TimeStamps: ts,
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == ".owngit") {
+			return filepath.SkipDir
 		}
 
-		s.IndexMap[idx.Fullpath] = idx
-	}
-
-	return nil
-}
-
-func (s *Status) visitWorkingDirFiles(repoRoot string) error {
-	return filepath.WalkDir(repoRoot, func(path string, d os.DirEntry, err error) error {
+		rel, err := filepath.Rel(s.baseRoot, path)
 		if err != nil {
 			return err
 		}
+		rel = filepath.ToSlash(rel)
 
 		if d.IsDir() {
-			if d.Name() == ".git" || d.Name() == ".owngit" {
-				return filepath.SkipDir
+			if rel != "." && !dirs[rel] {
+				ignored, err := s.isIgnored(rel, true)
+				if err != nil {
+					return err
+				}
+				if ignored {
+					s.Ignored = append(s.Ignored, rel+"/")
+					return filepath.SkipDir
+				}
 			}
 			return nil
 		}
@@ -105,104 +206,425 @@ func (s *Status) visitWorkingDirFiles(repoRoot string) error {
 			return err
 		}
 
-		rel, err := filepath.Rel(s.baseRoot, path)
-		if err != nil {
-			return err
-		}
-
 		s.seen[rel] = true
+		if _, ok := s.unmerged[rel]; ok {
+			s.worktreeModes[rel] = getGitMode(info.Mode())
+			return nil
+		}
 
 		if idxLine, ok := s.IndexMap[rel]; ok {
-
-			if idxLine.FileSize != info.Size() ||
-				idxLine.TimeStamps != info.ModTime().UnixNano() {
-				s.ModifiedFiles = append(s.ModifiedFiles, idxLine.Fullpath)
+			change, err := s.worktreeChange(path, info, idxLine)
+			if err != nil {
+				return err
 			}
+			s.worktree[rel] = change
+			s.worktreeModes[rel] = getGitMode(info.Mode())
 			return nil
 		}
 
 		// New file
-		s.UntractedFiles = append(s.UntractedFiles, rel)
+		ignored, err := s.isIgnored(rel, false)
+		if err != nil {
+			return err
+		}
+		if ignored {
+			s.Ignored = append(s.Ignored, rel)
+			return nil
+		}
+		s.Untracked = append(s.Untracked, rel)
 		return nil
 	})
 }
 
+func (s *Status) isIgnored(rel string, isDir bool) (bool, error) {
+	if s.excludes == nil {
+		return false, nil
+	}
+	return s.excludes.IsIgnored(rel, isDir)
+}
+
 func (s *Status) deletedFiles() {
-	for k, _ := range s.IndexMap {
+	for k := range s.IndexMap {
 		if _, ok := s.seen[k]; !ok {
-			s.DeletedFiles = append(s.DeletedFiles, k)
+			s.worktree[k] = Deleted
 		}
 	}
 }
 
-func HandleStatusCommand() error {
-	path, err := os.Getwd()
-	if err != nil {
-		return err
+// compareHeadToIndex returns the staged change of every path whose
+// HEAD and index versions differ. A deleted and an added path with the
+// same content are reported as one exact rename.
+func compareHeadToIndex(head TreePaths, indexMap map[string]IndexLine) map[string]FileStatus {
+	changes := make(map[string]FileStatus)
+	for p, line := range indexMap {
+		headHash, ok := head.TreePaths[p]
+		change := FileStatus{
+			Path:      p,
+			Staged:    Added,
+			IndexMode: line.FileMode,
+			IndexHash: line.BlobHash,
+		}
+		if ok {
+			change.HeadMode, change.HeadHash = head.FileModes[p], headHash
+			switch {
+			case modeType(change.HeadMode) != modeType(line.FileMode):
+				change.Staged = TypeChanged
+			case headHash != line.BlobHash || change.HeadMode != line.FileMode:
+				change.Staged = Modified
+			default:
+				continue
+			}
+		}
+		changes[p] = change
 	}
-	fullpath, ok, err := CheckGitFolderExists(path)
+
+	var deleted, added []string
+	for p, hash := range head.TreePaths {
+		if _, ok := indexMap[p]; !ok {
+			changes[p] = FileStatus{Path: p, Staged: Deleted, HeadMode: head.FileModes[p], HeadHash: hash}
+			deleted = append(deleted, p)
+		}
+	}
+	for p, change := range changes {
+		if change.Staged == Added {
+			added = append(added, p)
+		}
+	}
+	sort.Strings(deleted)
+	sort.Strings(added)
+
+	for _, from := range deleted {
+		source := changes[from]
+		if source.HeadHash == emptyBlobHash {
+			continue
+		}
+		for i, to := range added {
+			target := changes[to]
+			if target.IndexHash != source.HeadHash || modeType(target.IndexMode) != modeType(source.HeadMode) {
+				continue
+			}
+			target.Staged = Renamed
+			target.OrigPath = from
+			target.Score = 100
+			target.HeadMode, target.HeadHash = source.HeadMode, source.HeadHash
+			changes[to] = target
+			delete(changes, from)
+			added = append(added[:i], added[i+1:]...)
+			break
+		}
+	}
+	return changes
+}
+
+// conflictState returns the XY pair git shows for an unmerged path
+// from the stages present in the index.
+func conflictState(lines []IndexLine) FileStatus {
+	fs := FileStatus{Path: lines[0].Fullpath}
+	var present [3]bool
+	for _, line := range lines {
+		if line.Stage >= 1 && line.Stage <= 3 {
+			present[line.Stage-1] = true
+			fs.StageModes[line.Stage-1] = line.FileMode
+			fs.StageHashes[line.Stage-1] = line.BlobHash
+		}
+	}
+	base, ours, theirs := present[0], present[1], present[2]
+	switch {
+	case base && ours && theirs:
+		fs.Staged, fs.Unstaged = Unmerged, Unmerged
+	case !base && ours && theirs:
+		fs.Staged, fs.Unstaged = Added, Added
+	case base && ours:
+		fs.Staged, fs.Unstaged = Unmerged, Deleted
+	case base && theirs:
+		fs.Staged, fs.Unstaged = Deleted, Unmerged
+	case ours:
+		fs.Staged, fs.Unstaged = Added, Unmerged
+	case theirs:
+		fs.Staged, fs.Unstaged = Unmerged, Added
+	default:
+		fs.Staged, fs.Unstaged = Deleted, Deleted
+	}
+	return fs
+}
+
+// combine merges the staged and unstaged changes into s.Files.
+func (s *Status) combine(head TreePaths) {
+	changes := compareHeadToIndex(head, s.IndexMap)
+	for p := range s.unmerged {
+		// not a deletion: the path is only missing from stage 0
+		delete(changes, p)
+	}
+	for p, change := range s.worktree {
+		if change == Unmodified {
+			continue
+		}
+		fs, ok := changes[p]
+		if !ok {
+			line := s.IndexMap[p]
+			fs = FileStatus{
+				Path:      p,
+				Staged:    Unmodified,
+				HeadMode:  line.FileMode,
+				HeadHash:  line.BlobHash,
+				IndexMode: line.FileMode,
+				IndexHash: line.BlobHash,
+			}
+		}
+		fs.Unstaged = change
+		changes[p] = fs
+	}
+
+	s.Files = s.Files[:0]
+	for p, fs := range changes {
+		if fs.Unstaged == 0 {
+			fs.Unstaged = Unmodified
+		}
+		if fs.Unstaged != Deleted {
+			fs.WorktreeMode = s.worktreeModes[p]
+			if _, seen := s.worktreeModes[p]; !seen {
+				fs.WorktreeMode = fs.IndexMode
+			}
+		}
+		s.Files = append(s.Files, fs)
+	}
+	for _, lines := range s.unmerged {
+		fs := conflictState(lines)
+		fs.HeadMode, fs.HeadHash = head.FileModes[fs.Path], head.TreePaths[fs.Path]
+		fs.WorktreeMode = s.worktreeModes[fs.Path]
+		s.Files = append(s.Files, fs)
+	}
+	sort.Slice(s.Files, func(i, j int) bool {
+		return s.Files[i].Path < s.Files[j].Path
+	})
+	sort.Strings(s.Untracked)
+	sort.Strings(s.Ignored)
+}
+
+// HasStaged reports whether committing the index would record anything.
+func (s *Status) HasStaged() bool {
+	for _, fs := range s.Files {
+		if fs.Staged != Unmodified && !fs.IsUnmerged() {
+			return true
+		}
+	}
+	return false
+}
+
+// ComputeStatus compares HEAD, the index and the working tree of the
+// repository at gitRoot.
+func ComputeStatus(gitRoot string) (*Status, error) {
+	s := NewStatus()
+	s.baseRoot = gitRoot
+
+	ref, headHash, err := readHEAD(gitRoot)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if !ok {
-		return fmt.Errorf("couldn't found .owngit folder")
+	if ref != "" {
+		s.Branch = strings.TrimPrefix(ref, BRANCH_PREFIX)
 	}
+	s.HeadHash = headHash
+	s.Merging = mergeInProgress(gitRoot)
 
-	status := NewStatus()
-	status.baseRoot = fullpath
-	if err := status.parseIndexFile(); err != nil {
-		return err
+	if s.excludes, err = newIgnoreMatcher(gitRoot); err != nil {
+		return nil, err
 	}
-	if err := status.visitWorkingDirFiles(fullpath); err != nil {
-		return err
+	if err := s.parseIndexFile(); err != nil {
+		return nil, err
 	}
-	status.deletedFiles()
-	treePaths, err := ParseHeadAndCommitFile(fullpath)
-	if err != io.EOF && err != nil {
-		return err
+	if err := s.visitWorkingDirFiles(gitRoot); err != nil {
+		return nil, err
 	}
+	s.deletedFiles()
+	s.writeRefreshedIndex()
 
-	for k, _ := range status.IndexMap {
-		if _, ok := treePaths.TreePaths[k]; !ok {
-			status.StagedFiles = append(status.StagedFiles, k)
+	head := NewTreePaths()
+	if headHash != "" {
+		if head, err = ParseCommit(NewObjectStore(gitRoot), headHash); err != nil {
+			return nil, err
 		}
 	}
+	s.combine(head)
+	return s, nil
+}
+
+var stagedLabels = map[ChangeKind]string{
+	Added:       "new file:",
+	Modified:    "modified:",
+	Deleted:     "deleted:",
+	Renamed:     "renamed:",
+	TypeChanged: "typechange:",
+}
 
-	fmt.Println("On branch main")
+var unmergedLabels = map[string]string{
+	"DD": "both deleted:",
+	"AU": "added by us:",
+	"UD": "deleted by them:",
+	"UA": "added by them:",
+	"DU": "deleted by us:",
+	"AA": "both added:",
+	"UU": "both modified:",
+}
 
-	if len(status.ModifiedFiles) < 1 && len(status.StagedFiles) < 1 &&
-		len(status.UntractedFiles) < 1 && len(status.DeletedFiles) < 1 {
-		fmt.Println("nothing to commit, working tree clean")
-		return nil
+func printLongStatus(s *Status, showIgnored bool) {
+	if s.Branch != "" {
+		fmt.Println("On branch " + s.Branch)
+	} else {
+		fmt.Println("HEAD detached at " + shortHash(s.HeadHash))
 	}
-	if len(status.UntractedFiles) > 0 {
-		fmt.Println("Untracked files:")
-		fmt.Println("\t(use \"git add <file>...\" to include in what will be commited):")
-		for _, path := range status.UntractedFiles {
-			fmt.Printf("\t\t%s\n", path)
+	if s.HeadHash == "" {
+		fmt.Println("\nNo commits yet")
+	}
+
+	var staged, unmerged, unstaged []FileStatus
+	for _, fs := range s.Files {
+		switch {
+		case fs.IsUnmerged():
+			unmerged = append(unmerged, fs)
+		default:
+			if fs.Staged != Unmodified {
+				staged = append(staged, fs)
+			}
+			if fs.Unstaged != Unmodified {
+				unstaged = append(unstaged, fs)
+			}
 		}
 	}
 
-	if len(status.ModifiedFiles) > 0 {
-		fmt.Println("Modified files:")
-		for _, path := range status.ModifiedFiles {
-			fmt.Printf("\t\t%s\n", path)
+	if s.Merging {
+		if len(unmerged) > 0 {
+			fmt.Println("You have unmerged paths.")
+			fmt.Println("\t(fix conflicts and run \"git commit\")")
+			fmt.Println("\t(use \"git merge --abort\" to abort the merge)")
+		} else {
+			fmt.Println("All conflicts fixed but you are still merging.")
+			fmt.Println("\t(use \"git commit\" to conclude merge)")
+		}
+	}
+	if len(staged) > 0 {
+		fmt.Println("Changes to be committed:")
+		for _, fs := range staged {
+			name := fs.Path
+			if fs.Staged == Renamed {
+				name = fs.OrigPath + " -> " + fs.Path
+			}
+			fmt.Printf("\t\t%-12s%s\n", stagedLabels[fs.Staged], name)
+		}
+	}
+	if len(unmerged) > 0 {
+		fmt.Println("Unmerged paths:")
+		fmt.Println("\t(use \"git add <file>...\" to mark resolution)")
+		for _, fs := range unmerged {
+			fmt.Printf("\t\t%-17s%s\n", unmergedLabels[string([]byte{byte(fs.Staged), byte(fs.Unstaged)})], fs.Path)
 		}
 	}
-	if len(status.DeletedFiles) > 0 {
-		fmt.Println("Deleted files:")
-		for _, path := range status.DeletedFiles {
+	if len(unstaged) > 0 {
+		fmt.Println("Changes not staged for commit:")
+		fmt.Println("\t(use \"git add <file>...\" to update what will be committed)")
+		for _, fs := range unstaged {
+			fmt.Printf("\t\t%-12s%s\n", stagedLabels[fs.Unstaged], fs.Path)
+		}
+	}
+	if len(s.Untracked) > 0 {
+		fmt.Println("Untracked files:")
+		fmt.Println("\t(use \"git add <file>...\" to include in what will be commited):")
+		for _, path := range s.Untracked {
 			fmt.Printf("\t\t%s\n", path)
 		}
 	}
-	if len(status.StagedFiles) > 0 {
-		fmt.Println("changes to be committed:")
-		for _, path := range status.StagedFiles {
+	if showIgnored && len(s.Ignored) > 0 {
+		fmt.Println("Ignored files:")
+		fmt.Println("\t(use \"git add -f <file>...\" to include in what will be commited):")
+		for _, path := range s.Ignored {
 			fmt.Printf("\t\t%s\n", path)
 		}
-	} else if len(status.UntractedFiles) > 0 {
+	}
+
+	switch {
+	case len(staged) > 0 || len(unmerged) > 0:
+	case len(unstaged) > 0:
+		fmt.Println("no changes added to commit (use \"git add\")")
+	case len(s.Untracked) > 0:
 		fmt.Println("nothing added to commit but untracked files present (use \"git add\" to track)")
+	default:
+		fmt.Println("nothing to commit, working tree clean")
+	}
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
+func HandleStatusCommand() error {
+	opts := statusOptions{format: STATUS_LONG}
+	formatSet := false
+	var args []string
+	for _, arg := range os.Args[2:] {
+		// bundled short flags such as -sb
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' {
+			for _, c := range arg[1:] {
+				args = append(args, "-"+string(c))
+			}
+			continue
+		}
+		args = append(args, arg)
+	}
+	for _, arg := range args {
+		switch arg {
+		case "--ignored":
+			opts.showIgnored = true
+		case "-s", "--short":
+			opts.format, formatSet = STATUS_SHORT, true
+		case "--long":
+			opts.format, formatSet = STATUS_LONG, true
+		case "--porcelain", "--porcelain=v1":
+			opts.format, formatSet = STATUS_PORCELAIN, true
+		case "--porcelain=v2":
+			opts.format, formatSet = STATUS_PORCELAIN_2, true
+		case "-b", "--branch":
+			opts.branch = true
+		case "-z":
+			opts.nulTerm = true
+		default:
+			return fmt.Errorf("unknown option '%s'", arg)
+		}
+	}
+	if opts.nulTerm && !formatSet {
+		opts.format = STATUS_PORCELAIN
+	}
+	if opts.nulTerm && opts.format == STATUS_LONG {
+		return fmt.Errorf("-z is not supported with the long format")
+	}
+
+	path, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	fullpath, ok, err := CheckGitFolderExists(path)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("couldn't found .owngit folder")
+	}
+	if opts.prefix, err = filepath.Rel(fullpath, path); err != nil {
+		return err
 	}
 
+	status, err := ComputeStatus(fullpath)
+	if err != nil {
+		return err
+	}
+	switch opts.format {
+	case STATUS_SHORT, STATUS_PORCELAIN:
+		return printShortStatus(os.Stdout, status, opts)
+	case STATUS_PORCELAIN_2:
+		return printPorcelainV2(os.Stdout, status, opts)
+	}
+	printLongStatus(status, opts.showIgnored)
 	return nil
 }
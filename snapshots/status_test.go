@@ -1 +1,155 @@
 package snapshots
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newStatusRepo creates an empty repository with HEAD on main.
+func newStatusRepo(t *testing.T) string {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(root+ROOTDIR+"refs/heads", 0755))
+	assert.NoError(t, setHEAD(root, BRANCH_PREFIX+DEFAULT_BRANCH))
+	return root
+}
+
+// stageForStatus writes content to rel in a fresh repository and
+// stages it, returning the repository root.
+func stageForStatus(t *testing.T, rel, content string) string {
+	root := newStatusRepo(t)
+	path := filepath.Join(root, rel)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	info, err := os.Lstat(path)
+	assert.NoError(t, err)
+
+	line := newIndexLineFromInfo(rel, hashObject(Blob, []byte(content)), info)
+	assert.NoError(t, writeIndexFile(indexFilePath(root), 0, []IndexLine{line}))
+	return root
+}
+
+func statusOf(t *testing.T, root string) *Status {
+	status, err := ComputeStatus(root)
+	assert.NoError(t, err)
+	return status
+}
+
+func TestStatusIgnoresTouch(t *testing.T) {
+	root := stageForStatus(t, "f.txt", "hello\n")
+	later := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(root, "f.txt"), later, later))
+
+	status := statusOf(t, root)
+	assert.Equal(t, Unmodified, status.Files[0].Unstaged)
+
+	lines, _, err := readIndex(root)
+	assert.NoError(t, err)
+	assert.True(t, lines[0].Stat.MTime.Equal(later))
+}
+
+func TestStatusDetectsRacilyCleanEdit(t *testing.T) {
+	root := newStatusRepo(t)
+	path := filepath.Join(root, "f.txt")
+
+	// the file is edited within the same tick it was staged in, so the
+	// cached stat data matches although the content does not
+	assert.NoError(t, os.WriteFile(path, []byte("world\n"), 0644))
+	info, err := os.Lstat(path)
+	assert.NoError(t, err)
+	line := newIndexLineFromInfo("f.txt", hashObject(Blob, []byte("hello\n")), info)
+	assert.NoError(t, writeIndexFile(indexFilePath(root), 0, []IndexLine{line}))
+	assert.NoError(t, os.Chtimes(indexFilePath(root), info.ModTime(), info.ModTime()))
+
+	status := statusOf(t, root)
+	assert.Len(t, status.Files, 1)
+	assert.Equal(t, Modified, status.Files[0].Unstaged)
+}
+
+func TestStatusRefreshSmudgesRacyEntries(t *testing.T) {
+	root := stageForStatus(t, "f.txt", "hello\n")
+	path := filepath.Join(root, "f.txt")
+
+	// the touch makes status refresh the entry; its mtime is no earlier
+	// than the refreshed index, as for a file written in that second
+	later := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(path, later, later))
+	status := statusOf(t, root)
+	assert.Equal(t, Unmodified, status.Files[0].Unstaged)
+
+	lines, _, err := readIndex(root)
+	assert.NoError(t, err)
+	assert.True(t, lines[0].Stat.MTime.Equal(later))
+	assert.Equal(t, uint32(0), lines[0].Stat.Size)
+
+	// an edit of the same size within that second, after which the
+	// index gets rewritten and no longer looks racy
+	assert.NoError(t, os.WriteFile(path, []byte("world\n"), 0644))
+	assert.NoError(t, os.Chtimes(path, later, later))
+	newer := later.Add(time.Hour)
+	assert.NoError(t, os.Chtimes(indexFilePath(root), newer, newer))
+
+	status = statusOf(t, root)
+	assert.Equal(t, Modified, status.Files[0].Unstaged)
+}
+
+func TestStatusThreeWay(t *testing.T) {
+	root := newStatusRepo(t)
+	store := NewObjectStore(root)
+
+	write := func(rel, content string) IndexLine {
+		path := filepath.Join(root, rel)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		info, err := os.Lstat(path)
+		assert.NoError(t, err)
+		hash, err := store.Write(Blob, []byte(content))
+		assert.NoError(t, err)
+		return newIndexLineFromInfo(rel, hash, info)
+	}
+
+	// HEAD has keep, edit, gone and old
+	head := []IndexLine{write("keep", "keep\n"), write("edit", "v1\n"), write("gone", "gone\n"), write("old", "moved\n")}
+	tree, err := buildTreesFromIndex(store, head)
+	assert.NoError(t, err)
+	commit, err := writeCommit(store, &Commit{tree: tree, message: "base"})
+	assert.NoError(t, err)
+	assert.NoError(t, writeRef(root, BRANCH_PREFIX+DEFAULT_BRANCH, commit))
+
+	// stage an edit, a deletion, a rename and a new file, then edit
+	// keep in the worktree only
+	assert.NoError(t, os.Remove(filepath.Join(root, "gone")))
+	assert.NoError(t, os.Rename(filepath.Join(root, "old"), filepath.Join(root, "new")))
+	newInfo, err := os.Lstat(filepath.Join(root, "new"))
+	assert.NoError(t, err)
+	index := []IndexLine{
+		head[0],
+		write("edit", "v2\n"),
+		newIndexLineFromInfo("new", head[3].BlobHash, newInfo),
+		write("added", "added\n"),
+	}
+	assert.NoError(t, writeIndexFile(indexFilePath(root), 0, index))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "keep"), []byte("changed\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "untracked"), []byte("u\n"), 0644))
+
+	status := statusOf(t, root)
+	got := make(map[string]string)
+	for _, fs := range status.Files {
+		got[fs.Path] = string([]byte{byte(fs.Staged), byte(fs.Unstaged)})
+	}
+	assert.Equal(t, map[string]string{
+		"added": "A ",
+		"edit":  "M ",
+		"gone":  "D ",
+		"keep":  " M",
+		"new":   "R ",
+	}, got)
+	assert.Equal(t, []string{"untracked"}, status.Untracked)
+	assert.True(t, status.HasStaged())
+	for _, fs := range status.Files {
+		if fs.Path == "new" {
+			assert.Equal(t, "old", fs.OrigPath)
+		}
+	}
+}
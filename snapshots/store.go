@@ -0,0 +1,265 @@
+package snapshots
+
+import (
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ERROR_OBJECT_NOT_FOUND = fmt.Errorf("object not found")
+
+// ObjectStore is where every object is read from and written to.
+// Commands never build object paths by hand, so they run the same
+// against the on-disk repository and the in-memory store used in tests.
+type ObjectStore interface {
+	Has(hash string) bool
+	Read(hash string) (ContentType, []byte, error)
+	Write(objType ContentType, content []byte) (string, error)
+	Stream(hash string) (ContentType, int64, io.ReadCloser, error)
+	// WriteStream stores exactly size bytes read from r, hashing
+	// them on the way so large files never sit in memory.
+	WriteStream(objType ContentType, size int64, r io.Reader) (string, error)
+}
+
+// NewObjectStore returns the store backing the repository at gitRoot:
+// new objects are written loose, reads fall back to the packs.
+func NewObjectStore(gitRoot string) ObjectStore {
+	return &repoStore{
+		loose: NewLooseStore(gitRoot),
+		packs: NewPackStore(gitRoot),
+	}
+}
+
+type repoStore struct {
+	loose *LooseStore
+	packs *PackStore
+}
+
+func (r *repoStore) Has(hash string) bool {
+	return r.loose.Has(hash) || r.packs.Has(hash)
+}
+
+func (r *repoStore) Read(hash string) (ContentType, []byte, error) {
+	if r.loose.Has(hash) {
+		return r.loose.Read(hash)
+	}
+	return r.packs.Read(hash)
+}
+
+func (r *repoStore) Stream(hash string) (ContentType, int64, io.ReadCloser, error) {
+	if r.loose.Has(hash) {
+		return r.loose.Stream(hash)
+	}
+	return r.packs.Stream(hash)
+}
+
+func (r *repoStore) Write(objType ContentType, content []byte) (string, error) {
+	return r.loose.Write(objType, content)
+}
+
+func (r *repoStore) WriteStream(objType ContentType, size int64, src io.Reader) (string, error) {
+	return r.loose.WriteStream(objType, size, src)
+}
+
+func (r *repoStore) findByPrefix(prefix string) ([]string, error) {
+	loose, err := r.loose.findByPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	packed, err := r.packs.findByPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var hashes []string
+	for _, h := range append(loose, packed...) {
+		if !seen[h] {
+			seen[h] = true
+			hashes = append(hashes, h)
+		}
+	}
+	return hashes, nil
+}
+
+// prefixFinder is implemented by stores that can expand abbreviated hashes.
+type prefixFinder interface {
+	findByPrefix(prefix string) ([]string, error)
+}
+
+// findObjects lists every object in store whose hash starts with prefix.
+func findObjects(store ObjectStore, prefix string) ([]string, error) {
+	finder, ok := store.(prefixFinder)
+	if !ok {
+		if store.Has(prefix) {
+			return []string{prefix}, nil
+		}
+		return nil, nil
+	}
+	return finder.findByPrefix(prefix)
+}
+
+// LooseStore keeps one zlib-deflated file per object under objects/xx/.
+type LooseStore struct {
+	objectsDir string
+}
+
+func NewLooseStore(gitRoot string) *LooseStore {
+	return &LooseStore{
+		objectsDir: filepath.Join(gitRoot, ROOTDIR, "objects"),
+	}
+}
+
+func (l *LooseStore) path(hash string) string {
+	return filepath.Join(l.objectsDir, hash[:2], hash[2:])
+}
+
+func (l *LooseStore) Has(hash string) bool {
+	if len(hash) < 3 {
+		return false
+	}
+	_, err := os.Stat(l.path(hash))
+	return err == nil
+}
+
+func (l *LooseStore) Read(hash string) (ContentType, []byte, error) {
+	if !l.Has(hash) {
+		return "", nil, ERROR_OBJECT_NOT_FOUND
+	}
+	return readObject(l.path(hash))
+}
+
+func (l *LooseStore) Stream(hash string) (ContentType, int64, io.ReadCloser, error) {
+	if !l.Has(hash) {
+		return "", 0, nil, ERROR_OBJECT_NOT_FOUND
+	}
+	return openObject(l.path(hash))
+}
+
+func (l *LooseStore) Write(objType ContentType, content []byte) (string, error) {
+	hash := hashObject(objType, content)
+	if err := writeObject(l.path(hash), objType, content); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+var ERROR_SIZE_MISMATCH = fmt.Errorf("content size changed while writing object")
+
+func (l *LooseStore) WriteStream(objType ContentType, size int64, r io.Reader) (string, error) {
+	tmp, err := createObjectTemp(l.objectsDir)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha1.New()
+	zw := zlib.NewWriter(tmp)
+	w := io.MultiWriter(h, zw)
+	fmt.Fprintf(w, "%s %d\x00", objType, size)
+	n, err := io.Copy(w, io.LimitReader(r, size+1))
+	if err == nil && n != size {
+		err = ERROR_SIZE_MISMATCH
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	return hash, installObject(tmp.Name(), l.path(hash))
+}
+
+// createObjectTemp opens a uniquely named file in objectsDir to write
+// an object into, so concurrent writers never share one.
+func createObjectTemp(objectsDir string) (*os.File, error) {
+	if err := os.MkdirAll(objectsDir, 0755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(objectsDir, "tmp_obj_")
+}
+
+// installObject moves the finished temporary file to path, unless the
+// object is already there.
+func installObject(tmp, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// CreateTemp makes the file 0600; objects are read-only for everyone
+	if err := os.Chmod(tmp, 0444); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// findByPrefix lists loose object hashes starting with prefix.
+func (l *LooseStore) findByPrefix(prefix string) ([]string, error) {
+	if len(prefix) < 2 {
+		return nil, nil
+	}
+	dir := filepath.Join(l.objectsDir, prefix[:2])
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var hashes []string
+	for _, e := range entries {
+		// temporary files live in objectsDir, but skip anything else
+		// that is not an object name
+		if len(e.Name()) != 38 {
+			continue
+		}
+		hash := prefix[:2] + e.Name()
+		if strings.HasPrefix(hash, prefix) {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes, nil
+}
+
+// writeObject stores content as a zlib-deflated loose object,
+// header included, so the file matches what git itself writes.
+func writeObject(path string, objType ContentType, content []byte) error {
+	// If object already exists, do nothing (Git behavior)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	compressed, err := compressObject(objType, content)
+	if err != nil {
+		return err
+	}
+
+	// objects/xx/yyyy: the temporary file goes in objects/
+	f, err := createObjectTemp(filepath.Dir(filepath.Dir(path)))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(compressed); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return installObject(f.Name(), path)
+}
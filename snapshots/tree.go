@@ -0,0 +1,96 @@
+package snapshots
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+const (
+	TreeMode    string = "40000"
+	GitlinkMode string = "160000"
+)
+
+// treeSortKey is the name git compares entries by: directories
+// sort as if their name ended with a slash.
+func treeSortKey(e CommitTree) string {
+	if e.contentType == Tree {
+		return e.Name + "/"
+	}
+	return e.Name
+}
+
+func sortTreeEntries(entries []CommitTree) {
+	sort.Slice(entries, func(i, j int) bool {
+		return treeSortKey(entries[i]) < treeSortKey(entries[j])
+	})
+}
+
+// encodeTree serializes entries in git's binary tree format,
+// one "<mode> <name>\0<20-byte sha>" record per entry.
+func encodeTree(entries []CommitTree) ([]byte, error) {
+	sortTreeEntries(entries)
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		raw, err := hex.DecodeString(e.Hash)
+		if err != nil || len(raw) != 20 {
+			return nil, fmt.Errorf("invalid hash %q for tree entry %s", e.Hash, e.Name)
+		}
+		buf.WriteString(e.fileMode)
+		buf.WriteByte(' ')
+		buf.WriteString(e.Name)
+		buf.WriteByte(0)
+		buf.Write(raw)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeTree parses a binary tree object back into its entries.
+func decodeTree(data []byte) ([]CommitTree, error) {
+	var entries []CommitTree
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		if sp < 1 {
+			return nil, ERROR_MALFORMED_TREE_FORMAT
+		}
+		mode := string(data[:sp])
+		data = data[sp+1:]
+
+		nul := bytes.IndexByte(data, 0)
+		if nul < 1 || len(data) < nul+1+20 {
+			return nil, ERROR_MALFORMED_TREE_FORMAT
+		}
+		name := string(data[:nul])
+		hash := hex.EncodeToString(data[nul+1 : nul+21])
+		data = data[nul+21:]
+
+		contentType := Blob
+		switch mode {
+		case TreeMode, "040000":
+			mode = TreeMode
+			contentType = Tree
+		case GitlinkMode:
+			contentType = CommitType
+		}
+		entries = append(entries, CommitTree{
+			fileMode:    mode,
+			contentType: contentType,
+			Hash:        hash,
+			Name:        name,
+		})
+	}
+	return entries, nil
+}
+
+func readTree(store ObjectStore, hash string) ([]CommitTree, error) {
+	objType, content, err := store.Read(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != Tree {
+		return nil, fmt.Errorf("object %s is a %s, not a tree", hash, objType)
+	}
+	return decodeTree(content)
+}
@@ -0,0 +1,34 @@
+package snapshots
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreeEntryOrdering(t *testing.T) {
+	entries := []CommitTree{
+		{fileMode: "100755", contentType: Blob, Name: "a0", Hash: "b68025345d5301abad4d9ec9166f455243a0d746"},
+		{fileMode: TreeMode, contentType: Tree, Name: "a", Hash: "66888b8a4047e85b652de6a7370447104da640ea"},
+		{fileMode: "100644", contentType: Blob, Name: "a.txt", Hash: "45b983be36b73c0788dc9cbcb76cbb80fc7bb057"},
+		{fileMode: "100644", contentType: Blob, Name: "a.b", Hash: "bca70f35318f31dd1d1d1d2d2e64c19b880899ff"},
+	}
+	content, err := encodeTree(entries)
+	assert.NoError(t, err)
+	// same hash as `git write-tree` for this index
+	assert.Equal(t, "c70ae7fcfa2d8cdb42296823422a58e2a3bc8b0c", hashObject(Tree, content))
+
+	decoded, err := decodeTree(content)
+	assert.NoError(t, err)
+	names := []string{}
+	for _, e := range decoded {
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, []string{"a.b", "a.txt", "a", "a0"}, names)
+	assert.Equal(t, Tree, decoded[2].contentType)
+}
+
+func TestDecodeTreeMalformed(t *testing.T) {
+	_, err := decodeTree([]byte("100644 name\x00short"))
+	assert.ErrorIs(t, err, ERROR_MALFORMED_TREE_FORMAT)
+}